@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How long a second launch waits for the running launcher to respond
+const activationTimeout = 5 * time.Second
+
+var ErrNoRunningInstance = errors.New("the launcher is not running")
+
+// activation is the command line of a second launch, handed to the running
+// launcher to act on (see activateLauncher). It is sent as a line of JSON over
+// a Unix domain socket (supported on Windows 10 and newer), in a directory
+// only the current user can access.
+type activation struct {
+	Args []string `json:"args"`
+}
+
+type activationResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// activationSocketPath() is the socket the launcher for instanceKey listens
+// on, next to its lock file
+func activationSocketPath() (string, error) {
+	dir, err := instanceDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, instanceKey+".sock"), nil
+}
+
+// listenForActivations() calls handle for each activation, from a new
+// goroutine, and replies with the error it returns. Only the launcher listens,
+// after it has taken the instance lock (see lockInstance), so a socket file
+// that is already there was left behind by a launcher that crashed.
+func listenForActivations(handle func(activation) error) (io.Closer, error) {
+	pathToSocket, err := activationSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(pathToSocket), 0700); err != nil {
+		return nil, err
+	}
+	os.Remove(pathToSocket)
+
+	listener, err := net.Listen("unix", pathToSocket)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleActivation(conn, handle)
+		}
+	}()
+	return listener, nil
+}
+
+func handleActivation(conn net.Conn, handle func(activation) error) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(activationTimeout))
+
+	var request activation
+	response := activationResponse{}
+	if line, err := bufio.NewReader(conn).ReadBytes('\n'); err != nil {
+		return
+	} else if err := json.Unmarshal(line, &request); err != nil {
+		response.Error = fmt.Sprintf("invalid request: %s", err.Error())
+	} else if err := handle(request); err != nil {
+		response.Error = err.Error()
+	}
+	json.NewEncoder(conn).Encode(response)
+}
+
+// sendActivation() asks the running launcher to do something, returning
+// ErrNoRunningInstance if there isn't one
+func sendActivation(request activation) error {
+	// Otherwise Windows won't let the launcher bring its windows to the front
+	allowActivation()
+
+	pathToSocket, err := activationSocketPath()
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("unix", pathToSocket, activationTimeout)
+	if err != nil {
+		return ErrNoRunningInstance
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(activationTimeout))
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return err
+	}
+	var response activationResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return fmt.Errorf("no response from the launcher: %w", err)
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
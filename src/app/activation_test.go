@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestActivation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Where instanceDir() looks on Linux and Windows
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	t.Setenv("LocalAppData", dir)
+
+	if err := sendActivation(activation{Args: []string{"open", "icarus://nav"}}); !errors.Is(err, ErrNoRunningInstance) {
+		t.Fatalf("expected ErrNoRunningInstance, got %v", err)
+	}
+
+	received := make(chan activation, 1)
+	listener, err := listenForActivations(func(request activation) error {
+		if len(request.Args) == 0 || request.Args[0] != "open" {
+			return errors.New("unknown command")
+		}
+		received <- request
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sendActivation(activation{Args: []string{"open", "icarus://nav/route?system=Sol"}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if request := <-received; !reflect.DeepEqual(request.Args, []string{"open", "icarus://nav/route?system=Sol"}) {
+		t.Errorf("expected the command line to be passed on, got %+v", request)
+	}
+	if err := sendActivation(activation{Args: []string{"frobnicate"}}); err == nil || err.Error() != "unknown command" {
+		t.Errorf("expected the launcher's error to be returned, got %v", err)
+	}
+
+	// A socket left behind by a launcher that crashed is replaced
+	listener.Close()
+	pathToSocket, _ := activationSocketPath()
+	ioutil.WriteFile(pathToSocket, []byte{}, 0600)
+	if err := sendActivation(activation{Args: []string{"open"}}); !errors.Is(err, ErrNoRunningInstance) {
+		t.Errorf("expected ErrNoRunningInstance for a stale socket, got %v", err)
+	}
+	listener, err = listenForActivations(func(activation) error { return nil })
+	if err != nil {
+		t.Fatalf("expected a stale socket to be replaced, got %v", err)
+	}
+	listener.Close()
+}
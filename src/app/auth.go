@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	neturl "net/url" // The launcher's URL is the global url
+	"os"
+	"sync"
+	"time"
+)
+
+// The service only answers clients that have the token the launcher started
+// it with. It is passed to the service and terminals in the environment, as
+// command lines can be seen by other users.
+const AUTH_TOKEN_ENV = "ICARUS_AUTH_TOKEN"
+
+// Query parameter the service swaps for a cookie (see src/service/lib/auth.js)
+const AUTH_TOKEN_PARAM = "token"
+
+// The system browser is opened at this path on the launcher's port, with a
+// code the proxy swaps for the session's cookie (see browserLink)
+const AUTH_EXCHANGE_PATH = "/auth/exchange"
+const AUTH_CODE_PARAM = "code"
+
+// How long the browser has to open a link from browserLink()
+const authCodeLifetime = time.Minute
+
+// Codes made by browserLink() that haven't been used, and when they expire
+var authCodes = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: map[string]time.Time{}}
+
+// authCookieName() is the cookie the service keeps the token in. It includes
+// the port, as cookies are shared by services on other ports.
+func authCookieName() string {
+	return fmt.Sprintf("icarus_token_%d", port)
+}
+
+// Token for this session, empty if the service doesn't check one (e.g. a
+// terminal for a service started by something other than the launcher)
+var authToken string
+
+// resolveAuthToken() uses the token this process was given, e.g. by the
+// launcher that started it, or makes a new one. An empty token would turn
+// checking off, so is treated as not having been given one.
+func resolveAuthToken() error {
+	if token := os.Getenv(AUTH_TOKEN_ENV); token != "" {
+		authToken = token
+		return nil
+	}
+	token, err := newAuthToken()
+	if err != nil {
+		return err
+	}
+	authToken = token
+	return nil
+}
+
+func newAuthToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// withAuthToken() adds the session's token to a URL on the service, for
+// windows and browsers opening it for the first time
+func withAuthToken(link string) string {
+	if authToken == "" {
+		return link
+	}
+	parsed, err := neturl.Parse(link)
+	if err != nil {
+		return link
+	}
+	query := parsed.Query()
+	query.Set(AUTH_TOKEN_PARAM, authToken)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// browserLink() is a link to the service for the system browser. The browser
+// is started with the link on its command line, which other users can see,
+// and keeps it in its history, so rather than the session's token the link
+// has a code that can only be used once, for a minute.
+func browserLink(link string) string {
+	parsed, err := neturl.Parse(link)
+	if authToken == "" || err != nil {
+		return link
+	}
+	code, err := newAuthToken()
+	if err != nil {
+		return link
+	}
+	now := time.Now()
+	authCodes.Lock()
+	for unused, expires := range authCodes.expires {
+		if now.After(expires) {
+			delete(authCodes.expires, unused)
+		}
+	}
+	authCodes.expires[code] = now.Add(authCodeLifetime)
+	authCodes.Unlock()
+
+	next := parsed.RequestURI()
+	parsed.Path, parsed.RawPath, parsed.RawQuery = AUTH_EXCHANGE_PATH, "", neturl.Values{AUTH_CODE_PARAM: {code}, "next": {next}}.Encode()
+	return parsed.String()
+}
+
+// takeAuthCode() is true if code was made by browserLink() and has neither
+// expired nor been used before
+func takeAuthCode(code string) bool {
+	authCodes.Lock()
+	defer authCodes.Unlock()
+	expires, ok := authCodes.expires[code]
+	delete(authCodes.expires, code)
+	return ok && time.Now().Before(expires)
+}
+
+// authTokenEnv() is the environment for processes that talk to the service
+func authTokenEnv() []string {
+	env := os.Environ()
+	if authToken != "" {
+		env = append(env, AUTH_TOKEN_ENV+"="+authToken)
+	}
+	return env
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithAuthToken(t *testing.T) {
+	defer func() { authToken = "" }()
+
+	authToken = ""
+	if link := withAuthToken("http://localhost:3300/nav/map"); link != "http://localhost:3300/nav/map" {
+		t.Errorf("expected no token without a session token, got %s", link)
+	}
+
+	t.Setenv(AUTH_TOKEN_ENV, "")
+	if err := resolveAuthToken(); err != nil || len(authToken) != 64 {
+		t.Errorf("expected a new token rather than an empty one from the environment, got %q (%v)", authToken, err)
+	}
+
+	t.Setenv(AUTH_TOKEN_ENV, "abc123")
+	resolveAuthToken()
+	tests := map[string]string{
+		"http://localhost:3300":                      "http://localhost:3300?token=abc123",
+		"http://localhost:3300/launcher":             "http://localhost:3300/launcher?token=abc123",
+		"http://localhost:3300/nav/route?system=Sol": "http://localhost:3300/nav/route?system=Sol&token=abc123",
+	}
+	for link, expected := range tests {
+		if actual := withAuthToken(link); actual != expected {
+			t.Errorf("%s: expected %s, got %s", link, expected, actual)
+		}
+	}
+	env := strings.Join(authTokenEnv(), "\n")
+	if !strings.HasSuffix(env, AUTH_TOKEN_ENV+"=abc123") {
+		t.Errorf("expected the token to be passed on in the environment")
+	}
+}
+
+func TestNewAuthToken(t *testing.T) {
+	first, err := newAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := newAuthToken()
+	if len(first) != 64 || first == second {
+		t.Errorf("expected new 256 bit tokens, got %s and %s", first, second)
+	}
+}
+
+func TestBrowserLink(t *testing.T) {
+	defer func() { authToken = "" }()
+	authToken = ""
+	if link := browserLink("http://localhost:3300/nav/map"); link != "http://localhost:3300/nav/map" {
+		t.Errorf("expected the link as it is without a session token, got %s", link)
+	}
+
+	authToken = "abc123"
+	link, err := neturl.Parse(browserLink("http://localhost:3300/nav/route?system=Sol"))
+	if err != nil || strings.Contains(link.String(), "abc123") || link.Path != AUTH_EXCHANGE_PATH {
+		t.Fatalf("expected a link to swap a code for the token, got %s (%v)", link, err)
+	}
+	if next := link.Query().Get("next"); next != "/nav/route?system=Sol" {
+		t.Errorf("expected to be sent on to the page afterwards, got %s", next)
+	}
+	code := link.Query().Get(AUTH_CODE_PARAM)
+	if !takeAuthCode(code) || takeAuthCode(code) {
+		t.Errorf("expected code %q to work once", code)
+	}
+	if takeAuthCode("") || takeAuthCode("abc123") {
+		t.Errorf("expected only codes from browserLink() to work")
+	}
+
+	link, _ = neturl.Parse(browserLink("http://localhost:3300"))
+	code = link.Query().Get(AUTH_CODE_PARAM)
+	authCodes.Lock()
+	authCodes.expires[code] = time.Now().Add(-time.Second)
+	authCodes.Unlock()
+	if takeAuthCode(code) {
+		t.Errorf("expected expired codes not to work")
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Browsers only allow things like the clipboard and wake lock on secure pages,
+// so with https on the service also serves HTTPS to devices on the LAN. The
+// launcher makes its own certificate authority, which is installed once on
+// each tablet or phone, and signs a certificate for this computer with it.
+//
+// The certificates are shared by all profiles, so devices only need to trust
+// one authority.
+const CERTIFICATES_DIR = "Certificates"
+const CA_CERTIFICATE_FILE = "ICARUS Terminal CA.crt"
+
+const (
+	caKeyFile               = "ca-key.pem"
+	serverCertificateFile   = "server.crt"
+	serverKeyFile           = "server-key.pem"
+	caCertificateLifetime   = 10 * 365 * 24 * time.Hour
+	serverCertificateRenew  = 30 * 24 * time.Hour  // Replaced when it expires sooner than this
+	serverCertificateExpiry = 397 * 24 * time.Hour // Browsers reject certificates that last longer
+)
+
+// The certificate authority can only sign for these addresses (loopback,
+// private and link-local) and for localhost, .local names and this computer's
+// hostname, so its key can't be used to impersonate other sites to the devices
+// that trust it
+var caPermittedIPRanges = parseCIDRs("127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "::1/128", "fc00::/7", "fe80::/10")
+
+func caPermittedDNSDomains(hostname string) []string {
+	domains := []string{"localhost", ".local"}
+	if hostname != "" {
+		domains = append(domains, hostname)
+	}
+	return domains
+}
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	ranges := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges
+}
+
+// ServiceCertificates are the files passed to the service
+type ServiceCertificates struct {
+	CertFile string // Server certificate
+	KeyFile  string
+	CaFile   string // Offered to devices at /ca.crt, to install
+}
+
+func certificatesDir() (string, error) {
+	dir, err := profileDir(DEFAULT_PROFILE)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, CERTIFICATES_DIR), nil
+}
+
+// certificateHosts() are the names and addresses devices might use to reach
+// this computer
+func certificateHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+	return append(hosts, lanAddresses()...)
+}
+
+// serviceCertificates() returns the certificates for the service, making them
+// first if needed. The server certificate is replaced when it is close to
+// expiring, or when this computer has a new address it doesn't cover.
+func serviceCertificates() (ServiceCertificates, error) {
+	dir, err := certificatesDir()
+	if err != nil {
+		return ServiceCertificates{}, err
+	}
+	return ensureCertificates(dir, certificateHosts(), time.Now())
+}
+
+func ensureCertificates(dir string, hosts []string, now time.Time) (ServiceCertificates, error) {
+	certificates := ServiceCertificates{
+		CertFile: filepath.Join(dir, serverCertificateFile),
+		KeyFile:  filepath.Join(dir, serverKeyFile),
+		CaFile:   filepath.Join(dir, CA_CERTIFICATE_FILE),
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return certificates, err
+	}
+
+	ca, caKey, err := loadCertificate(certificates.CaFile, filepath.Join(dir, caKeyFile))
+	if err != nil || now.After(ca.NotAfter) || !ca.PermittedDNSDomainsCritical {
+		// Devices will need the new authority installing. Authorities made
+		// before they were constrained are replaced too.
+		if ca, caKey, err = createCertificate(certificates.CaFile, filepath.Join(dir, caKeyFile), nil, nil, hosts, now); err != nil {
+			return certificates, fmt.Errorf("unable to create certificate authority: %w", err)
+		}
+	}
+
+	hosts = permittedHosts(ca, hosts)
+	server, _, err := loadCertificate(certificates.CertFile, certificates.KeyFile)
+	if err != nil || !serverCertificateValid(server, ca, hosts, now) {
+		if _, _, err = createCertificate(certificates.CertFile, certificates.KeyFile, ca, caKey, hosts, now); err != nil {
+			return certificates, fmt.Errorf("unable to create server certificate: %w", err)
+		}
+	}
+	return certificates, nil
+}
+
+// permittedHosts() leaves out hosts the certificate authority can't sign for,
+// e.g. a public address, as devices would reject a certificate that has them
+func permittedHosts(ca *x509.Certificate, hosts []string) []string {
+	permitted := []string{}
+	for _, host := range hosts {
+		if caPermits(ca, host) {
+			permitted = append(permitted, host)
+		}
+	}
+	return permitted
+}
+
+func caPermits(ca *x509.Certificate, host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		for _, ipNet := range ca.PermittedIPRanges {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, domain := range ca.PermittedDNSDomains {
+		if strings.HasPrefix(domain, ".") && strings.HasSuffix(strings.ToLower(host), strings.ToLower(domain)) {
+			return true
+		}
+		if strings.EqualFold(host, domain) || strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+func serverCertificateValid(server *x509.Certificate, ca *x509.Certificate, hosts []string, now time.Time) bool {
+	if server.CheckSignatureFrom(ca) != nil || now.Add(serverCertificateRenew).After(server.NotAfter) {
+		return false
+	}
+	for _, host := range hosts {
+		if server.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func loadCertificate(certFile string, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	certPem, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPem, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	certBlock, _ := pem.Decode(certPem)
+	keyBlock, _ := pem.Decode(keyPem)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("not a PEM file")
+	}
+	certificate, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("unsupported private key")
+	}
+	return certificate, signer, nil
+}
+
+// createCertificate() makes a certificate authority if ca is nil, otherwise a
+// server certificate for hosts signed by ca
+func createCertificate(certFile string, keyFile string, ca *x509.Certificate, caKey crypto.Signer, hosts []string, now time.Time) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		NotBefore:    now.Add(-time.Hour), // Allow for clocks being a little out
+	}
+	if ca == nil {
+		template.Subject = pkix.Name{Organization: []string{"ICARUS Terminal"}, CommonName: fmt.Sprintf("ICARUS Terminal CA (%s)", hostname)}
+		template.NotAfter = now.Add(caCertificateLifetime)
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		template.BasicConstraintsValid = true
+		template.IsCA = true
+		template.MaxPathLenZero = true
+		template.PermittedDNSDomainsCritical = true
+		template.PermittedDNSDomains = caPermittedDNSDomains(hostname)
+		template.PermittedIPRanges = caPermittedIPRanges
+		ca, caKey = template, key
+	} else {
+		template.Subject = pkix.Name{Organization: []string{"ICARUS Terminal"}, CommonName: hostname}
+		template.NotAfter = now.Add(serverCertificateExpiry)
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		for _, host := range hosts {
+			if ip := net.ParseIP(host); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, host)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return nil, nil, err
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	return certificate, key, err
+}
+
+// exportCaCertificate() copies the certificate authority to path, for
+// installing on devices that don't download it from the service
+func exportCaCertificate(path string) error {
+	certificates, err := serviceCertificates()
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(certificates.CaFile)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnsureCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certificates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hosts := []string{"localhost", "127.0.0.1", "192.168.1.20"}
+
+	// A public address can't be signed for, so it is left out
+	certificates, err := ensureCertificates(dir, append(hosts, "203.0.113.7"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.LoadX509KeyPair(certificates.CertFile, certificates.KeyFile); err != nil {
+		t.Fatalf("expected a usable key pair: %v", err)
+	}
+	ca, _, err := loadCertificate(certificates.CaFile, filepath.Join(dir, caKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _, err := loadCertificate(certificates.CertFile, certificates.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	for _, host := range hosts {
+		if _, err := server.Verify(x509.VerifyOptions{DNSName: host, Roots: roots, CurrentTime: now}); err != nil {
+			t.Errorf("expected the certificate to be trusted for %s: %v", host, err)
+		}
+	}
+
+	if len(server.IPAddresses) != 2 {
+		t.Errorf("expected only private and loopback addresses, got %v", server.IPAddresses)
+	}
+
+	// The authority's key can't be used to impersonate other sites
+	if !ca.PermittedDNSDomainsCritical {
+		t.Error("expected the certificate authority to be constrained")
+	}
+	caCert, caKey, _ := loadCertificate(certificates.CaFile, filepath.Join(dir, caKeyFile))
+	for _, host := range []string{"example.com", "8.8.8.8"} {
+		otherDir := filepath.Join(dir, "other")
+		os.MkdirAll(otherDir, 0700)
+		other, _, err := createCertificate(filepath.Join(otherDir, "other.crt"), filepath.Join(otherDir, "other-key.pem"), caCert, caKey, []string{host}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := other.Verify(x509.VerifyOptions{DNSName: host, Roots: roots, CurrentTime: now}); err == nil {
+			t.Errorf("expected a certificate for %s not to be trusted", host)
+		}
+	}
+	for host, permitted := range map[string]bool{"tablet.local": true, "LOCALHOST": true, "local": false, "localhost.example.com": false, "fd00::1": true, "100.64.0.1": false} {
+		if caPermits(ca, host) != permitted {
+			t.Errorf("%s: expected permitted to be %v", host, permitted)
+		}
+	}
+
+	// Nothing changes while the certificates are still good
+	if _, err := ensureCertificates(dir, hosts, now.Add(24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if same, _, _ := loadCertificate(certificates.CertFile, certificates.KeyFile); !same.Equal(server) {
+		t.Error("expected the server certificate to be kept")
+	}
+
+	// A new address, or the certificate nearly expiring, replaces it but
+	// keeps the authority devices have installed
+	for _, renew := range []struct {
+		hosts []string
+		now   time.Time
+	}{
+		{append(hosts, "10.0.0.5"), now},
+		{hosts, now.Add(serverCertificateExpiry - serverCertificateRenew/2)},
+	} {
+		if _, err := ensureCertificates(dir, renew.hosts, renew.now); err != nil {
+			t.Fatal(err)
+		}
+		renewed, _, _ := loadCertificate(certificates.CertFile, certificates.KeyFile)
+		if renewed.Equal(server) {
+			t.Errorf("expected a new server certificate for %v at %v", renew.hosts, renew.now)
+		}
+		if sameCa, _, _ := loadCertificate(certificates.CaFile, filepath.Join(dir, caKeyFile)); !sameCa.Equal(ca) {
+			t.Error("expected the certificate authority to be kept")
+		}
+		if err := renewed.CheckSignatureFrom(ca); err != nil {
+			t.Error(err)
+		}
+		server = renewed
+	}
+}
@@ -0,0 +1,651 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes, so that scripts (and the installer) can tell what happened
+const (
+	exitOK              = 0
+	exitError           = 1 // The command failed
+	exitUsage           = 2 // The command line was invalid
+	exitUpdateAvailable = 3 // "update check" found a newer release
+)
+
+// cliCommand is a subcommand of the executable, e.g. "config get". Commands
+// with two words are grouped under the first in the help output.
+type cliCommand struct {
+	Name        string
+	Args        string // Shown in help, e.g. "<key> <value>"
+	MinArgs     int
+	MaxArgs     int
+	Summary     string
+	Description string
+	Flags       []cliFlag
+	Hidden      bool // Not listed in help, e.g. only used by the installer
+}
+
+type cliFlag struct {
+	Name  string
+	Usage string
+	Bool  bool // Can be given without a value, e.g. --json
+}
+
+var portFlag = cliFlag{Name: "port", Usage: "Port the service runs on (0 for any free port)"}
+var widthFlag = cliFlag{Name: "width", Usage: "Default width of terminal windows"}
+var heightFlag = cliFlag{Name: "height", Usage: "Default height of terminal windows"}
+var instanceFlag = cliFlag{Name: "instance", Usage: "Launcher to use, so launchers with different keys can run side by side (defaults to " + DEFAULT_INSTANCE_KEY + ")"}
+var profileFlag = cliFlag{Name: "profile", Usage: "Profile to use, each with its own settings and launcher (defaults to " + DEFAULT_PROFILE + ")"}
+var jsonFlag = cliFlag{Name: "json", Usage: "Print JSON instead of text", Bool: true}
+
+var cliCommands = []*cliCommand{
+	{
+		Name:        "launch",
+		Summary:     "Start the service and open the launcher (the default)",
+		Description: "Starts the ICARUS Terminal Service and opens the launcher window. Only one launcher can run at a time.",
+		Flags:       []cliFlag{portFlag, widthFlag, heightFlag, profileFlag, instanceFlag},
+	},
+	{
+		Name:        "terminal",
+		Summary:     "Open a terminal window",
+		Description: "Opens a terminal window for a service that is already running, e.g. one started by the launcher. Sizes and positions are in pixels.",
+		Flags: []cliFlag{
+			portFlag,
+			{Name: "width", Usage: "Window width (defaults to windowWidth in the config)"},
+			{Name: "height", Usage: "Window height (defaults to windowHeight in the config)"},
+			{Name: "x", Usage: "Distance from the left of the monitor's work area (needs --y)"},
+			{Name: "y", Usage: "Distance from the top of the monitor's work area (needs --x)"},
+			{Name: "monitor", Usage: "Monitor to open on, numbered from 1 (0 for the primary monitor)"},
+			{Name: "route", Usage: "Page to open, e.g. /nav/map"},
+			{Name: "pinned", Usage: "Start pinned (borderless and always on top)", Bool: true},
+			{Name: "fullscreen", Usage: "Start fullscreen", Bool: true},
+			{Name: "zoom", Usage: "Zoom level, e.g. 1.5 or 150%"},
+			{Name: "title", Usage: "Window title"},
+			profileFlag,
+			instanceFlag,
+		},
+	},
+	{
+		Name:        "open",
+		Args:        "<link>",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Summary:     "Open an icarus:// link",
+		Description: "Opens a link like icarus://nav/route?system=Sol in the running launcher, which focuses a terminal already showing that page or opens a new one. Starts the launcher if it isn't running.",
+		Flags:       []cliFlag{profileFlag, instanceFlag},
+	},
+	{
+		Name:        "service",
+		Summary:     "Run the service without any windows",
+		Description: "Runs the ICARUS Terminal Service in the foreground until it stops or is interrupted, for use from a browser on this or another device. The service is restarted if it stops, unless it keeps stopping straight away, in which case the exit code is the service's. Requests are logged along with its output.",
+		Flags:       []cliFlag{portFlag, profileFlag},
+	},
+	{
+		Name:        "update check",
+		Summary:     "Check for a newer release",
+		Description: fmt.Sprintf("Checks for a newer release. Exits with %d if there is one, %d if not.", exitUpdateAvailable, exitOK),
+		Flags:       []cliFlag{jsonFlag},
+	},
+	{
+		Name:        "update install",
+		Summary:     "Install the latest release",
+		Description: "Installs the latest release if it is newer than this one. A running launcher is asked to install it, so it can close its terminals and stop the service first.",
+	},
+	{
+		Name:        "diagnose",
+		Summary:     "Check the installation and configuration",
+		Description: fmt.Sprintf("Checks the service executable, config and save game directory are usable. Exits with %d if any check fails.", exitError),
+		Flags:       []cliFlag{jsonFlag},
+	},
+	{
+		Name:    "version",
+		Summary: "Print the version",
+		Flags:   []cliFlag{jsonFlag},
+	},
+	{
+		Name:        "config get",
+		Args:        "[<key>]",
+		MaxArgs:     1,
+		Summary:     "Print settings",
+		Description: "Prints a setting, or every setting along with where its value came from (default, file, env or flag).",
+		Flags:       []cliFlag{profileFlag, jsonFlag},
+	},
+	{
+		Name:        "config set",
+		Args:        "<key> <value>",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Summary:     "Save a setting to the config file",
+		Description: "Saves a setting to the config file. A running launcher applies it straight away if it can, otherwise on the next start.",
+		Flags:       []cliFlag{profileFlag},
+	},
+	{
+		Name:        "profile list",
+		Summary:     "List profiles",
+		Description: "Lists the profiles that can be given to --profile. The " + DEFAULT_PROFILE + " profile always exists.",
+		Flags:       []cliFlag{jsonFlag},
+	},
+	{
+		Name:        "profile create",
+		Args:        "<name>",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Summary:     "Create a profile",
+		Description: "Creates a profile with the default settings, except that its service runs on a free port no other profile uses. Change its settings with config set --profile <name>.",
+	},
+	{
+		Name:        "certificate export",
+		Args:        "[<path>]",
+		MaxArgs:     1,
+		Summary:     "Save the certificate authority for HTTPS",
+		Description: "Saves the certificate authority the service's HTTPS certificate is signed with (defaults to \"" + CA_CERTIFICATE_FILE + "\" in the current directory), for installing on tablets and phones. Makes it first if needed. Devices can also download it from /ca.crt on the service.",
+	},
+	{
+		Name:    "help",
+		Args:    "[<command>]",
+		MaxArgs: 2,
+		Summary: "Show help for a command",
+	},
+	{
+		// Run by the installer when it finishes (see installer.nsi)
+		Name:   "install",
+		Hidden: true,
+	},
+}
+
+// cliInvocation is a parsed command line
+type cliInvocation struct {
+	Command *cliCommand
+	Args    []string
+	Flags   map[string]string // Only flags that were given, by name
+}
+
+func (i cliInvocation) Bool(name string) bool {
+	value, _ := strconv.ParseBool(i.Flags[name])
+	return value
+}
+
+// usageError is a command line that can't be run. Command is the command the
+// error is about, if it got that far, so its help can be shown.
+type usageError struct {
+	Command *cliCommand
+	Message string
+}
+
+func (e *usageError) Error() string {
+	return e.Message
+}
+
+func findCliCommand(name string) *cliCommand {
+	for _, command := range cliCommands {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+// cliSubcommands() returns the commands in a group, e.g. "config"
+func cliSubcommands(group string) []string {
+	names := []string{}
+	for _, command := range cliCommands {
+		if strings.HasPrefix(command.Name, group+" ") {
+			names = append(names, strings.TrimPrefix(command.Name, group+" "))
+		}
+	}
+	return names
+}
+
+// parseCommandLine() parses the arguments after the executable. With no
+// arguments, or only flags, it behaves like earlier releases, which had no
+// subcommands: --terminal and --install choose the command and --port,
+// --width and --height are passed on to it.
+func parseCommandLine(args []string) (cliInvocation, error) {
+	if len(args) == 0 {
+		return cliInvocation{Command: findCliCommand("launch"), Flags: map[string]string{}}, nil
+	}
+	if isHelpFlag(args[0]) {
+		return cliInvocation{Command: findCliCommand("help"), Flags: map[string]string{}}, nil
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return parseLegacyCommandLine(args)
+	}
+
+	var command *cliCommand
+	if len(args) > 1 {
+		command = findCliCommand(args[0] + " " + args[1])
+	}
+	if command != nil {
+		args = args[2:]
+	} else if command = findCliCommand(args[0]); command != nil {
+		args = args[1:]
+	} else if subcommands := cliSubcommands(args[0]); len(subcommands) > 0 {
+		return cliInvocation{}, &usageError{Message: fmt.Sprintf("%s needs a subcommand: %s", args[0], strings.Join(subcommands, ", "))}
+	} else {
+		return cliInvocation{}, &usageError{Message: fmt.Sprintf("unknown command %q", args[0])}
+	}
+
+	invocation, err := parseCliFlags(command, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return cliInvocation{Command: findCliCommand("help"), Args: strings.Fields(command.Name), Flags: map[string]string{}}, nil
+	} else if err != nil {
+		return cliInvocation{}, &usageError{command, err.Error()}
+	}
+	if len(invocation.Args) < command.MinArgs || len(invocation.Args) > command.MaxArgs {
+		return cliInvocation{}, &usageError{command, fmt.Sprintf("%s: wrong number of arguments", command.Name)}
+	}
+	return invocation, nil
+}
+
+// parseCliFlags() allows flags before, after and between arguments
+func parseCliFlags(command *cliCommand, args []string) (cliInvocation, error) {
+	flags := flag.NewFlagSet(command.Name, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	for _, f := range command.Flags {
+		if f.Bool {
+			flags.Bool(f.Name, false, f.Usage)
+		} else {
+			flags.String(f.Name, "", f.Usage)
+		}
+	}
+
+	invocation := cliInvocation{Command: command, Args: []string{}, Flags: map[string]string{}}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return invocation, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		invocation.Args = append(invocation.Args, args[0])
+		args = args[1:]
+	}
+	flags.Visit(func(f *flag.Flag) {
+		invocation.Flags[f.Name] = f.Value.String()
+	})
+	return invocation, nil
+}
+
+func parseLegacyCommandLine(args []string) (cliInvocation, error) {
+	legacy := &cliCommand{Name: "launch", Flags: []cliFlag{
+		portFlag, widthFlag, heightFlag,
+		{Name: "terminal", Bool: true},
+		{Name: "install", Bool: true},
+	}}
+	invocation, err := parseCliFlags(legacy, args)
+	if err != nil {
+		return cliInvocation{}, &usageError{Message: err.Error()}
+	}
+	if len(invocation.Args) > 0 {
+		return cliInvocation{}, &usageError{Message: fmt.Sprintf("unexpected argument %q", invocation.Args[0])}
+	}
+
+	invocation.Command = findCliCommand("launch")
+	if invocation.Bool("install") {
+		invocation.Command = findCliCommand("install")
+	} else if invocation.Bool("terminal") {
+		invocation.Command = findCliCommand("terminal")
+	}
+	delete(invocation.Flags, "install")
+	delete(invocation.Flags, "terminal")
+	return invocation, nil
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// cliExecutableName() is how to run this executable in examples, quoted as
+// the Windows one has a space in its name
+func cliExecutableName() string {
+	if strings.Contains(TERMINAL_EXECUTABLE, " ") {
+		return strconv.Quote(TERMINAL_EXECUTABLE)
+	}
+	return TERMINAL_EXECUTABLE
+}
+
+// writeHelp() writes help for a command, or lists every command if command
+// is nil
+func writeHelp(w io.Writer, command *cliCommand) {
+	if command == nil {
+		fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", cliExecutableName())
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, command := range cliCommands {
+			if !command.Hidden {
+				fmt.Fprintf(table, "  %s\t%s\n", command.Name, command.Summary)
+			}
+		}
+		table.Flush()
+		fmt.Fprintf(w, "\nRun %s help <command> for more about a command.\n", cliExecutableName())
+		return
+	}
+
+	usage := fmt.Sprintf("Usage: %s %s", cliExecutableName(), command.Name)
+	if len(command.Flags) > 0 {
+		usage += " [flags]"
+	}
+	if command.Args != "" {
+		usage += " " + command.Args
+	}
+	fmt.Fprintln(w, usage)
+	description := command.Description
+	if description == "" {
+		description = command.Summary
+	}
+	fmt.Fprintf(w, "\n%s\n", description)
+	if len(command.Flags) > 0 {
+		fmt.Fprintln(w, "\nFlags:")
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, f := range command.Flags {
+			name := "--" + f.Name
+			if !f.Bool {
+				name += "=<value>"
+			}
+			fmt.Fprintf(table, "  %s\t%s\n", name, f.Usage)
+		}
+		table.Flush()
+	}
+	if strings.HasPrefix(command.Name, "config ") {
+		keys := []string{}
+		for _, setting := range configSettings {
+			keys = append(keys, setting.Key)
+		}
+		fmt.Fprintf(w, "\nSettings: %s\n", strings.Join(keys, ", "))
+	}
+}
+
+// runCliCommand() runs the commands that don't open a window, writing to
+// stdout and returning the exit code
+func runCliCommand(invocation cliInvocation) int {
+	switch invocation.Command.Name {
+	case "help":
+		return runHelp(invocation)
+	case "version":
+		return runVersion(invocation)
+	case "config get":
+		return runConfigGet(invocation)
+	case "config set":
+		return runConfigSet(invocation)
+	case "update check":
+		return runUpdateCheck(invocation)
+	case "update install":
+		return runUpdateInstall(invocation)
+	case "profile list":
+		return runProfileList(invocation)
+	case "profile create":
+		return runProfileCreate(invocation)
+	case "certificate export":
+		return runCertificateExport(invocation)
+	case "diagnose":
+		return runDiagnose(invocation)
+	case "service":
+		return runService(invocation)
+	}
+	fmt.Fprintf(os.Stderr, "%s can't be run from here\n", invocation.Command.Name)
+	return exitError
+}
+
+func printJSON(value interface{}) int {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	fmt.Println(string(data))
+	return exitOK
+}
+
+func runHelp(invocation cliInvocation) int {
+	if len(invocation.Args) == 0 {
+		writeHelp(os.Stdout, nil)
+		return exitOK
+	}
+	name := strings.Join(invocation.Args, " ")
+	if command := findCliCommand(name); command != nil && !command.Hidden {
+		writeHelp(os.Stdout, command)
+		return exitOK
+	}
+	if subcommands := cliSubcommands(name); len(subcommands) > 0 {
+		for _, subcommand := range subcommands {
+			writeHelp(os.Stdout, findCliCommand(name+" "+subcommand))
+			fmt.Println()
+		}
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	writeHelp(os.Stderr, nil)
+	return exitUsage
+}
+
+type versionInfo struct {
+	Version   string `json:"version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	GoVersion string `json:"goVersion"`
+}
+
+func runVersion(invocation cliInvocation) int {
+	info := versionInfo{GetCurrentAppVersion(), runtime.GOOS, runtime.GOARCH, runtime.Version()}
+	if invocation.Bool("json") {
+		return printJSON(info)
+	}
+	fmt.Println(info.Version)
+	return exitOK
+}
+
+func runConfigGet(invocation cliInvocation) int {
+	if err := resolveLauncherConfig(nil); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	status, _ := configLayers.Status(launcherConfig)
+
+	if len(invocation.Args) == 1 {
+		key := invocation.Args[0]
+		if _, err := findConfigSetting(key); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return exitUsage
+		}
+		for _, setting := range status {
+			if setting.Key != key {
+				continue
+			}
+			if invocation.Bool("json") {
+				return printJSON(setting)
+			}
+			fmt.Println(setting.Value)
+		}
+		return exitOK
+	}
+
+	if invocation.Bool("json") {
+		return printJSON(status)
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, setting := range status {
+		fmt.Fprintf(table, "%s\t%v\t%s\n", setting.Key, setting.Value, setting.Source)
+	}
+	table.Flush()
+	return exitOK
+}
+
+func runConfigSet(invocation cliInvocation) int {
+	if err := resolveLauncherConfig(nil); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	key, value := invocation.Args[0], invocation.Args[1]
+	setting, err := findConfigSetting(key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitUsage
+	}
+	if err := updateLauncherConfig([]string{key}, func(config *LauncherConfig) error {
+		return config.Set(key, value)
+	}); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	if pathToConfig, err := launcherConfigPath(); err == nil {
+		fmt.Printf("Saved %s to %s\n", key, pathToConfig)
+	}
+	if _, overridden := os.LookupEnv(setting.Env); overridden {
+		fmt.Fprintf(os.Stderr, "Saved, but %s is set, which overrides %s\n", setting.Env, key)
+	}
+	return exitOK
+}
+
+func runProfileList(invocation cliInvocation) int {
+	profiles, err := listProfiles()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	if invocation.Bool("json") {
+		return printJSON(profiles)
+	}
+	for _, profile := range profiles {
+		fmt.Println(profile.Name)
+	}
+	return exitOK
+}
+
+func runProfileCreate(invocation cliInvocation) int {
+	name := invocation.Args[0]
+	if err := createProfile(name); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	dir, _ := profileDir(name)
+	fmt.Printf("Created profile %s in %s\n", name, dir)
+	return exitOK
+}
+
+func runCertificateExport(invocation cliInvocation) int {
+	path := CA_CERTIFICATE_FILE
+	if len(invocation.Args) > 0 {
+		path = invocation.Args[0]
+	}
+	if err := exportCaCertificate(path); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to export certificate:", err.Error())
+		return exitError
+	}
+	fmt.Println("Saved", path)
+	return exitOK
+}
+
+func runUpdateCheck(invocation cliInvocation) int {
+	release, err := GetLatestRelease()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to check for updates:", err.Error())
+		return exitError
+	}
+	exitCode := exitOK
+	if release.IsUpgrade {
+		exitCode = exitUpdateAvailable
+	}
+	if invocation.Bool("json") {
+		if printJSON(release) != exitOK {
+			return exitError
+		}
+		return exitCode
+	}
+	if release.IsUpgrade {
+		fmt.Printf("Version %s is available (installed %s)\n", release.ProductVersion, release.InstalledVersion)
+	} else {
+		fmt.Printf("Version %s is the latest release\n", release.InstalledVersion)
+	}
+	return exitCode
+}
+
+func runUpdateInstall(invocation cliInvocation) int {
+	release, err := GetLatestRelease()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to check for updates:", err.Error())
+		return exitError
+	}
+	if !release.IsUpgrade {
+		fmt.Printf("Version %s is the latest release\n", release.InstalledVersion)
+		return exitOK
+	}
+
+	// The launcher installs it the same way as from its own window
+	err = callControlApi(http.MethodPost, "update/install", map[string]string{"strategy": InstallNow}, nil)
+	if err == nil {
+		fmt.Printf("The launcher is installing version %s\n", release.ProductVersion)
+		return exitOK
+	}
+	if !errors.Is(err, ErrNoRunningInstance) {
+		fmt.Fprintln(os.Stderr, "Unable to install the update:", err.Error())
+		return exitError
+	}
+	fmt.Printf("Installing version %s\n", release.ProductVersion)
+	installRelease(release)
+	return exitOK
+}
+
+// diagnosticCheck is one line of the diagnose report
+type diagnosticCheck struct {
+	Name   string `json:"name"`
+	Ok     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+func runDiagnose(invocation cliInvocation) int {
+	checks := []diagnosticCheck{}
+	check := func(name string, err error, detail string) {
+		if err != nil {
+			detail = err.Error()
+		}
+		checks = append(checks, diagnosticCheck{name, err == nil, detail})
+	}
+
+	check("version", nil, fmt.Sprintf("%s (%s/%s)", GetCurrentAppVersion(), runtime.GOOS, runtime.GOARCH))
+
+	pathToService := filepath.Join(dirname, SERVICE_EXECUTABLE)
+	_, err := os.Stat(pathToService)
+	check("service", err, pathToService)
+
+	pathToConfig, err := launcherConfigPath()
+	if err == nil {
+		err = resolveLauncherConfig(nil)
+	}
+	check("config", err, pathToConfig)
+
+	dir, err := findSaveGameDir(launcherConfig.SaveGameDir)
+	check("saveGameDir", err, fmt.Sprintf("%s (from %s)", dir.Path, dir.Source))
+
+	if invocation.Bool("json") {
+		printJSON(checks)
+	} else {
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, c := range checks {
+			result := "ok"
+			if !c.Ok {
+				result = "FAILED"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\n", c.Name, result, c.Detail)
+		}
+		table.Flush()
+	}
+
+	for _, c := range checks {
+		if !c.Ok {
+			return exitError
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	tests := []struct {
+		args    []string
+		command string
+		rest    []string
+		flags   map[string]string
+	}{
+		{[]string{}, "launch", nil, map[string]string{}},
+		{[]string{"launch", "--port=4000", "--width", "1000"}, "launch", nil, map[string]string{"port": "4000", "width": "1000"}},
+		{[]string{"terminal", "--port=4000"}, "terminal", nil, map[string]string{"port": "4000"}},
+		{[]string{"terminal", "--route=/nav/map", "--pinned", "--x", "10", "--y=20"}, "terminal", nil, map[string]string{"route": "/nav/map", "pinned": "true", "x": "10", "y": "20"}},
+		{[]string{"service"}, "service", nil, map[string]string{}},
+		{[]string{"update", "check", "--json"}, "update check", nil, map[string]string{"json": "true"}},
+		{[]string{"version", "--json=false"}, "version", nil, map[string]string{"json": "false"}},
+		{[]string{"config", "get"}, "config get", nil, map[string]string{}},
+		{[]string{"config", "get", "port", "--json"}, "config get", []string{"port"}, map[string]string{"json": "true"}},
+		{[]string{"config", "set", "closeToTray", "true"}, "config set", []string{"closeToTray", "true"}, map[string]string{}},
+		{[]string{"launch", "--profile", "alt"}, "launch", nil, map[string]string{"profile": "alt"}},
+		{[]string{"profile", "create", "alt"}, "profile create", []string{"alt"}, map[string]string{}},
+		{[]string{"config", "set", "port", "0", "--profile=alt"}, "config set", []string{"port", "0"}, map[string]string{"profile": "alt"}},
+		{[]string{"help", "config", "set"}, "help", []string{"config", "set"}, map[string]string{}},
+		{[]string{"--help"}, "help", nil, map[string]string{}},
+		{[]string{"diagnose", "-h"}, "help", []string{"diagnose"}, map[string]string{}},
+
+		// Flags used by earlier releases (and the installer)
+		{[]string{"--install"}, "install", nil, map[string]string{}},
+		{[]string{"--terminal=true", "--port=4000"}, "terminal", nil, map[string]string{"port": "4000"}},
+		{[]string{"--port", "4000", "--width=1000", "--height=700"}, "launch", nil, map[string]string{"port": "4000", "width": "1000", "height": "700"}},
+	}
+
+	for _, test := range tests {
+		invocation, err := parseCommandLine(test.args)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.args, err)
+			continue
+		}
+		if invocation.Command.Name != test.command {
+			t.Errorf("%v: expected %s, got %s", test.args, test.command, invocation.Command.Name)
+		}
+		if len(invocation.Args) > 0 || len(test.rest) > 0 {
+			if !reflect.DeepEqual(invocation.Args, test.rest) {
+				t.Errorf("%v: expected arguments %v, got %v", test.args, test.rest, invocation.Args)
+			}
+		}
+		if !reflect.DeepEqual(invocation.Flags, test.flags) {
+			t.Errorf("%v: expected flags %v, got %v", test.args, test.flags, invocation.Flags)
+		}
+	}
+}
+
+func TestParseCommandLineErrors(t *testing.T) {
+	tests := []struct {
+		args    []string
+		command string // Whose help is shown with the error
+		message string
+	}{
+		{[]string{"frobnicate"}, "", `unknown command "frobnicate"`},
+		{[]string{"config"}, "", "config needs a subcommand: get, set"},
+		{[]string{"update", "now"}, "", "update needs a subcommand: check, install"},
+		{[]string{"config", "set", "port"}, "config set", "wrong number of arguments"},
+		{[]string{"config", "get", "port", "width"}, "config get", "wrong number of arguments"},
+		{[]string{"version", "--width=1000"}, "version", "flag provided but not defined: -width"},
+		{[]string{"--terminal", "extra"}, "", `unexpected argument "extra"`},
+		{[]string{"--json"}, "", "flag provided but not defined: -json"},
+	}
+
+	for _, test := range tests {
+		_, err := parseCommandLine(test.args)
+		var usage *usageError
+		if !errors.As(err, &usage) {
+			t.Errorf("%v: expected a usage error, got %v", test.args, err)
+			continue
+		}
+		if !strings.Contains(usage.Message, test.message) {
+			t.Errorf("%v: expected %q, got %q", test.args, test.message, usage.Message)
+		}
+		if (usage.Command == nil && test.command != "") || (usage.Command != nil && usage.Command.Name != test.command) {
+			t.Errorf("%v: expected help for %q, got %+v", test.args, test.command, usage.Command)
+		}
+	}
+}
+
+func TestWriteHelp(t *testing.T) {
+	var help bytes.Buffer
+	writeHelp(&help, nil)
+	for _, command := range cliCommands {
+		if listed := strings.Contains(help.String(), "  "+command.Name+"  "); listed == command.Hidden {
+			t.Errorf("%s: expected listed to be %v in\n%s", command.Name, !command.Hidden, help.String())
+		}
+	}
+
+	help.Reset()
+	writeHelp(&help, findCliCommand("config set"))
+	for _, expected := range []string{"config set [flags] <key> <value>", "--profile=<value>", "Settings: port,"} {
+		if !strings.Contains(help.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, help.String())
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const LAUNCHER_CONFIG_DIR = "ICARUS Terminal"
+const LAUNCHER_CONFIG_FILE = "Launcher.json"
+
+// Who can connect to the service: only this computer, or devices on the LAN
+// that have been paired with the launcher (see pairing.go)
+const (
+	AccessModeLocal = "local"
+	AccessModeLan   = "lan"
+)
+
+// How often the launcher checks the config file for changes
+const launcherConfigPollInterval = 2 * time.Second
+
+// Where a setting came from, lowest precedence first
+const (
+	ConfigSourceDefault = "default"
+	ConfigSourceFile    = "file"
+	ConfigSourceEnv     = "env"
+	ConfigSourceFlag    = "flag"
+)
+
+var ErrUnknownConfigKey = errors.New("unknown setting")
+
+// LauncherConfig holds the launcher's settings. It is stored as JSON in the
+// per-user config directory, and settings can be overridden by environment
+// variables and command line flags (see launcherConfigLayers.Resolve). Missing
+// fields fall back to the values in DefaultLauncherConfig().
+type LauncherConfig struct {
+	Port             int                     `json:"port"`             // Port the service runs on, 0 for any free port
+	WindowWidth      int                     `json:"windowWidth"`      // Default width of terminal windows
+	WindowHeight     int                     `json:"windowHeight"`     // Default height of terminal windows
+	LauncherWidth    int                     `json:"launcherWidth"`    // Initial width of the launcher window
+	LauncherHeight   int                     `json:"launcherHeight"`   // Initial height of the launcher window
+	Debugger         bool                    `json:"debugger"`         // Allow developer tools in windows
+	ReleaseNotesUrl  string                  `json:"releaseNotesUrl"`  // Opened from the launcher (and by updates on Linux)
+	SaveGameDir      string                  `json:"saveGameDir"`      // Chosen by the user, otherwise found automatically
+	CloseToTray      bool                    `json:"closeToTray"`      // Closing the launcher hides it in the notification area
+	MinimizeToTray   bool                    `json:"minimizeToTray"`   // Minimising the launcher hides it in the notification area
+	AccessMode       string                  `json:"accessMode"`       // AccessModeLocal or AccessModeLan
+	Https            bool                    `json:"https"`            // Also serve HTTPS, for devices on the LAN (see certificates.go)
+	CheckForUpdates  bool                    `json:"checkForUpdates"`  // Check for updates in the background (see update-scheduler.go)
+	UpdateCheckHours int                     `json:"updateCheckHours"` // How often to check
+	DownloadUpdates  bool                    `json:"downloadUpdates"`  // Download updates as soon as they are found
+	Hotkeys          map[HotkeyAction]string `json:"hotkeys"`          // Action to key chord, see defaultHotkeys
+}
+
+// configSetting describes a setting that can be overridden by an environment
+// variable and read or changed by key, from the UI or the command line.
+// Hotkeys have their own bindings, so are not included.
+type configSetting struct {
+	Key       string // Same as the key in the config file
+	Env       string
+	HotReload bool // Applied to the running launcher when changed
+}
+
+var configSettings = []configSetting{
+	{"port", "ICARUS_PORT", false},
+	{"windowWidth", "ICARUS_WINDOW_WIDTH", false},
+	{"windowHeight", "ICARUS_WINDOW_HEIGHT", false},
+	{"launcherWidth", "ICARUS_LAUNCHER_WIDTH", false},
+	{"launcherHeight", "ICARUS_LAUNCHER_HEIGHT", false},
+	{"debugger", "ICARUS_DEBUGGER", false},
+	{"releaseNotesUrl", "ICARUS_RELEASE_NOTES_URL", true},
+	{"saveGameDir", "ICARUS_SAVE_GAME_DIR", false},
+	{"closeToTray", "ICARUS_CLOSE_TO_TRAY", true},
+	{"minimizeToTray", "ICARUS_MINIMIZE_TO_TRAY", true},
+	{"accessMode", "ICARUS_ACCESS_MODE", false},
+	{"https", "ICARUS_HTTPS", false},
+	{"checkForUpdates", "ICARUS_CHECK_FOR_UPDATES", true},
+	{"updateCheckHours", "ICARUS_UPDATE_CHECK_HOURS", true},
+	{"downloadUpdates", "ICARUS_DOWNLOAD_UPDATES", true},
+}
+
+// Command line flags that set a config setting, by flag name
+var configFlags = map[string]string{
+	"port":   "port",
+	"width":  "windowWidth",
+	"height": "windowHeight",
+}
+
+func DefaultLauncherConfig() LauncherConfig {
+	hotkeys := map[HotkeyAction]string{}
+	for action, chord := range defaultHotkeys {
+		hotkeys[action] = chord
+	}
+	return LauncherConfig{
+		Port:             defaultPort,
+		WindowWidth:      int(defaultWindowWidth),
+		WindowHeight:     int(defaultWindowHeight),
+		LauncherWidth:    int(defaultLauncherWindowWidth),
+		LauncherHeight:   int(defaultLauncherWindowHeight),
+		Debugger:         DEBUGGER,
+		ReleaseNotesUrl:  RELEASE_NOTES_URL,
+		AccessMode:       AccessModeLocal,
+		CheckForUpdates:  true,
+		UpdateCheckHours: defaultUpdateCheckHours,
+		Hotkeys:          hotkeys,
+	}
+}
+
+// clone() copies a config, so that changing hotkeys in the copy doesn't
+// change them in the original
+func (c LauncherConfig) clone() LauncherConfig {
+	hotkeys := map[HotkeyAction]string{}
+	for action, chord := range c.Hotkeys {
+		hotkeys[action] = chord
+	}
+	c.Hotkeys = hotkeys
+	return c
+}
+
+// copyHotReloadSettings() updates the settings that can be changed while the
+// launcher is running, returning true if hotkeys changed and need applying.
+func (c *LauncherConfig) copyHotReloadSettings(from LauncherConfig) bool {
+	for _, setting := range configSettings {
+		if setting.HotReload {
+			field, _ := c.field(setting.Key)
+			value, _ := from.Get(setting.Key)
+			field.Set(reflect.ValueOf(value))
+		}
+	}
+	if reflect.DeepEqual(c.Hotkeys, from.Hotkeys) {
+		return false
+	}
+	c.Hotkeys = from.clone().Hotkeys
+	return true
+}
+
+func findConfigSetting(key string) (configSetting, error) {
+	for _, setting := range configSettings {
+		if setting.Key == key {
+			return setting, nil
+		}
+	}
+	keys := []string{}
+	for _, setting := range configSettings {
+		keys = append(keys, setting.Key)
+	}
+	return configSetting{}, fmt.Errorf("%w %q (expected one of %s)", ErrUnknownConfigKey, key, strings.Join(keys, ", "))
+}
+
+// field returns the struct field for a setting, found by its JSON key
+func (c *LauncherConfig) field(key string) (reflect.Value, error) {
+	if _, err := findConfigSetting(key); err != nil {
+		return reflect.Value{}, err
+	}
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0] == key {
+			return value.Field(i), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("%w %q", ErrUnknownConfigKey, key)
+}
+
+func (c LauncherConfig) Get(key string) (interface{}, error) {
+	field, err := c.field(key)
+	if err != nil {
+		return nil, err
+	}
+	return field.Interface(), nil
+}
+
+// Set parses a setting from text, as given in an environment variable or on
+// the command line.
+func (c *LauncherConfig) Set(key string, text string) error {
+	field, err := c.field(key)
+	if err != nil {
+		return err
+	}
+	switch field.Kind() {
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return fmt.Errorf("%s must be a whole number (got %q)", key, text)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return fmt.Errorf("%s must be true or false (got %q)", key, text)
+		}
+		field.SetBool(b)
+	default:
+		field.SetString(text)
+	}
+	return nil
+}
+
+// SetJSON sets a setting from a JSON value, as passed from the UI
+func (c *LauncherConfig) SetJSON(key string, value json.RawMessage) error {
+	field, err := c.field(key)
+	if err != nil {
+		return err
+	}
+	parsed := reflect.New(field.Type())
+	if err := json.Unmarshal(value, parsed.Interface()); err != nil {
+		return fmt.Errorf("%s must be %s (got %s)", key, describeKind(field.Kind()), string(value))
+	}
+	field.Set(parsed.Elem())
+	return nil
+}
+
+func describeKind(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int:
+		return "a whole number"
+	case reflect.Bool:
+		return "true or false"
+	default:
+		return "a string"
+	}
+}
+
+// ConfigError lists everything wrong with a config, so the user can fix it
+// all at once rather than one problem per launch.
+type ConfigError struct {
+	Source   string
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid launcher config (%s):\n- %s", e.Source, strings.Join(e.Problems, "\n- "))
+}
+
+func (c LauncherConfig) Validate() error {
+	problems := []string{}
+	if c.Port < 0 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port must be between 1 and 65535, or 0 for any free port (got %d)", c.Port))
+	}
+	if c.WindowWidth < 320 || c.WindowHeight < 240 {
+		problems = append(problems, fmt.Sprintf("windowWidth and windowHeight must be at least 320x240 (got %dx%d)", c.WindowWidth, c.WindowHeight))
+	}
+	if c.LauncherWidth < int(minLauncherWindowWidth) || c.LauncherHeight < int(minLauncherWindowHeight) {
+		problems = append(problems, fmt.Sprintf("launcherWidth and launcherHeight must be at least %dx%d (got %dx%d)", minLauncherWindowWidth, minLauncherWindowHeight, c.LauncherWidth, c.LauncherHeight))
+	}
+	if !strings.HasPrefix(c.ReleaseNotesUrl, "https://") && !strings.HasPrefix(c.ReleaseNotesUrl, "http://") {
+		problems = append(problems, fmt.Sprintf("releaseNotesUrl must be an http or https URL (got %q)", c.ReleaseNotesUrl))
+	}
+	if c.AccessMode != AccessModeLocal && c.AccessMode != AccessModeLan {
+		problems = append(problems, fmt.Sprintf("accessMode must be %s or %s (got %q)", AccessModeLocal, AccessModeLan, c.AccessMode))
+	}
+	if c.UpdateCheckHours < 1 || c.UpdateCheckHours > maxUpdateCheckHours {
+		problems = append(problems, fmt.Sprintf("updateCheckHours must be between 1 and %d (got %d)", maxUpdateCheckHours, c.UpdateCheckHours))
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return &ConfigError{"settings", problems}
+	}
+	return nil
+}
+
+// launcherConfigLayers holds each layer separately, so that saving the config
+// file never writes environment or command line overrides to it.
+type launcherConfigLayers struct {
+	File     LauncherConfig
+	FileKeys map[string]bool // Settings present in the file
+	Env      func(string) (string, bool)
+	Flags    map[string]string // Setting key to value, for flags that were given
+}
+
+// ConfigSettingStatus is what the settings UI is told about each setting
+type ConfigSettingStatus struct {
+	Key             string      `json:"key"`
+	Value           interface{} `json:"value"`
+	Source          string      `json:"source"`
+	Env             string      `json:"env"`
+	HotReload       bool        `json:"hotReload"`
+	RestartRequired bool        `json:"restartRequired"` // The running launcher is using a different value
+}
+
+// Resolve merges the layers, lowest precedence first: built in
+// defaults, the config file, ICARUS_* environment variables, then command
+// line flags. It returns where each setting came from along with the result,
+// which is only valid if the error is nil.
+func (l launcherConfigLayers) Resolve() (LauncherConfig, map[string]string, error) {
+	config := l.File.clone()
+
+	sources := map[string]string{}
+	problems := []string{}
+	for _, setting := range configSettings {
+		sources[setting.Key] = ConfigSourceDefault
+		if l.FileKeys[setting.Key] {
+			sources[setting.Key] = ConfigSourceFile
+		}
+		if l.Env != nil {
+			if text, ok := l.Env(setting.Env); ok {
+				if err := config.Set(setting.Key, text); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %s", setting.Env, err.Error()))
+				}
+				sources[setting.Key] = ConfigSourceEnv
+			}
+		}
+		if text, ok := l.Flags[setting.Key]; ok {
+			if err := config.Set(setting.Key, text); err != nil {
+				problems = append(problems, fmt.Sprintf("flag: %s", err.Error()))
+			}
+			sources[setting.Key] = ConfigSourceFlag
+		}
+	}
+	if len(problems) > 0 {
+		return config, sources, &ConfigError{"environment and flags", problems}
+	}
+
+	if err := config.Validate(); err != nil {
+		// Say which layers the bad values came from
+		err.(*ConfigError).Source = describeSources(sources)
+		return config, sources, err
+	}
+	return config, sources, nil
+}
+
+func describeSources(sources map[string]string) string {
+	used := map[string]bool{}
+	for _, source := range sources {
+		used[source] = true
+	}
+	names := []string{}
+	for _, source := range []string{ConfigSourceFile, ConfigSourceEnv, ConfigSourceFlag} {
+		if used[source] {
+			names = append(names, source)
+		}
+	}
+	if len(names) == 0 {
+		return ConfigSourceDefault
+	}
+	return strings.Join(names, ", ")
+}
+
+// Status describes each setting for the settings UI, compared with the config
+// the launcher is running with.
+func (l launcherConfigLayers) Status(running LauncherConfig) ([]ConfigSettingStatus, error) {
+	config, sources, err := l.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	status := []ConfigSettingStatus{}
+	for _, setting := range configSettings {
+		value, _ := config.Get(setting.Key)
+		runningValue, _ := running.Get(setting.Key)
+		status = append(status, ConfigSettingStatus{
+			Key:             setting.Key,
+			Value:           value,
+			Source:          sources[setting.Key],
+			Env:             setting.Env,
+			HotReload:       setting.HotReload,
+			RestartRequired: value != runningValue,
+		})
+	}
+	return status, nil
+}
+
+// configFlagValues() returns the settings given on the command line. visit
+// is called with a function to call for each flag that was given.
+func configFlagValues(visit func(func(name string, value string))) map[string]string {
+	flags := map[string]string{}
+	visit(func(name string, value string) {
+		if key, ok := configFlags[name]; ok {
+			flags[key] = value
+		}
+	})
+	return flags
+}
+
+// launcherConfigPath() is the config file for the active profile
+func launcherConfigPath() (string, error) {
+	dir, err := profileDir(activeProfile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, LAUNCHER_CONFIG_FILE), nil
+}
+
+// LoadLauncherConfig returns the defaults if there is no config file yet, so
+// callers only need to handle errors for files that exist but can't be read.
+func LoadLauncherConfig() (LauncherConfig, map[string]bool, error) {
+	pathToConfig, err := launcherConfigPath()
+	if err != nil {
+		return DefaultLauncherConfig(), map[string]bool{}, err
+	}
+	return loadLauncherConfigFile(pathToConfig)
+}
+
+func loadLauncherConfigFile(pathToConfig string) (LauncherConfig, map[string]bool, error) {
+	config := DefaultLauncherConfig()
+	keys := map[string]bool{}
+
+	data, err := ioutil.ReadFile(pathToConfig)
+	if os.IsNotExist(err) {
+		return config, keys, nil
+	} else if err != nil {
+		return config, keys, err
+	}
+
+	// Decode into a map first to find which settings are in the file, and to
+	// give a better error than encoding/json for values of the wrong type
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return DefaultLauncherConfig(), keys, &ConfigError{pathToConfig, []string{fmt.Sprintf("not valid JSON: %s", err.Error())}}
+	}
+
+	problems := []string{}
+	names := []string{}
+	for key := range values {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		keys[key] = true
+		if key == "hotkeys" {
+			hotkeys := map[HotkeyAction]string{}
+			if err := json.Unmarshal(values[key], &hotkeys); err != nil {
+				problems = append(problems, "hotkeys must be an object of action names to key chords")
+			} else if hotkeys != nil {
+				config.Hotkeys = hotkeys
+			}
+			continue
+		}
+		if err := config.SetJSON(key, values[key]); errors.Is(err, ErrUnknownConfigKey) {
+			// Probably written by a newer release, so not worth failing for
+			fmt.Println("Ignoring unknown setting in", pathToConfig, key)
+		} else if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return DefaultLauncherConfig(), keys, &ConfigError{pathToConfig, problems}
+	}
+
+	// Actions added in newer releases get their default chord
+	for action, chord := range defaultHotkeys {
+		if _, ok := config.Hotkeys[action]; !ok {
+			config.Hotkeys[action] = chord
+		}
+	}
+
+	return config, keys, nil
+}
+
+// SaveLauncherConfig only writes the given settings, so that settings the user
+// has never changed keep following the defaults of future releases.
+func SaveLauncherConfig(config LauncherConfig, keys map[string]bool) error {
+	pathToConfig, err := launcherConfigPath()
+	if err != nil {
+		return err
+	}
+	return saveLauncherConfigFile(pathToConfig, config, keys)
+}
+
+func saveLauncherConfigFile(pathToConfig string, config LauncherConfig, keys map[string]bool) error {
+	if err := os.MkdirAll(filepath.Dir(pathToConfig), 0700); err != nil {
+		return err
+	}
+
+	all := map[string]json.RawMessage{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	json.Unmarshal(data, &all)
+
+	values := map[string]json.RawMessage{}
+	for key := range keys {
+		if value, ok := all[key]; ok {
+			values[key] = value
+		}
+	}
+	data, err = json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(pathToConfig, data, 0600)
+}
+
+// watchLauncherConfig() calls onChange from a new goroutine whenever the
+// config file is modified, including by SaveLauncherConfig().
+func watchLauncherConfig(onChange func()) {
+	pathToConfig, err := launcherConfigPath()
+	if err != nil {
+		return
+	}
+	modified := func() time.Time {
+		if info, err := os.Stat(pathToConfig); err == nil {
+			return info.ModTime()
+		}
+		return time.Time{}
+	}
+	go func() {
+		lastModified := modified()
+		for range time.Tick(launcherConfigPollInterval) {
+			if current := modified(); !current.Equal(lastModified) {
+				lastModified = current
+				onChange()
+			}
+		}
+	}()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveLauncherConfig(t *testing.T) {
+	file := DefaultLauncherConfig()
+	file.Port = 4000
+	file.WindowWidth = 1000
+	file.CloseToTray = true
+
+	env := map[string]string{
+		"ICARUS_PORT":         "5000",
+		"ICARUS_WINDOW_WIDTH": "1100",
+	}
+	layers := launcherConfigLayers{
+		File:     file,
+		FileKeys: map[string]bool{"port": true, "windowWidth": true, "closeToTray": true},
+		Env: func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		},
+		Flags: map[string]string{"port": "6000"},
+	}
+
+	config, sources, err := layers.Resolve()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []struct {
+		key    string
+		value  interface{}
+		source string
+	}{
+		{"port", 6000, ConfigSourceFlag},
+		{"windowWidth", 1100, ConfigSourceEnv},
+		{"closeToTray", true, ConfigSourceFile},
+		{"windowHeight", int(defaultWindowHeight), ConfigSourceDefault},
+	}
+	for _, e := range expected {
+		if value, _ := config.Get(e.key); value != e.value {
+			t.Errorf("%s: expected %v, got %v", e.key, e.value, value)
+		}
+		if sources[e.key] != e.source {
+			t.Errorf("%s: expected source %s, got %s", e.key, e.source, sources[e.key])
+		}
+	}
+
+	// Resolving must not change the file layer, which is what gets saved
+	if layers.File.Port != 4000 || layers.File.WindowWidth != 1000 {
+		t.Errorf("Resolve() changed the file layer: %+v", layers.File)
+	}
+
+	status, err := layers.Status(config)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, s := range status {
+		if s.RestartRequired {
+			t.Errorf("%s: did not expect a restart to be required", s.Key)
+		}
+	}
+}
+
+func TestResolveLauncherConfigErrors(t *testing.T) {
+	layers := launcherConfigLayers{
+		File: DefaultLauncherConfig(),
+		Env: func(name string) (string, bool) {
+			if name == "ICARUS_DEBUGGER" {
+				return "maybe", true
+			}
+			return "", false
+		},
+		Flags: map[string]string{"port": "not-a-port"},
+	}
+	_, _, err := layers.Resolve()
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 2 {
+		t.Fatalf("expected both problems to be reported, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "ICARUS_DEBUGGER: debugger must be true or false") {
+		t.Errorf("expected the environment variable to be named, got %v", err)
+	}
+
+	layers.Env = nil
+	layers.Flags = configFlagValues(func(set func(string, string)) {
+		set("port", "70000")
+		set("width", "10")
+		set("terminal", "true") // Not a setting
+	})
+	_, _, err = layers.Resolve()
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 2 || configErr.Source != ConfigSourceFlag {
+		t.Fatalf("expected two invalid values from flags, got %v", err)
+	}
+}
+
+func TestLoadLauncherConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pathToConfig := filepath.Join(dir, LAUNCHER_CONFIG_FILE)
+
+	// Missing file
+	config, keys, err := loadLauncherConfigFile(pathToConfig)
+	if err != nil || len(keys) != 0 || config.Port != defaultPort {
+		t.Errorf("expected defaults for a missing file, got %+v %v (%v)", config, keys, err)
+	}
+
+	ioutil.WriteFile(pathToConfig, []byte(`{"port": 4000, "hotkeys": {"newTerminal": ""}, "addedInAFutureRelease": 1}`), 0600)
+	config, keys, err = loadLauncherConfigFile(pathToConfig)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if config.Port != 4000 || !keys["port"] || keys["windowWidth"] {
+		t.Errorf("expected port from the file, got %+v %v", config, keys)
+	}
+	if config.Hotkeys[HotkeyNewTerminal] != "" || config.Hotkeys[HotkeyCycleLayout] != defaultHotkeys[HotkeyCycleLayout] {
+		t.Errorf("expected disabled and default hotkeys, got %v", config.Hotkeys)
+	}
+
+	ioutil.WriteFile(pathToConfig, []byte(`{"port": "4000", "closeToTray": 1, "hotkeys": []}`), 0600)
+	_, _, err = loadLauncherConfigFile(pathToConfig)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 3 || configErr.Source != pathToConfig {
+		t.Fatalf("expected three problems in %s, got %v", pathToConfig, err)
+	}
+	if !strings.Contains(err.Error(), "port must be a whole number") {
+		t.Errorf("expected a helpful message, got %v", err)
+	}
+
+	ioutil.WriteFile(pathToConfig, []byte(`{"port": `), 0600)
+	if _, _, err = loadLauncherConfigFile(pathToConfig); !errors.As(err, &configErr) {
+		t.Errorf("expected invalid JSON to be reported, got %v", err)
+	}
+}
+
+func TestCopyHotReloadSettings(t *testing.T) {
+	running := DefaultLauncherConfig()
+	changed := DefaultLauncherConfig()
+	changed.Port = 4000
+	changed.CloseToTray = true
+
+	if running.copyHotReloadSettings(changed) {
+		t.Error("hotkeys did not change")
+	}
+	if running.Port != defaultPort || !running.CloseToTray {
+		t.Errorf("expected only closeToTray to change, got %+v", running)
+	}
+
+	changed.Hotkeys[HotkeyNewTerminal] = "Alt+N"
+	if !running.copyHotReloadSettings(changed) || running.Hotkeys[HotkeyNewTerminal] != "Alt+N" {
+		t.Errorf("expected hotkeys to change, got %v", running.Hotkeys)
+	}
+	changed.Hotkeys[HotkeyNewTerminal] = "Alt+M"
+	if running.Hotkeys[HotkeyNewTerminal] != "Alt+N" {
+		t.Error("hotkeys must be copied, not shared")
+	}
+
+	if err := running.SetJSON("closeToTray", json.RawMessage(`"yes"`)); err == nil {
+		t.Error("expected an error setting a bool to a string")
+	}
+	if err := running.SetJSON("hotkeys", json.RawMessage(`{}`)); !errors.Is(err, ErrUnknownConfigKey) {
+		t.Errorf("expected hotkeys to be set through their own bindings, got %v", err)
+	}
+}
+
+// Run with -race: the update scheduler reads the config from its own goroutine
+// while hot reloads change it on the UI thread
+func TestCurrentLauncherConfig(t *testing.T) {
+	withRpcLauncher(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			currentLauncherConfig()
+		}
+	}()
+	config := DefaultLauncherConfig()
+	for i := 0; i < 100; i++ {
+		config.UpdateCheckHours = i%defaultUpdateCheckHours + 1
+		applyLauncherConfig(config)
+	}
+	<-done
+	if hours := currentLauncherConfig().UpdateCheckHours; hours != 4 {
+		t.Errorf("expected the last reload to apply, got %d hours", hours)
+	}
+}
@@ -0,0 +1,5 @@
+package main
+
+// attachConsole() does nothing on Linux, where output always goes to the
+// terminal (if any) the launcher was started from
+func attachConsole() {}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+const ATTACH_PARENT_PROCESS = ^uintptr(0) // (DWORD)-1
+
+var (
+	kernel32          = windows.NewLazySystemDLL("kernel32.dll")
+	procAttachConsole = kernel32.NewProc("AttachConsole")
+)
+
+// attachConsole() sends output to the command prompt the launcher was run
+// from. The launcher is built as a GUI app (-H windowsgui) so that it doesn't
+// open a console window, which also means it doesn't get one by default.
+func attachConsole() {
+	// Output is already going somewhere, e.g. redirected to a file
+	if handle, err := windows.GetStdHandle(windows.STD_OUTPUT_HANDLE); err == nil && handle != 0 && handle != windows.InvalidHandle {
+		return
+	}
+	if r, _, _ := procAttachConsole.Call(ATTACH_PARENT_PROCESS); r == 0 {
+		return
+	}
+	if console, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0); err == nil {
+		os.Stdout = console
+		os.Stderr = console
+	}
+}
@@ -4,12 +4,13 @@ const ICON = "icon.ico"
 const LAUNCHER_WINDOW_TITLE = "ICARUS Terminal Launcher"
 const TERMINAL_WINDOW_TITLE = "ICARUS Terminal"
 const LPSZ_CLASS_NAME = "IcarusTerminalWindowClass"
-const SERVICE_EXECUTABLE = "ICARUS Service.exe"
-const TERMINAL_EXECUTABLE = "ICARUS Terminal.exe"
 const RELEASE_NOTES_URL = "https://github.com/acorrow/icarus/releases"
 const DEBUGGER = true
 
 const defaultLauncherWindowWidth = int32(900)
 const defaultLauncherWindowHeight = int32(500)
+const minLauncherWindowWidth = int32(640)
+const minLauncherWindowHeight = int32(400)
 const defaultWindowWidth = int32(1280)
 const defaultWindowHeight = int32(860)
+const defaultOverlayOpacity = 80
@@ -0,0 +1,4 @@
+package main
+
+const SERVICE_EXECUTABLE = "icarus-service"
+const TERMINAL_EXECUTABLE = "icarus-terminal"
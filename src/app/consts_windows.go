@@ -0,0 +1,4 @@
+package main
+
+const SERVICE_EXECUTABLE = "ICARUS Service.exe"
+const TERMINAL_EXECUTABLE = "ICARUS Terminal.exe"
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The control API lets other programs on this computer (e.g. VoiceAttack
+// scripts or stream deck software) do what the launcher's UI can, such as
+// opening terminals. It is served by the launcher's port (see proxy.go), only
+// to clients on this computer with the session's token.
+//
+// As the token changes each time the launcher starts, the launcher writes it
+// to CONTROL_FILE in the profile's directory for programs to read.
+const CONTROL_API_PATH = "/control/v1/"
+const CONTROL_FILE = "Control.json"
+
+// Largest request body accepted
+const maxControlBodySize = 64 * 1024
+
+// Time for the response to be sent before quitting
+const controlQuitDelay = 250 * time.Millisecond
+
+// How long other processes wait for the launcher to answer (see callControlApi)
+const controlClientTimeout = 10 * time.Second
+
+// The OpenAPI description of the control API, also served at
+// CONTROL_API_PATH + "openapi.json"
+//
+//go:embed control-api.json
+var controlApiSpec []byte
+
+var (
+	ErrNoSuchWindow       = errors.New("no such window")
+	ErrInvalidRequest     = errors.New("invalid request")
+	ErrWindowsUnsupported = errors.New("acting on terminal windows is not supported on " + runtime.GOOS)
+)
+
+// ControlWindow is a terminal window, identified by its process id
+type ControlWindow struct {
+	Id    int    `json:"id"`
+	Route string `json:"route"`
+}
+
+// ControlInfo is written to CONTROL_FILE while the launcher is running
+type ControlInfo struct {
+	Url   string `json:"url"`
+	Token string `json:"token"`
+	Pid   int    `json:"pid"`
+}
+
+// launcherController is what the control API can ask the launcher to do
+type launcherController interface {
+	Version() versionInfo
+	LatestRelease() (Release, error)
+	InstallUpdate(strategy string) error // Returns once the install has started
+	Windows() []ControlWindow
+	OpenWindow(options NewWindowOptions) (ControlWindow, error)
+	FocusWindow(id int) error
+	CloseWindow(id int) error
+	SetFullScreen(id int, mode windowSwitch) error
+	SetPinned(id int, mode windowSwitch) error
+	Quit()
+}
+
+// controlRoute is an operation in the API. {id} in a path is a window's id.
+type controlRoute struct {
+	Method string
+	Path   string // Relative to CONTROL_API_PATH
+	Status int    // Returned on success
+	Handle func(c launcherController, r *http.Request, id int) (interface{}, error)
+}
+
+var controlRoutes = []controlRoute{
+	{http.MethodGet, "openapi.json", http.StatusOK, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		return json.RawMessage(controlApiSpec), nil
+	}},
+	{http.MethodGet, "version", http.StatusOK, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		return c.Version(), nil
+	}},
+	{http.MethodGet, "update", http.StatusOK, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		return c.LatestRelease()
+	}},
+	{http.MethodPost, "update/install", http.StatusAccepted, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		var body struct {
+			Strategy string `json:"strategy"`
+		}
+		if err := decodeControlBody(r, &body); err != nil {
+			return nil, err
+		}
+		strategy, err := parseInstallStrategy(body.Strategy)
+		if err != nil {
+			return nil, err
+		}
+		release, err := c.LatestRelease()
+		if err != nil {
+			return nil, err
+		}
+		if !release.IsUpgrade {
+			return nil, fmt.Errorf("%w: %s is the latest release", ErrInvalidRequest, release.InstalledVersion)
+		}
+		return release, c.InstallUpdate(strategy)
+	}},
+	{http.MethodGet, "windows", http.StatusOK, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		return c.Windows(), nil
+	}},
+	{http.MethodPost, "windows", http.StatusCreated, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		options := NewWindowOptions{}
+		if err := decodeControlBody(r, &options); err != nil {
+			return nil, err
+		}
+		return c.OpenWindow(options)
+	}},
+	{http.MethodPost, "windows/{id}/focus", http.StatusNoContent, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		return nil, c.FocusWindow(id)
+	}},
+	{http.MethodPost, "windows/{id}/close", http.StatusAccepted, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		return nil, c.CloseWindow(id)
+	}},
+	{http.MethodPost, "windows/{id}/fullscreen", http.StatusAccepted, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		mode, err := decodeWindowSwitch(r)
+		if err != nil {
+			return nil, err
+		}
+		return nil, c.SetFullScreen(id, mode)
+	}},
+	{http.MethodPost, "windows/{id}/pin", http.StatusAccepted, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		mode, err := decodeWindowSwitch(r)
+		if err != nil {
+			return nil, err
+		}
+		return nil, c.SetPinned(id, mode)
+	}},
+	{http.MethodPost, "quit", http.StatusAccepted, func(c launcherController, r *http.Request, id int) (interface{}, error) {
+		time.AfterFunc(controlQuitDelay, c.Quit)
+		return nil, nil
+	}},
+}
+
+// decodeControlBody() allows an empty body, for requests where everything is
+// optional
+func decodeControlBody(r *http.Request, value interface{}) error {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxControlBodySize))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRequest, err.Error())
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, value); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRequest, err.Error())
+	}
+	return nil
+}
+
+// decodeWindowSwitch() reads {"enabled": true} or {"enabled": false}, or
+// toggles if enabled is left out
+func decodeWindowSwitch(r *http.Request) (windowSwitch, error) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := decodeControlBody(r, &body); err != nil {
+		return windowSwitchToggle, err
+	}
+	switch {
+	case body.Enabled == nil:
+		return windowSwitchToggle, nil
+	case *body.Enabled:
+		return windowSwitchOn, nil
+	default:
+		return windowSwitchOff, nil
+	}
+}
+
+// controlApi serves controlRoutes
+type controlApi struct {
+	controller launcherController
+}
+
+func (a controlApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isLoopbackAddress(r.RemoteAddr) {
+		sendControlError(w, http.StatusForbidden, errors.New("the control API can only be used from this computer"))
+		return
+	}
+	// Only the session's token, not those of paired devices
+	if authToken != "" && subtle.ConstantTimeCompare([]byte(requestToken(r)), []byte(authToken)) != 1 {
+		sendControlError(w, http.StatusUnauthorized, fmt.Errorf("not authorized (send the token in %s as a bearer token)", CONTROL_FILE))
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, CONTROL_API_PATH)
+	pathFound := false
+	for _, route := range controlRoutes {
+		id, ok := matchControlPath(route.Path, path)
+		if !ok {
+			continue
+		}
+		pathFound = true
+		if route.Method != r.Method {
+			continue
+		}
+		result, err := route.Handle(a.controller, r, id)
+		if err != nil {
+			sendControlError(w, controlErrorStatus(err), err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if result == nil {
+			w.WriteHeader(route.Status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(route.Status)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	if pathFound {
+		sendControlError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not supported for %s", r.Method, r.URL.Path))
+		return
+	}
+	sendControlError(w, http.StatusNotFound, fmt.Errorf("%s not found", r.URL.Path))
+}
+
+// matchControlPath() returns the window id from paths with one
+func matchControlPath(pattern string, path string) (int, bool) {
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+	if len(patternParts) != len(pathParts) {
+		return 0, false
+	}
+	id := 0
+	for i, part := range patternParts {
+		if part == "{id}" {
+			n, err := strconv.Atoi(pathParts[i])
+			if err != nil || n <= 0 {
+				return 0, false
+			}
+			id = n
+		} else if part != pathParts[i] {
+			return 0, false
+		}
+	}
+	return id, true
+}
+
+func controlErrorStatus(err error) int {
+	var configErr *ConfigError
+	switch {
+	case errors.Is(err, ErrNoSuchWindow):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidRequest), errors.As(err, &configErr):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrWindowsUnsupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, ErrUpdateChecksNotRunning), errors.Is(err, ErrUIThreadTimeout):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func sendControlError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// launcherControl is the running launcher, as the control API sees it
+type launcherControl struct{}
+
+func (launcherControl) Version() versionInfo {
+	return versionInfo{GetCurrentAppVersion(), runtime.GOOS, runtime.GOARCH, runtime.Version()}
+}
+
+func (launcherControl) LatestRelease() (Release, error) {
+	return GetLatestRelease()
+}
+
+// InstallUpdate() downloads the update in the background, as the launcher may
+// then quit for the installer, so callers hear how it went from update.progress
+// events
+func (launcherControl) InstallUpdate(strategy string) error {
+	if err := canStartUpdateInstall(); err != nil {
+		return err
+	}
+	go func() {
+		if err := InstallUpdate(strategy); err != nil {
+			fmt.Println("Unable to install update", err.Error())
+		}
+	}()
+	return nil
+}
+
+func (launcherControl) Windows() []ControlWindow {
+	terminals.Lock()
+	defer terminals.Unlock()
+	windows := []ControlWindow{}
+	for pid := range terminals.pids {
+		windows = append(windows, ControlWindow{pid, terminals.options[pid].Route})
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Id < windows[j].Id })
+	return windows
+}
+
+func (launcherControl) OpenWindow(options NewWindowOptions) (ControlWindow, error) {
+	var pid int
+	// On the UI thread, as checking the options reads launcherConfig
+	err := onUIThread(func() (err error) {
+		// Mistakes in the options are the caller's
+		if _, _, err := terminalArgs(options.flags()); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidRequest, err.Error())
+		}
+		pid, err = openTerminal(options.flags())
+		return err
+	})
+	return ControlWindow{pid, options.Route}, err
+}
+
+// onTerminalWindow() runs f on the UI thread for a terminal started by this
+// launcher, where f returns false if the terminal has no window
+func onTerminalWindow(id int, f func() bool) error {
+	terminals.Lock()
+	found := terminals.pids[id]
+	terminals.Unlock()
+	if !found {
+		return fmt.Errorf("%w: %d", ErrNoSuchWindow, id)
+	}
+	return onUIThread(func() error {
+		if !f() {
+			return fmt.Errorf("%w: %d has no window yet", ErrNoSuchWindow, id)
+		}
+		return nil
+	})
+}
+
+func (launcherControl) FocusWindow(id int) error {
+	if !canControlTerminalWindows {
+		return ErrWindowsUnsupported
+	}
+	return onTerminalWindow(id, func() bool { return focusTerminalWindow(id) })
+}
+
+func (launcherControl) CloseWindow(id int) error {
+	return onTerminalWindow(id, func() bool { return closeTerminalWindow(id) })
+}
+
+func (launcherControl) SetFullScreen(id int, mode windowSwitch) error {
+	if !canControlTerminalWindows {
+		return ErrWindowsUnsupported
+	}
+	return onTerminalWindow(id, func() bool { return setTerminalWindowFullScreen(id, mode) })
+}
+
+func (launcherControl) SetPinned(id int, mode windowSwitch) error {
+	if !canControlTerminalWindows {
+		return ErrWindowsUnsupported
+	}
+	return onTerminalWindow(id, func() bool { return setTerminalWindowPinned(id, mode) })
+}
+
+func (launcherControl) Quit() {
+	exitApplication(exitOK)
+}
+
+// Set once this process has written CONTROL_FILE, so that only the launcher
+// removes it, not terminals or CLI commands exiting
+var writtenControlFile string
+
+func controlFilePath() (string, error) {
+	dir, err := profileDir(activeProfile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, CONTROL_FILE), nil
+}
+
+// writeControlFile() tells other programs how to use the control API, until
+// removeControlFile() is called when the launcher exits
+func writeControlFile() error {
+	pathToFile, err := controlFilePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ControlInfo{
+		Url:   fmt.Sprintf("http://127.0.0.1:%d%s", port, CONTROL_API_PATH),
+		Token: authToken,
+		Pid:   os.Getpid(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(pathToFile), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(pathToFile, data, 0600); err != nil {
+		return err
+	}
+	writtenControlFile = pathToFile
+	return nil
+}
+
+func removeControlFile() {
+	if writtenControlFile != "" {
+		os.Remove(writtenControlFile)
+	}
+}
+
+// callControlApi() makes a request to the running launcher's control API, as
+// other programs do, from what it wrote to CONTROL_FILE. What the launcher
+// returns is decoded into result, if it isn't nil. It returns
+// ErrNoRunningInstance if the launcher isn't running.
+func callControlApi(method string, path string, body interface{}, result interface{}) error {
+	pathToFile, err := controlFilePath()
+	if err != nil {
+		return err
+	}
+	var info ControlInfo
+	if data, err := ioutil.ReadFile(pathToFile); err != nil {
+		return ErrNoRunningInstance
+	} else if err := json.Unmarshal(data, &info); err != nil {
+		return fmt.Errorf("%s is not valid JSON: %w", CONTROL_FILE, err)
+	}
+
+	encoded := []byte{}
+	if body != nil {
+		if encoded, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	request, err := http.NewRequest(method, info.Url+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+info.Token)
+	request.Header.Set("Content-Type", "application/json")
+	response, err := (&http.Client{Timeout: controlClientTimeout}).Do(request)
+	if err != nil {
+		// Left behind by a launcher that crashed
+		return ErrNoRunningInstance
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		var failed struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(response.Body).Decode(&failed)
+		switch response.StatusCode {
+		case http.StatusBadRequest:
+			return fmt.Errorf("%w: %s", ErrInvalidRequest, failed.Error)
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %s", ErrNoSuchWindow, failed.Error)
+		}
+		return fmt.Errorf("the launcher couldn't %s %s: %s", method, path, failed.Error)
+	}
+	if result == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeController records what the control API asked it to do
+type fakeController struct {
+	windows  []ControlWindow
+	release  Release
+	actions  []string
+	switches []windowSwitch
+}
+
+func (c *fakeController) Version() versionInfo {
+	return versionInfo{Version: "1.2.3"}
+}
+
+func (c *fakeController) LatestRelease() (Release, error) {
+	return c.release, nil
+}
+
+func (c *fakeController) InstallUpdate(strategy string) error {
+	c.actions = append(c.actions, "install "+strategy)
+	return nil
+}
+
+func (c *fakeController) Windows() []ControlWindow {
+	return c.windows
+}
+
+func (c *fakeController) OpenWindow(options NewWindowOptions) (ControlWindow, error) {
+	if options.Width < 0 {
+		return ControlWindow{}, fmt.Errorf("%w: width can't be negative", ErrInvalidRequest)
+	}
+	window := ControlWindow{len(c.windows) + 100, options.Route}
+	c.windows = append(c.windows, window)
+	return window, nil
+}
+
+func (c *fakeController) act(action string, id int) error {
+	for _, window := range c.windows {
+		if window.Id == id {
+			c.actions = append(c.actions, fmt.Sprintf("%s %d", action, id))
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrNoSuchWindow, id)
+}
+
+func (c *fakeController) FocusWindow(id int) error {
+	return c.act("focus", id)
+}
+
+func (c *fakeController) CloseWindow(id int) error {
+	return c.act("close", id)
+}
+
+func (c *fakeController) SetFullScreen(id int, mode windowSwitch) error {
+	c.switches = append(c.switches, mode)
+	return c.act("fullscreen", id)
+}
+
+func (c *fakeController) SetPinned(id int, mode windowSwitch) error {
+	return ErrWindowsUnsupported
+}
+
+func (c *fakeController) Quit() {}
+
+func controlRequest(api http.Handler, method string, path string, body string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, CONTROL_API_PATH+path, strings.NewReader(body))
+	request.RemoteAddr = "127.0.0.1:50000"
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response := httptest.NewRecorder()
+	api.ServeHTTP(response, request)
+	return response
+}
+
+func TestControlApiAccess(t *testing.T) {
+	withSession(t)
+	api := controlApi{&fakeController{}}
+
+	if response := controlRequest(api, http.MethodGet, "version", "", ""); response.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", response.Code)
+	}
+	if response := controlRequest(api, http.MethodGet, "version", "", "device-token"); response.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with another token, got %d", response.Code)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, CONTROL_API_PATH+"version", nil)
+	request.RemoteAddr = "192.168.1.20:50000"
+	request.Header.Set("Authorization", "Bearer secret")
+	response := httptest.NewRecorder()
+	api.ServeHTTP(response, request)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("expected 403 from another computer, got %d", response.Code)
+	}
+
+	response = controlRequest(api, http.MethodGet, "version", "", "secret")
+	var version versionInfo
+	if response.Code != http.StatusOK || json.Unmarshal(response.Body.Bytes(), &version) != nil || version.Version != "1.2.3" {
+		t.Errorf("expected the version, got %d %s", response.Code, response.Body.String())
+	}
+	if response := controlRequest(api, http.MethodDelete, "version", "", "secret"); response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for an unsupported method, got %d", response.Code)
+	}
+	if response := controlRequest(api, http.MethodGet, "nothing", "", "secret"); response.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown path, got %d", response.Code)
+	}
+}
+
+func TestControlApiWindows(t *testing.T) {
+	withSession(t)
+	controller := &fakeController{}
+	api := controlApi{controller}
+
+	response := controlRequest(api, http.MethodPost, "windows", `{"route": "/nav/map"}`, "secret")
+	var window ControlWindow
+	if response.Code != http.StatusCreated || json.Unmarshal(response.Body.Bytes(), &window) != nil || window.Route != "/nav/map" {
+		t.Fatalf("expected a window to be opened, got %d %s", response.Code, response.Body.String())
+	}
+	if response := controlRequest(api, http.MethodPost, "windows", "", "secret"); response.Code != http.StatusCreated {
+		t.Errorf("expected a window with the defaults to be opened, got %d", response.Code)
+	}
+	if response := controlRequest(api, http.MethodPost, "windows", `{"width": -1}`, "secret"); response.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid options, got %d", response.Code)
+	}
+	if response := controlRequest(api, http.MethodPost, "windows", `{"width": "wide"}`, "secret"); response.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for malformed JSON, got %d", response.Code)
+	}
+
+	response = controlRequest(api, http.MethodGet, "windows", "", "secret")
+	var windows []ControlWindow
+	if response.Code != http.StatusOK || json.Unmarshal(response.Body.Bytes(), &windows) != nil || len(windows) != 2 {
+		t.Errorf("expected 2 windows, got %d %s", response.Code, response.Body.String())
+	}
+
+	id := fmt.Sprint(window.Id)
+	if response := controlRequest(api, http.MethodPost, "windows/"+id+"/focus", "", "secret"); response.Code != http.StatusNoContent {
+		t.Errorf("expected focus to succeed, got %d", response.Code)
+	}
+	if response := controlRequest(api, http.MethodPost, "windows/"+id+"/close", "", "secret"); response.Code != http.StatusAccepted {
+		t.Errorf("expected close to succeed, got %d", response.Code)
+	}
+	if response := controlRequest(api, http.MethodPost, "windows/999/close", "", "secret"); response.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown window, got %d", response.Code)
+	}
+	if response := controlRequest(api, http.MethodPost, "windows/abc/close", "", "secret"); response.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a malformed window id, got %d", response.Code)
+	}
+	if response := controlRequest(api, http.MethodPost, "windows/"+id+"/pin", "", "secret"); response.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 where windows can't be pinned, got %d", response.Code)
+	}
+
+	for _, body := range []string{"", `{"enabled": true}`, `{"enabled": false}`} {
+		if response := controlRequest(api, http.MethodPost, "windows/"+id+"/fullscreen", body, "secret"); response.Code != http.StatusAccepted {
+			t.Errorf("expected full screen to be set for %q, got %d", body, response.Code)
+		}
+	}
+	expected := []windowSwitch{windowSwitchToggle, windowSwitchOn, windowSwitchOff}
+	if fmt.Sprint(controller.switches) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, controller.switches)
+	}
+	if fmt.Sprint(controller.actions[:2]) != fmt.Sprintf("[focus %s close %s]", id, id) {
+		t.Errorf("unexpected actions %v", controller.actions)
+	}
+}
+
+func TestControlApiUpdate(t *testing.T) {
+	withSession(t)
+	controller := &fakeController{release: Release{InstalledVersion: "1.2.3", ProductVersion: "1.2.3"}}
+	api := controlApi{controller}
+
+	if response := controlRequest(api, http.MethodGet, "update", "", "secret"); response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"isUpgrade":false`) {
+		t.Errorf("expected the latest release, got %d %s", response.Code, response.Body.String())
+	}
+	if response := controlRequest(api, http.MethodPost, "update/install", "", "secret"); response.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a newer release, got %d", response.Code)
+	}
+	controller.release = Release{InstalledVersion: "1.2.3", ProductVersion: "1.3.0", IsUpgrade: true}
+	if response := controlRequest(api, http.MethodPost, "update/install", "", "secret"); response.Code != http.StatusAccepted {
+		t.Errorf("expected the update to be installed, got %d", response.Code)
+	}
+	if response := controlRequest(api, http.MethodPost, "update/install", `{"strategy": "silent"}`, "secret"); response.Code != http.StatusAccepted {
+		t.Errorf("expected the update to be installed silently, got %d", response.Code)
+	}
+	if response := controlRequest(api, http.MethodPost, "update/install", `{"strategy": "later"}`, "secret"); response.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown strategy, got %d", response.Code)
+	}
+	if strings.Join(controller.actions, ", ") != "install now, install silent" {
+		t.Errorf("unexpected installs %v", controller.actions)
+	}
+}
+
+func TestCallControlApi(t *testing.T) {
+	withRpcLauncher(t)
+	authToken = "secret"
+	var window ControlWindow
+	if err := callControlApi(http.MethodPost, "windows", NewWindowOptions{}, &window); !errors.Is(err, ErrNoRunningInstance) {
+		t.Errorf("expected no launcher without a control file, got %v", err)
+	}
+
+	controller := &fakeController{}
+	server := httptest.NewServer(controlApi{controller})
+	defer server.Close()
+	pathToFile, _ := controlFilePath()
+	os.MkdirAll(filepath.Dir(pathToFile), 0700)
+	data, _ := json.Marshal(ControlInfo{Url: server.URL + CONTROL_API_PATH, Token: "secret"})
+	if err := ioutil.WriteFile(pathToFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := callControlApi(http.MethodPost, "windows", NewWindowOptions{Route: "/nav/map"}, &window); err != nil || window.Route != "/nav/map" || len(controller.windows) != 1 {
+		t.Errorf("expected the launcher to open the window, got %+v %v", window, err)
+	}
+	if err := callControlApi(http.MethodPost, "windows", NewWindowOptions{Width: -1}, &window); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected the launcher's error, got %v", err)
+	}
+	if err := callControlApi(http.MethodPost, "windows/99/focus", nil, nil); !errors.Is(err, ErrNoSuchWindow) {
+		t.Errorf("expected no such window, got %v", err)
+	}
+
+	// Left behind by a launcher that has stopped
+	server.Close()
+	if err := callControlApi(http.MethodPost, "windows", NewWindowOptions{}, &window); !errors.Is(err, ErrNoRunningInstance) {
+		t.Errorf("expected no launcher once it stops, got %v", err)
+	}
+}
+
+func TestControlApiDescription(t *testing.T) {
+	withSession(t)
+	response := controlRequest(controlApi{&fakeController{}}, http.MethodGet, "openapi.json", "", "secret")
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("expected the OpenAPI description, got %v", err)
+	}
+	for _, route := range controlRoutes {
+		if _, ok := spec.Paths["/"+route.Path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%s %s is not in control-api.json", route.Method, route.Path)
+		}
+	}
+}
+
+func TestServiceProxyControlApi(t *testing.T) {
+	withSession(t)
+	proxy := newServiceProxy(nil, nil)
+	proxy.control = controlApi{&fakeController{}}
+
+	request := httptest.NewRequest(http.MethodGet, CONTROL_API_PATH+"version", nil)
+	request.RemoteAddr = "127.0.0.1:50000"
+	response := httptest.NewRecorder()
+	proxy.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized || !strings.Contains(response.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("expected the control API to answer without the service, got %d %s", response.Code, response.Body.String())
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// The launcher pushes events to the UI rather than the UI polling for them.
+// Each event has a type and a payload; the types, what their payloads hold and
+// whether they reach remote clients are listed in launcherEventTypes and in
+// src/client/lib/launcher-events.json, which the client uses (see
+// src/client/lib/window.js) and a test keeps in step with this file.
+//
+// Each process has its own bus. Webviews subscribe to the types they want over
+// RPC (events.subscribe) and get them as a DOM event, LAUNCHER_EVENT_DOM_EVENT.
+// The launcher also forwards remote events to the service, which relays them
+// to clients that subscribed over the socket, including terminals (which are
+// separate processes) and devices on the LAN.
+const LAUNCHER_EVENT_DOM_EVENT = "icarusTerminalEvent"
+
+const (
+	EventWindowStateChanged = "window.stateChanged"
+	EventServiceStatus      = "service.statusChanged"
+	EventUpdateProgress     = "update.progress"
+	EventTerminalsChanged   = "terminals.changed"
+	launcherEventsPath      = "/api/launcher-events"
+	maxQueuedLauncherEvents = 64
+)
+
+// LauncherEvent is what subscribers get. Ids count up from 1 in each process;
+// Source (the process id) tells apart events from different processes, so the
+// launcher's window can ignore the copy of an event it also gets from the
+// service.
+type LauncherEvent struct {
+	Source  int         `json:"source"`
+	Id      int64       `json:"id"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+}
+
+// launcherEventType is what an event type's payload is (the zero value of its
+// struct), and whether it is forwarded to the service
+type launcherEventType struct {
+	Payload interface{}
+	Remote  bool
+}
+
+type (
+	serviceStatusPayload struct {
+		Status string `json:"status"` // starting, running, restarting, stopped or failed
+	}
+	updateProgressPayload struct {
+		Stage   string `json:"stage"` // checking, upToDate, available, downloading, ready, installing or failed
+		Version string `json:"version"`
+		Percent int    `json:"percent"`
+		Error   string `json:"error"`
+	}
+	terminalsPayload struct {
+		Windows []ControlWindow `json:"windows"`
+	}
+)
+
+var launcherEventTypes = map[string]launcherEventType{
+	// Only to the window itself, as each terminal is its own process
+	EventWindowStateChanged: {Payload: windowStateInfo{}},
+	EventServiceStatus:      {Payload: serviceStatusPayload{}, Remote: true},
+	EventUpdateProgress:     {Payload: updateProgressPayload{}, Remote: true},
+	EventTerminalsChanged:   {Payload: terminalsPayload{}, Remote: true},
+}
+
+var ErrUnknownEventType = fmt.Errorf("unknown event type")
+
+// eventBus delivers events to subscribers for the types they subscribed to.
+// Delivery happens on the publisher's goroutine, so subscribers must not
+// block (webviews hand events to their UI thread).
+type eventBus struct {
+	mutex         sync.Mutex
+	lastId        int64
+	subscriptions map[*eventSubscription]bool
+}
+
+type eventSubscription struct {
+	bus     *eventBus
+	types   map[string]bool
+	deliver func(LauncherEvent)
+}
+
+var launcherEvents = newEventBus()
+
+func newEventBus() *eventBus {
+	return &eventBus{subscriptions: map[*eventSubscription]bool{}}
+}
+
+// Subscribe() starts delivering the given types, which can be changed later
+// with SetTypes()
+func (b *eventBus) Subscribe(types []string, deliver func(LauncherEvent)) (*eventSubscription, error) {
+	subscription := &eventSubscription{bus: b, deliver: deliver}
+	if _, err := subscription.SetTypes(types); err != nil {
+		return nil, err
+	}
+	b.mutex.Lock()
+	b.subscriptions[subscription] = true
+	b.mutex.Unlock()
+	return subscription, nil
+}
+
+// Publish() sends an event to everything subscribed to its type. The payload
+// must be the type's payload struct; anything else is a mistake in the
+// launcher, so it is not sent.
+func (b *eventBus) Publish(eventType string, payload interface{}) {
+	registered, ok := launcherEventTypes[eventType]
+	if !ok || reflect.TypeOf(payload) != reflect.TypeOf(registered.Payload) {
+		fmt.Println("Not publishing event with unexpected payload", eventType, reflect.TypeOf(payload))
+		return
+	}
+	b.mutex.Lock()
+	b.lastId++
+	event := LauncherEvent{Source: os.Getpid(), Id: b.lastId, Type: eventType, Payload: payload}
+	subscribers := []func(LauncherEvent){}
+	for subscription := range b.subscriptions {
+		if subscription.types[eventType] {
+			subscribers = append(subscribers, subscription.deliver)
+		}
+	}
+	b.mutex.Unlock()
+
+	for _, deliver := range subscribers {
+		deliver(event)
+	}
+}
+
+// SetTypes() replaces the types subscribed to, returning them sorted
+func (s *eventSubscription) SetTypes(types []string) ([]string, error) {
+	subscribed := map[string]bool{}
+	for _, eventType := range types {
+		if _, ok := launcherEventTypes[eventType]; !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownEventType, eventType)
+		}
+		subscribed[eventType] = true
+	}
+	s.bus.mutex.Lock()
+	s.types = subscribed
+	s.bus.mutex.Unlock()
+	return s.Types(), nil
+}
+
+func (s *eventSubscription) Types() []string {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+	types := []string{}
+	for eventType := range s.types {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Close() stops delivery, e.g. before the webview it delivers to is destroyed
+func (s *eventSubscription) Close() {
+	s.bus.mutex.Lock()
+	delete(s.bus.subscriptions, s)
+	s.bus.mutex.Unlock()
+}
+
+func remoteEventTypes() []string {
+	types := []string{}
+	for eventType, registered := range launcherEventTypes {
+		if registered.Remote {
+			types = append(types, eventType)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// launcherEventScript() is the script that dispatches an event in a webview
+func launcherEventScript(event LauncherEvent) (string, error) {
+	detail, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("window.dispatchEvent(new CustomEvent(%q, {detail: %s}))", LAUNCHER_EVENT_DOM_EVENT, detail), nil
+}
+
+// forwardEventsToService() sends remote events to the service (see
+// src/service/lib/launcher-events.js), in order, from a goroutine of its own
+// so publishers don't wait on it. Events are dropped while the service can't
+// be reached, as clients reconnecting to it ask for the current state anyway.
+func forwardEventsToService() {
+	queue := make(chan LauncherEvent, maxQueuedLauncherEvents)
+	launcherEvents.Subscribe(remoteEventTypes(), func(event LauncherEvent) {
+		select {
+		case queue <- event:
+		default:
+			fmt.Println("Dropping event for the service, too many queued", event.Type)
+		}
+	})
+	go func() {
+		for event := range queue {
+			serviceRequest(http.MethodPost, launcherEventsPath, event, nil)
+		}
+	}()
+}
+
+// terminalsChanged() publishes the terminals that are open now
+func terminalsChanged() {
+	launcherEvents.Publish(EventTerminalsChanged, terminalsPayload{launcherControl{}.Windows()})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The client's copy of launcherEventTypes (see events.go)
+const launcherEventsSchemaFile = "../client/lib/launcher-events.json"
+
+func TestEventBus(t *testing.T) {
+	bus := newEventBus()
+	got := []LauncherEvent{}
+	subscription, err := bus.Subscribe([]string{EventServiceStatus}, func(event LauncherEvent) {
+		got = append(got, event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Publish(EventServiceStatus, serviceStatusPayload{"running"})
+	bus.Publish(EventTerminalsChanged, terminalsPayload{})
+	bus.Publish(EventServiceStatus, "stopped") // Not the payload struct
+	bus.Publish(EventServiceStatus, serviceStatusPayload{"restarting"})
+	if len(got) != 2 || got[0].Payload != (serviceStatusPayload{"running"}) || got[1].Payload != (serviceStatusPayload{"restarting"}) {
+		t.Fatalf("unexpected events %+v", got)
+	}
+	if got[0].Source != os.Getpid() || got[1].Id <= got[0].Id {
+		t.Errorf("expected ids to count up, got %+v", got)
+	}
+
+	if _, err := subscription.SetTypes([]string{"service.exploded"}); err == nil {
+		t.Errorf("expected an unknown type to be refused")
+	}
+	subscription.Close()
+	bus.Publish(EventServiceStatus, serviceStatusPayload{"running"})
+	if len(got) != 2 {
+		t.Errorf("expected no events after closing, got %+v", got)
+	}
+}
+
+func TestLauncherEventScript(t *testing.T) {
+	script, err := launcherEventScript(LauncherEvent{Source: 1, Id: 2, Type: EventServiceStatus, Payload: serviceStatusPayload{"running"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `window.dispatchEvent(new CustomEvent("icarusTerminalEvent", {detail: {"source":1,"id":2,"type":"service.statusChanged","payload":{"status":"running"}}}))`
+	if script != expected {
+		t.Errorf("unexpected script %s", script)
+	}
+}
+
+// The client relies on the schema to know what each event's payload holds
+func TestLauncherEventSchema(t *testing.T) {
+	data, err := ioutil.ReadFile(launcherEventsSchemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		DomEvent string `json:"domEvent"`
+		Events   map[string]struct {
+			Remote  bool              `json:"remote"`
+			Payload map[string]string `json:"payload"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema.DomEvent != LAUNCHER_EVENT_DOM_EVENT || len(schema.Events) != len(launcherEventTypes) {
+		t.Errorf("%s doesn't match launcherEventTypes", launcherEventsSchemaFile)
+	}
+
+	kinds := map[reflect.Kind]string{reflect.Bool: "boolean", reflect.Int: "number", reflect.String: "string", reflect.Slice: "array"}
+	for name, registered := range launcherEventTypes {
+		described, ok := schema.Events[name]
+		if !ok {
+			t.Errorf("%s is missing from %s", name, launcherEventsSchemaFile)
+			continue
+		}
+		if described.Remote != registered.Remote {
+			t.Errorf("%s: remote is %v, expected %v", name, described.Remote, registered.Remote)
+		}
+		payload := map[string]string{}
+		payloadType := reflect.TypeOf(registered.Payload)
+		for i := 0; i < payloadType.NumField(); i++ {
+			field := payloadType.Field(i)
+			payload[strings.Split(field.Tag.Get("json"), ",")[0]] = kinds[field.Type.Kind()]
+		}
+		if !reflect.DeepEqual(described.Payload, payload) {
+			t.Errorf("%s: payload is %v, expected %v", name, described.Payload, payload)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// runUnelevated() opens URLs with the desktop's default handler and starts
+// anything else directly, as processes already run as the current user.
+func runUnelevated(pathToExecutable string) {
+	if strings.Contains(pathToExecutable, "://") {
+		exec.Command("xdg-open", pathToExecutable).Start()
+		return
+	}
+	exec.Command(pathToExecutable).Start()
+}
+
+// runElevated() uses polkit to prompt for permission, the closest equivalent
+// to the UAC prompt on Windows
+func runElevated(pathToExecutable string, args ...string) {
+	exec.Command("pkexec", append([]string{pathToExecutable}, args...)...).Start()
+}
@@ -6,6 +6,7 @@ import (
 	"golang.org/x/sys/windows"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 func runUnelevated(pathToExecutable string) {
@@ -20,12 +21,12 @@ func runUnelevated(pathToExecutable string) {
 	cmdInstance.Start()
 }
 
-func runElevated(pathToExecutable string) {
+func runElevated(pathToExecutable string, args ...string) {
 	cwd, _ := os.Getwd()
 	verbPtr, _ := syscall.UTF16PtrFromString("runas")
 	exePtr, _ := syscall.UTF16PtrFromString(pathToExecutable)
 	cwdPtr, _ := syscall.UTF16PtrFromString(cwd)
-	argPtr, _ := syscall.UTF16PtrFromString("")
+	argPtr, _ := syscall.UTF16PtrFromString(strings.Join(args, " "))
 	windows.ShellExecute(0, verbPtr, exePtr, argPtr, cwdPtr, int32(1))
 }
 
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HotkeyAction identifies something the launcher can do in response to a
+// global hotkey. The values are used as keys in the launcher config file.
+type HotkeyAction string
+
+const (
+	HotkeyToggleTerminals HotkeyAction = "toggleTerminals" // Show or hide all terminal windows
+	HotkeyToggleOverlay   HotkeyAction = "toggleOverlay"   // Toggle overlay mode on all terminal windows
+	HotkeyCycleLayout     HotkeyAction = "cycleLayout"     // Arrange terminal windows using the next layout
+	HotkeyNewTerminal     HotkeyAction = "newTerminal"     // Open a new terminal window
+
+	// Let the mouse through overlay terminals, or stop it. Once a window
+	// ignores the mouse there is no other way to interact with it, so
+	// terminals refuse to ignore it without this hotkey.
+	HotkeyToggleClickThrough HotkeyAction = "toggleClickThrough"
+)
+
+// An empty chord in the config file disables the hotkey for that action
+var defaultHotkeys = map[HotkeyAction]string{
+	HotkeyToggleTerminals:    "Ctrl+Shift+F9",
+	HotkeyToggleOverlay:      "Ctrl+Shift+F10",
+	HotkeyCycleLayout:        "Ctrl+Shift+F11",
+	HotkeyNewTerminal:        "Ctrl+Shift+F8",
+	HotkeyToggleClickThrough: "Ctrl+Shift+F12",
+}
+
+// Modifier keys, independent of how a platform represents them
+const (
+	ModAlt = 1 << iota
+	ModCtrl
+	ModShift
+	ModSuper
+)
+
+var modifierNames = map[string]uint32{
+	"ALT":     ModAlt,
+	"CTRL":    ModCtrl,
+	"CONTROL": ModCtrl,
+	"SHIFT":   ModShift,
+	"WIN":     ModSuper,
+	"SUPER":   ModSuper,
+}
+
+// Keys that can be used in a chord, other than A-Z, 0-9 and F1-F24
+var namedKeys = map[string]string{
+	"SPACE":       "Space",
+	"INSERT":      "Insert",
+	"DELETE":      "Delete",
+	"HOME":        "Home",
+	"END":         "End",
+	"PAGEUP":      "PageUp",
+	"PAGEDOWN":    "PageDown",
+	"UP":          "Up",
+	"DOWN":        "Down",
+	"LEFT":        "Left",
+	"RIGHT":       "Right",
+	"PAUSE":       "Pause",
+	"SCROLLLOCK":  "ScrollLock",
+	"NUMPAD0":     "Numpad0",
+	"NUMPAD1":     "Numpad1",
+	"NUMPAD2":     "Numpad2",
+	"NUMPAD3":     "Numpad3",
+	"NUMPAD4":     "Numpad4",
+	"NUMPAD5":     "Numpad5",
+	"NUMPAD6":     "Numpad6",
+	"NUMPAD7":     "Numpad7",
+	"NUMPAD8":     "Numpad8",
+	"NUMPAD9":     "Numpad9",
+	"NUMPADPLUS":  "NumpadPlus",
+	"NUMPADMINUS": "NumpadMinus",
+}
+
+var ErrHotkeyInUse = errors.New("hotkey is already in use")
+var ErrHotkeysUnsupported = errors.New("global hotkeys are not supported on this platform")
+var ErrNoClickThroughHotkey = errors.New("the launcher doesn't have the " + string(HotkeyToggleClickThrough) + " hotkey to undo click-through")
+
+// KeyChord is a parsed hotkey such as "Ctrl+Shift+F10". Key is the canonical
+// name of the (non-modifier) key, e.g. "F10", "A" or "PageUp".
+type KeyChord struct {
+	Modifiers uint32
+	Key       string
+}
+
+func ParseKeyChord(chord string) (KeyChord, error) {
+	parsed := KeyChord{}
+	parts := strings.Split(chord, "+")
+	for i, part := range parts {
+		name := strings.ToUpper(strings.TrimSpace(part))
+		if name == "" {
+			return KeyChord{}, fmt.Errorf("invalid hotkey %q", chord)
+		}
+
+		if modifier, ok := modifierNames[name]; ok && i < len(parts)-1 {
+			parsed.Modifiers |= modifier
+			continue
+		}
+
+		if i < len(parts)-1 {
+			return KeyChord{}, fmt.Errorf("invalid hotkey %q: %q is not a modifier", chord, part)
+		}
+
+		key, ok := canonicalKeyName(name)
+		if !ok {
+			return KeyChord{}, fmt.Errorf("invalid hotkey %q: unknown key %q", chord, part)
+		}
+		parsed.Key = key
+	}
+
+	// Global hotkeys without a modifier would take the key away from the game
+	if parsed.Modifiers == 0 {
+		return KeyChord{}, fmt.Errorf("invalid hotkey %q: a modifier key is required", chord)
+	}
+
+	return parsed, nil
+}
+
+func canonicalKeyName(name string) (string, bool) {
+	if len(name) == 1 && ((name[0] >= 'A' && name[0] <= 'Z') || (name[0] >= '0' && name[0] <= '9')) {
+		return name, true
+	}
+	if n, ok := functionKeyNumber(name); ok {
+		return fmt.Sprintf("F%d", n), true
+	}
+	key, ok := namedKeys[name]
+	return key, ok
+}
+
+// functionKeyNumber returns 10 for "F10" (and so on for F1-F24)
+func functionKeyNumber(key string) (int, bool) {
+	var n int
+	if _, err := fmt.Sscanf(strings.ToUpper(key), "F%d", &n); err != nil || fmt.Sprintf("F%d", n) != strings.ToUpper(key) {
+		return 0, false
+	}
+	return n, n >= 1 && n <= 24
+}
+
+func (c KeyChord) String() string {
+	parts := []string{}
+	if c.Modifiers&ModCtrl != 0 {
+		parts = append(parts, "Ctrl")
+	}
+	if c.Modifiers&ModAlt != 0 {
+		parts = append(parts, "Alt")
+	}
+	if c.Modifiers&ModShift != 0 {
+		parts = append(parts, "Shift")
+	}
+	if c.Modifiers&ModSuper != 0 {
+		parts = append(parts, "Win")
+	}
+	return strings.Join(append(parts, c.Key), "+")
+}
+
+// HotkeyBackend registers chords with the OS. Each platform provides its own
+// implementation; platforms without global hotkeys return ErrHotkeysUnsupported.
+type HotkeyBackend interface {
+	Register(id int, chord KeyChord) error
+	Unregister(id int)
+}
+
+// HotkeyStatus is reported to the UI so it can show which chords are active
+// and explain any that could not be registered.
+type HotkeyStatus struct {
+	Action     HotkeyAction `json:"action"`
+	Chord      string       `json:"chord"`
+	Registered bool         `json:"registered"`
+	Error      string       `json:"error,omitempty"`
+}
+
+type HotkeyManager struct {
+	backend  HotkeyBackend
+	handlers map[HotkeyAction]func()
+	ids      map[int]HotkeyAction
+	status   map[HotkeyAction]HotkeyStatus
+}
+
+func NewHotkeyManager(backend HotkeyBackend, handlers map[HotkeyAction]func()) *HotkeyManager {
+	return &HotkeyManager{
+		backend:  backend,
+		handlers: handlers,
+		ids:      map[int]HotkeyAction{},
+		status:   map[HotkeyAction]HotkeyStatus{},
+	}
+}
+
+// Apply replaces all registered hotkeys with those in bindings (action to
+// chord). Problems with individual hotkeys - invalid chords, two actions using
+// the same chord or chords already taken by another application - are recorded
+// in the returned status rather than stopping other hotkeys being registered.
+func (m *HotkeyManager) Apply(bindings map[HotkeyAction]string) []HotkeyStatus {
+	for id := range m.ids {
+		m.backend.Unregister(id)
+	}
+	m.ids = map[int]HotkeyAction{}
+	m.status = map[HotkeyAction]HotkeyStatus{}
+
+	// Sort so that ids and conflict reporting are stable between runs
+	actions := []string{}
+	for action := range bindings {
+		actions = append(actions, string(action))
+	}
+	sort.Strings(actions)
+
+	usedBy := map[KeyChord]HotkeyAction{}
+	for i, name := range actions {
+		action := HotkeyAction(name)
+		status := HotkeyStatus{Action: action, Chord: bindings[action]}
+
+		if _, ok := m.handlers[action]; !ok {
+			status.Error = "unknown action"
+			m.status[action] = status
+			continue
+		}
+
+		if strings.TrimSpace(bindings[action]) == "" {
+			m.status[action] = status
+			continue
+		}
+
+		chord, err := ParseKeyChord(bindings[action])
+		if err != nil {
+			status.Error = err.Error()
+			m.status[action] = status
+			continue
+		}
+		status.Chord = chord.String()
+
+		if other, ok := usedBy[chord]; ok {
+			status.Error = fmt.Sprintf("%s: also assigned to %s", ErrHotkeyInUse, other)
+			m.status[action] = status
+			continue
+		}
+
+		id := i + 1
+		if err := m.backend.Register(id, chord); err != nil {
+			status.Error = err.Error()
+			m.status[action] = status
+			continue
+		}
+
+		usedBy[chord] = action
+		m.ids[id] = action
+		status.Registered = true
+		m.status[action] = status
+	}
+
+	return m.Status()
+}
+
+func (m *HotkeyManager) Status() []HotkeyStatus {
+	status := []HotkeyStatus{}
+	for _, s := range m.status {
+		status = append(status, s)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Action < status[j].Action })
+	return status
+}
+
+// Registered is whether action's hotkey is registered
+func (m *HotkeyManager) Registered(action HotkeyAction) bool {
+	return m.status[action].Registered
+}
+
+// Trigger runs the action registered with the given id, returning false if
+// the id is not one of ours.
+func (m *HotkeyManager) Trigger(id int) bool {
+	action, ok := m.ids[id]
+	if !ok {
+		return false
+	}
+	if handler := m.handlers[action]; handler != nil {
+		handler()
+	}
+	return true
+}
+
+func (m *HotkeyManager) Close() {
+	for id := range m.ids {
+		m.backend.Unregister(id)
+	}
+	m.ids = map[int]HotkeyAction{}
+}
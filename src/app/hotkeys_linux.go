@@ -0,0 +1,11 @@
+package main
+
+// Global hotkeys are only implemented on Windows so far; HotkeyManager reports
+// every hotkey as unsupported rather than failing to start.
+type unsupportedHotkeyBackend struct{}
+
+func (unsupportedHotkeyBackend) Register(id int, chord KeyChord) error {
+	return ErrHotkeysUnsupported
+}
+
+func (unsupportedHotkeyBackend) Unregister(id int) {}
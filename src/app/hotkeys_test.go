@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKeyChord(t *testing.T) {
+	tests := []struct {
+		chord    string
+		expected string
+		valid    bool
+	}{
+		{"Ctrl+Shift+F10", "Ctrl+Shift+F10", true},
+		{"shift + ctrl + a", "Ctrl+Shift+A", true},
+		{"Alt+PageUp", "Alt+PageUp", true},
+		{"Control+Numpad5", "Ctrl+Numpad5", true},
+		{"Win+Alt+1", "Alt+Win+1", true},
+		{"A", "", false},          // No modifier
+		{"F9", "", false},         // No modifier, even for function keys
+		{"F", "", false},          // Not a function key
+		{"Ctrl+F25", "", false},   // Out of range
+		{"Ctrl+Shift", "", false}, // No key
+		{"Ctrl++A", "", false},
+		{"Ctrl+Foo", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		chord, err := ParseKeyChord(test.chord)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("ParseKeyChord(%q): expected an error, got %s", test.chord, chord)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseKeyChord(%q): unexpected error %v", test.chord, err)
+		} else if chord.String() != test.expected {
+			t.Errorf("ParseKeyChord(%q): expected %s, got %s", test.chord, test.expected, chord)
+		}
+	}
+}
+
+type fakeHotkeyBackend struct {
+	registered map[int]KeyChord
+	taken      map[string]bool // Chords held by other applications
+}
+
+func (b *fakeHotkeyBackend) Register(id int, chord KeyChord) error {
+	if b.taken[chord.String()] {
+		return ErrHotkeyInUse
+	}
+	b.registered[id] = chord
+	return nil
+}
+
+func (b *fakeHotkeyBackend) Unregister(id int) {
+	delete(b.registered, id)
+}
+
+func TestHotkeyManager(t *testing.T) {
+	backend := &fakeHotkeyBackend{registered: map[int]KeyChord{}, taken: map[string]bool{"Ctrl+Shift+F11": true}}
+	triggered := []HotkeyAction{}
+	handler := func(action HotkeyAction) func() {
+		return func() { triggered = append(triggered, action) }
+	}
+	manager := NewHotkeyManager(backend, map[HotkeyAction]func(){
+		HotkeyToggleTerminals: handler(HotkeyToggleTerminals),
+		HotkeyToggleOverlay:   handler(HotkeyToggleOverlay),
+		HotkeyCycleLayout:     handler(HotkeyCycleLayout),
+		HotkeyNewTerminal:     handler(HotkeyNewTerminal),
+	})
+
+	status := manager.Apply(map[HotkeyAction]string{
+		HotkeyToggleOverlay:   "Ctrl+Shift+F9",
+		HotkeyToggleTerminals: "ctrl+shift+f9", // Conflicts with toggleOverlay (actions are applied in name order)
+		HotkeyCycleLayout:     "Ctrl+Shift+F11",
+		HotkeyNewTerminal:     "",
+	})
+
+	byAction := map[HotkeyAction]HotkeyStatus{}
+	for _, s := range status {
+		byAction[s.Action] = s
+	}
+
+	if s := byAction[HotkeyToggleOverlay]; !s.Registered || s.Error != "" {
+		t.Errorf("expected toggleOverlay to be registered, got %+v", s)
+	}
+	if s := byAction[HotkeyToggleTerminals]; s.Registered || !strings.Contains(s.Error, string(HotkeyToggleOverlay)) {
+		t.Errorf("expected toggleTerminals to report a conflict with toggleOverlay, got %+v", s)
+	}
+	if s := byAction[HotkeyCycleLayout]; s.Registered || s.Error != ErrHotkeyInUse.Error() {
+		t.Errorf("expected cycleLayout to be in use by another application, got %+v", s)
+	}
+	if s := byAction[HotkeyNewTerminal]; s.Registered || s.Error != "" {
+		t.Errorf("expected newTerminal to be disabled without an error, got %+v", s)
+	}
+	if len(backend.registered) != 1 {
+		t.Fatalf("expected 1 registered hotkey, got %d", len(backend.registered))
+	}
+	if !manager.Registered(HotkeyToggleOverlay) || manager.Registered(HotkeyCycleLayout) || manager.Registered(HotkeyToggleClickThrough) {
+		t.Errorf("expected only toggleOverlay to be registered, got %+v", status)
+	}
+
+	for id := range backend.registered {
+		if !manager.Trigger(id) {
+			t.Errorf("Trigger(%d) did not find a hotkey", id)
+		}
+	}
+	if manager.Trigger(999) {
+		t.Error("Trigger() should ignore ids it did not register")
+	}
+	if len(triggered) != 1 || triggered[0] != HotkeyToggleOverlay {
+		t.Errorf("expected toggleOverlay to be triggered, got %v", triggered)
+	}
+
+	// Applying again replaces the previous registrations
+	manager.Apply(map[HotkeyAction]string{HotkeyNewTerminal: "Alt+N"})
+	if len(backend.registered) != 1 {
+		t.Fatalf("expected previous hotkeys to be unregistered, got %v", backend.registered)
+	}
+
+	manager.Close()
+	if len(backend.registered) != 0 {
+		t.Errorf("expected Close() to unregister all hotkeys, got %v", backend.registered)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nvsoft/win"
+	"strings"
+)
+
+// Not defined in github.com/nvsoft/win
+const MOD_ALT = 0x0001
+const MOD_CONTROL = 0x0002
+const MOD_SHIFT = 0x0004
+const MOD_WIN = 0x0008
+const MOD_NOREPEAT = 0x4000
+
+var (
+	procRegisterHotKey   = user32.NewProc("RegisterHotKey")
+	procUnregisterHotKey = user32.NewProc("UnregisterHotKey")
+)
+
+var virtualKeyCodes = map[string]uint32{
+	"Space":       win.VK_SPACE,
+	"Insert":      win.VK_INSERT,
+	"Delete":      win.VK_DELETE,
+	"Home":        win.VK_HOME,
+	"End":         win.VK_END,
+	"PageUp":      win.VK_PRIOR,
+	"PageDown":    win.VK_NEXT,
+	"Up":          win.VK_UP,
+	"Down":        win.VK_DOWN,
+	"Left":        win.VK_LEFT,
+	"Right":       win.VK_RIGHT,
+	"Pause":       win.VK_PAUSE,
+	"ScrollLock":  win.VK_SCROLL,
+	"NumpadPlus":  win.VK_ADD,
+	"NumpadMinus": win.VK_SUBTRACT,
+}
+
+// win32HotkeyBackend registers hotkeys against a window, so WM_HOTKEY messages
+// (with the hotkey id as wParam) are delivered to that window's procedure.
+type win32HotkeyBackend struct {
+	hwnd win.HWND
+}
+
+func (b win32HotkeyBackend) Register(id int, chord KeyChord) error {
+	key, ok := virtualKeyCode(chord.Key)
+	if !ok {
+		return fmt.Errorf("key %s is not supported", chord.Key)
+	}
+
+	modifiers := uint32(MOD_NOREPEAT)
+	if chord.Modifiers&ModAlt != 0 {
+		modifiers |= MOD_ALT
+	}
+	if chord.Modifiers&ModCtrl != 0 {
+		modifiers |= MOD_CONTROL
+	}
+	if chord.Modifiers&ModShift != 0 {
+		modifiers |= MOD_SHIFT
+	}
+	if chord.Modifiers&ModSuper != 0 {
+		modifiers |= MOD_WIN
+	}
+
+	registered, _, _ := procRegisterHotKey.Call(uintptr(b.hwnd), uintptr(id), uintptr(modifiers), uintptr(key))
+	if registered == 0 {
+		// Almost always ERROR_HOTKEY_ALREADY_REGISTERED
+		return fmt.Errorf("%w by another application", ErrHotkeyInUse)
+	}
+	return nil
+}
+
+func (b win32HotkeyBackend) Unregister(id int) {
+	procUnregisterHotKey.Call(uintptr(b.hwnd), uintptr(id))
+}
+
+func virtualKeyCode(key string) (uint32, bool) {
+	if len(key) == 1 {
+		// Virtual key codes for A-Z and 0-9 are the same as their ASCII codes
+		return uint32(key[0]), true
+	}
+	if n, ok := functionKeyNumber(key); ok {
+		return uint32(win.VK_F1 + n - 1), true
+	}
+	if strings.HasPrefix(key, "Numpad") && len(key) == len("Numpad0") {
+		return uint32(win.VK_NUMPAD0) + uint32(key[len(key)-1]-'0'), true
+	}
+	code, ok := virtualKeyCodes[key]
+	return code, ok
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Only one launcher can run per instance key, so launchers for different
+// profiles (see --instance) can run side by side
+const DEFAULT_INSTANCE_KEY = "launcher"
+
+var instanceKey = DEFAULT_INSTANCE_KEY
+
+// Held for as long as the launcher is running (launcher only)
+var launcherInstanceLock *InstanceLock
+
+var ErrAlreadyRunning = errors.New("ICARUS Terminal is already running")
+
+// Keys name files and mutexes, so are kept to characters that are safe in both
+var instanceKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// errInstanceLocked is returned by lockInstanceFile() when another process
+// holds the lock
+var errInstanceLocked = errors.New("instance lock is held by another process")
+
+// AlreadyRunningError is returned by lockInstance() when another launcher with
+// the same key is running
+type AlreadyRunningError struct {
+	Key string
+	PID int // 0 if the lock file couldn't be read
+}
+
+func (e *AlreadyRunningError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("%s (instance %q)", ErrAlreadyRunning.Error(), e.Key)
+	}
+	return fmt.Sprintf("%s (instance %q, PID %d)", ErrAlreadyRunning.Error(), e.Key, e.PID)
+}
+
+func (e *AlreadyRunningError) Is(target error) bool {
+	return target == ErrAlreadyRunning
+}
+
+// InstanceLock stops a second launcher with the same key from running. The
+// lock is held by the operating system (see lockInstanceFile), so is released
+// if the launcher crashes, and the lock file holds the launcher's PID.
+type InstanceLock struct {
+	Key      string
+	StalePID int // PID of a launcher that crashed while holding the lock, if any
+	file     *os.File
+	release  func()
+}
+
+func validateInstanceKey(key string) error {
+	if !instanceKeyPattern.MatchString(key) {
+		return fmt.Errorf("instance must be 1 to 64 letters, numbers, dashes or underscores (got %q)", key)
+	}
+	return nil
+}
+
+func instanceLockPath(key string) (string, error) {
+	dir, err := instanceDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, key+".lock"), nil
+}
+
+// lockInstance() takes the lock for key, returning an *AlreadyRunningError if
+// another process holds it
+func lockInstance(key string) (*InstanceLock, error) {
+	if err := validateInstanceKey(key); err != nil {
+		return nil, err
+	}
+	pathToLock, err := instanceLockPath(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(pathToLock), 0700); err != nil {
+		return nil, err
+	}
+
+	file, release, err := lockInstanceFile(key, pathToLock)
+	if errors.Is(err, errInstanceLocked) {
+		pid, _ := readInstancePID(pathToLock)
+		return nil, &AlreadyRunningError{Key: key, PID: pid}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Release() empties the file, so a PID still in it was left by a launcher
+	// that didn't get that far
+	lock := &InstanceLock{Key: key, file: file, release: release}
+	lock.StalePID, _ = readInstancePID(pathToLock)
+	if err := lock.writePID(os.Getpid()); err != nil {
+		lock.Release()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// Release() gives up the lock. The file is emptied rather than removed, as
+// another process may already have it open.
+func (l *InstanceLock) Release() {
+	l.writePID(0)
+	l.file.Close()
+	l.release()
+}
+
+func (l *InstanceLock) writePID(pid int) error {
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+	if pid == 0 {
+		return nil
+	}
+	_, err := l.file.WriteAt([]byte(strconv.Itoa(pid)+"\n"), 0)
+	return err
+}
+
+// readInstancePID() returns the PID in a lock file, or 0 if it is empty
+func readInstancePID(pathToLock string) (int, error) {
+	contents, err := ioutil.ReadFile(pathToLock)
+	if err != nil {
+		return 0, err
+	}
+	text := strings.TrimSpace(string(contents))
+	if text == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(text)
+}
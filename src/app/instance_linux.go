@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockInstanceFile() takes an exclusive lock on the lock file, which the
+// kernel releases if the launcher crashes
+func lockInstanceFile(key string, pathToLock string) (*os.File, func(), error) {
+	file, err := os.OpenFile(pathToLock, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, nil, errInstanceLocked
+		}
+		return nil, nil, err
+	}
+	return file, func() {}, nil
+}
+
+// instanceDir() is where the running launcher can be found by other
+// processes (see activation.go). XDG_RUNTIME_DIR is private to the user and
+// cleared on logout, so nothing is left behind after a crash.
+func instanceDir() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir = cacheDir
+	}
+	return filepath.Join(dir, "icarus-terminal"), nil
+}
+
+// Window managers decide for themselves which windows may take focus
+func allowActivation() {}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestInstanceLockProcess isn't a test: it is run by the tests below, in
+// another process, to hold (or try to take) the lock for the key in
+// ICARUS_TEST_INSTANCE until its stdin is closed
+func TestInstanceLockProcess(t *testing.T) {
+	key := os.Getenv("ICARUS_TEST_INSTANCE")
+	if key == "" {
+		return
+	}
+	lock, err := lockInstance(key)
+	if err != nil {
+		os.Stdout.WriteString(err.Error() + "\n")
+		os.Exit(exitError)
+	}
+	os.Stdout.WriteString("locked\n")
+	ioutil.ReadAll(os.Stdin)
+	lock.Release()
+	os.Exit(exitOK)
+}
+
+// startInstanceProcess() runs TestInstanceLockProcess and returns the first
+// line it prints, and its stdin to close when it should exit
+func startInstanceProcess(t *testing.T, key string) (*exec.Cmd, io.Closer, string) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInstanceLockProcess$")
+	cmd.Env = append(os.Environ(), "ICARUS_TEST_INSTANCE="+key)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	line, _ := bufio.NewReader(stdout).ReadString('\n')
+	return cmd, stdin, strings.TrimSpace(line)
+}
+
+func TestInstanceLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "instance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Where instanceDir() looks on Linux and Windows
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	t.Setenv("LocalAppData", dir)
+
+	first, _, line := startInstanceProcess(t, "test-launcher")
+	if line != "locked" {
+		t.Fatalf("expected the first process to take the lock, got %q", line)
+	}
+
+	// A competing process, and this one, are turned away with the owner's PID
+	second, _, line := startInstanceProcess(t, "test-launcher")
+	if !strings.Contains(line, ErrAlreadyRunning.Error()) {
+		t.Errorf("expected the second process to be turned away, got %q", line)
+	}
+	if err := second.Wait(); err == nil {
+		t.Errorf("expected the second process to fail")
+	}
+	_, err = lockInstance("test-launcher")
+	var running *AlreadyRunningError
+	if !errors.As(err, &running) || !errors.Is(err, ErrAlreadyRunning) {
+		t.Fatalf("expected an AlreadyRunningError, got %v", err)
+	}
+	if running.PID != first.Process.Pid {
+		t.Errorf("expected the owner to be PID %d, got %d", first.Process.Pid, running.PID)
+	}
+
+	// Other keys have their own lock
+	other, err := lockInstance("test-other")
+	if err != nil {
+		t.Fatalf("expected a different key to be free, got %v", err)
+	}
+	other.Release()
+
+	// The lock is freed if the owner crashes, leaving its PID behind
+	first.Process.Kill()
+	first.Wait()
+	lock, err := lockInstance("test-launcher")
+	if err != nil {
+		t.Fatalf("expected the lock to be free after its owner crashed, got %v", err)
+	}
+	if lock.StalePID != first.Process.Pid {
+		t.Errorf("expected a stale lock from PID %d, got %d", first.Process.Pid, lock.StalePID)
+	}
+	lock.Release()
+
+	// ...but not if it exits cleanly
+	third, stdin, line := startInstanceProcess(t, "test-launcher")
+	if line != "locked" {
+		t.Fatalf("expected the third process to take the lock, got %q", line)
+	}
+	stdin.Close()
+	if err := third.Wait(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	lock, err = lockInstance("test-launcher")
+	if err != nil || lock.StalePID != 0 {
+		t.Fatalf("expected a clean lock, got %+v (%v)", lock, err)
+	}
+	lock.Release()
+
+	if _, err := lockInstance("../launcher"); err == nil {
+		t.Errorf("expected an invalid key to be rejected")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/rodolfoag/gow32"
+	"golang.org/x/sys/windows"
+	"os"
+	"path/filepath"
+)
+
+const ASFW_ANY = ^uintptr(0) // (DWORD)-1
+
+var procAllowSetForegroundWindow = user32.NewProc("AllowSetForegroundWindow")
+
+// lockInstanceFile() holds a named mutex for as long as the launcher is
+// running, which Windows releases if the launcher crashes. The default
+// instance uses the same mutex as earlier releases, so they can't run at the
+// same time as this one.
+func lockInstanceFile(key string, pathToLock string) (*os.File, func(), error) {
+	name := LAUNCHER_WINDOW_TITLE
+	if key != DEFAULT_INSTANCE_KEY {
+		name += " " + key
+	}
+	mutex, err := gow32.CreateMutex(name)
+	if mutex == 0 {
+		return nil, nil, err
+	}
+	release := func() { windows.CloseHandle(windows.Handle(mutex)) }
+	if err == windows.ERROR_ALREADY_EXISTS {
+		release()
+		return nil, nil, errInstanceLocked
+	}
+
+	file, err := os.OpenFile(pathToLock, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return file, release, nil
+}
+
+// instanceDir() is where the running launcher can be found by other
+// processes (see activation.go), in the user's local app data folder
+func instanceDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, LAUNCHER_CONFIG_DIR), nil
+}
+
+// allowActivation() lets the running launcher take focus. Only the foreground
+// process (which a second launch usually is) can bring a window to the front,
+// but it can pass that on to other processes.
+func allowActivation() {
+	procAllowSetForegroundWindow.Call(ASFW_ANY)
+}
@@ -2,24 +2,22 @@ package main
 
 import (
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
-	"github.com/nvsoft/win"
 	"github.com/phayes/freeport"
-	"github.com/rodolfoag/gow32"
 	"github.com/sqweek/dialog"
 	"github.com/webview/webview"
-	"golang.org/x/sys/windows"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"syscall"
+	"sync"
 	"time"
-	"unsafe"
 )
 
 var dirname = ""
-var defaultPort = 3300 // Set to 0 to be assigned a free high numbered port
+var defaultPort = 3300 // Set to 0 (or set port in the config) to be assigned a free high numbered port
 var port int           // Actual port we are running on
 var webViewInstance webview.WebView
 
@@ -28,15 +26,37 @@ var windowWidth = defaultWindowWidth
 var windowHeight = defaultWindowHeight
 var url = fmt.Sprintf("http://localhost:%d", defaultPort)
 
-type process struct {
-	Pid    int
-	Handle uintptr
+type TraySettings struct {
+	CloseToTray    bool `json:"closeToTray"`
+	MinimizeToTray bool `json:"minimizeToTray"`
 }
 
 var processGroup ProcessGroup
 
+var launcherConfig = DefaultLauncherConfig() // What this process is running with
+var configLayers launcherConfigLayers        // What it would run with after a restart
+var launcherHotkeys *HotkeyManager           // Only set in the launcher process
+var saveGameDir SaveGameDir                  // What the service was started with (launcher only)
+var supervisor *serviceSupervisor            // Runs the service (launcher and service command only)
+
 func main() {
-	startTime := time.Now()
+	invocation, err := parseCommandLine(os.Args[1:])
+	if err != nil {
+		attachConsole()
+		fmt.Fprintf(os.Stderr, "%s\n\n", err.Error())
+		var usage *usageError
+		if errors.As(err, &usage) {
+			writeHelp(os.Stderr, usage.Command)
+		}
+		os.Exit(exitUsage)
+	}
+
+	pathToExecutable, err := os.Executable()
+	if err != nil {
+		dialog.Message("%s", "Failed to start ICARUS Terminal Service\n\nUnable to determine current directory.").Title("Error").Error()
+		os.Exit(exitError)
+	}
+	dirname = filepath.Dir(pathToExecutable)
 
 	_processGroup, err := NewProcessGroup()
 	if err != nil {
@@ -45,79 +65,271 @@ func main() {
 	defer _processGroup.Dispose()
 	processGroup = _processGroup
 
-	// Set default port to be random high port
-	if defaultPort == 0 {
+	// Which launcher to run, or hand this command line to
+	if name, ok := invocation.Flags["profile"]; ok {
+		err := validateProfileName(name)
+		if err == nil && !profileExists(name) {
+			err = fmt.Errorf("%w %q (create it with: profile create %s)", ErrUnknownProfile, name, name)
+		}
+		if err != nil {
+			attachConsole()
+			fmt.Fprintln(os.Stderr, err.Error())
+			if invocation.Command.Name == "launch" || invocation.Command.Name == "open" {
+				dialog.Message("%s", err.Error()).Title("Unknown profile").Error()
+			}
+			os.Exit(exitUsage)
+		}
+		activeProfile = name
+		instanceKey = profileInstanceKey(name)
+	}
+	if key, ok := invocation.Flags["instance"]; ok {
+		if err := validateInstanceKey(key); err != nil {
+			attachConsole()
+			fmt.Fprintf(os.Stderr, "--%s\n", err.Error())
+			os.Exit(exitUsage)
+		}
+		instanceKey = key
+	}
+
+	switch invocation.Command.Name {
+	case "install":
+		// Check if is first run after installing, in which case we restart without
+		// elevated privilages to ensure we are not running as the installer, as that
+		// causes problems for things like interacting with windows via SteamVR.
+		runUnelevated(pathToExecutable)
+	case "open":
+		route, err := parseProtocolUrl(invocation.Args[0])
+		if err != nil {
+			attachConsole()
+			fmt.Fprintln(os.Stderr, err.Error())
+			dialog.Message("%s", err.Error()).Title("Invalid link").Error()
+			exitApplication(exitUsage)
+		}
+		// Hand the link to the running launcher, or start one to open it
+		forwardToLauncher("Unable to open link")
+		if err := resolveLauncherConfig(nil); err != nil {
+			dialog.Message("%s", err.Error()).Title("Invalid configuration").Error()
+			exitApplication(exitError)
+		}
+		runLauncher(route)
+	case "launch", "terminal":
+		// Flags that were given override the config file and environment
+		// variables (see launcherConfigLayers.Resolve)
+		if err := resolveLauncherConfig(invocation.Flags); err != nil {
+			dialog.Message("%s", err.Error()).Title("Invalid configuration").Error()
+			exitApplication(exitError)
+		}
+		if invocation.Command.Name == "launch" {
+			forwardToLauncher("ICARUS Terminal is already running")
+		}
+		if invocation.Command.Name == "terminal" {
+			// Without a port, the terminal is for the launcher's service
+			if _, ok := invocation.Flags["port"]; !ok {
+				forwardToLauncher("Unable to open terminal")
+			}
+			// Set by the launcher, or by the user for a service started some other way
+			authToken = os.Getenv(AUTH_TOKEN_ENV)
+			options, err := parseTerminalOptions(invocation.Flags, windowWidth, windowHeight)
+			if err != nil {
+				attachConsole()
+				fmt.Fprintln(os.Stderr, err.Error())
+				dialog.Message("%s", err.Error()).Title("Invalid terminal options").Error()
+				exitApplication(exitUsage)
+			}
+			createWindow(url, options)
+		} else {
+			runLauncher("")
+		}
+	default:
+		// Everything else is run from a command prompt or script
+		attachConsole()
+		exitApplication(runCliCommand(invocation))
+	}
+}
+
+// resolveLauncherConfig() sets launcherConfig from the config file, environment
+// variables and the flags that were given, and sets up the port and URLs that
+// depend on it.
+func resolveLauncherConfig(flags map[string]string) error {
+	file, keys, err := LoadLauncherConfig()
+	if err != nil {
+		return err
+	}
+	configLayers = launcherConfigLayers{
+		File:     file,
+		FileKeys: keys,
+		Env:      os.LookupEnv,
+		Flags: configFlagValues(func(set func(name string, value string)) {
+			for name, value := range flags {
+				set(name, value)
+			}
+		}),
+	}
+	if launcherConfig, _, err = configLayers.Resolve(); err != nil {
+		return err
+	}
+
+	// Set port to be random high port
+	port = launcherConfig.Port
+	if port == 0 {
 		randomPort, portErr := freeport.GetFreePort()
 		if portErr != nil {
 			fmt.Println("Error getting port", portErr.Error())
 		} else {
-			defaultPort = randomPort
+			port = randomPort
+		}
+	}
+
+	windowWidth = int32(launcherConfig.WindowWidth)
+	windowHeight = int32(launcherConfig.WindowHeight)
+	url = fmt.Sprintf("http://localhost:%d", port)
+	return nil
+}
+
+// startService() starts the service on internalPort, behind the launcher's
+// port (see proxy.go), reading Journals from the save game directory if one
+// was found. Clients need the session's token (see auth.go) to use it.
+func startService(internalPort int, stdout io.Writer) (*exec.Cmd, error) {
+	serviceArgs := []string{
+		fmt.Sprintf("%s%d", "--port=", internalPort),
+		"--host=127.0.0.1",
+		// What clients connect to, for the links the service gives out
+		fmt.Sprintf("%s%d", "--public-port=", port),
+		"--public-host=" + serviceHost(),
+	}
+	if saveGameDir.Path != "" {
+		serviceArgs = append(serviceArgs, fmt.Sprintf("%s%s", "--save-game-dir=", saveGameDir.Path))
+	}
+	if activeProfile != DEFAULT_PROFILE {
+		// The default profile's preferences are where the service has always kept them
+		if dir, err := profileDir(activeProfile); err == nil {
+			serviceArgs = append(serviceArgs, fmt.Sprintf("%s%s", "--preferences-dir=", dir))
 		}
 	}
+	if launcherConfig.Https {
+		serviceArgs = append(serviceArgs, "--public-https")
+	}
 
-	// Parse arguments
-	widthPtr := flag.Int("width", int(windowWidth), "Window width")
-	heightPtr := flag.Int("height", int(windowHeight), "Window height")
-	portPtr := flag.Int("port", defaultPort, "Port service should run on")
-	terminalMode := flag.Bool("terminal", false, "Run in terminal only mode")
-	installMode := flag.Bool("install", false, "First run after install")
-	flag.Parse()
+	serviceCmdInstance := exec.Command(filepath.Join(dirname, SERVICE_EXECUTABLE), serviceArgs...)
+	serviceCmdInstance.Dir = dirname
+	serviceCmdInstance.SysProcAttr = hiddenProcessAttributes()
+	serviceCmdInstance.Env = authTokenEnv()
+	serviceCmdInstance.Stdout = stdout
+	serviceCmdInstance.Stderr = stdout
+	if err := serviceCmdInstance.Start(); err != nil {
+		return nil, err
+	}
 
-	windowWidth = int32(*widthPtr)
-	windowHeight = int32(*heightPtr)
-	port = int(*portPtr)
-	url = fmt.Sprintf("http://localhost:%d", *portPtr)
-	launcherUrl := fmt.Sprintf("http://localhost:%d/launcher", *portPtr)
+	// Add service to process group so gets shutdown when main process ends
+	processGroup.AddProcess(serviceCmdInstance.Process)
+	return serviceCmdInstance, nil
+}
 
-	pathToExecutable, err := os.Executable()
-	if err != nil {
-		dialog.Message("%s", "Failed to start ICARUS Terminal Service\n\nUnable to determine current directory.").Title("Error").Error()
-		exitApplication(1)
+// runService() runs the service in the foreground, without the launcher
+func runService(invocation cliInvocation) int {
+	if err := resolveLauncherConfig(invocation.Flags); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
 	}
-	dirname = filepath.Dir(pathToExecutable)
 
-	// Check if is first run after installing, in which case we restart without
-	// elevated privilages to ensure we are not running as the installer, as that
-	// causes problems for things like interacting with windows via SteamVR.
-	if *installMode {
-		runUnelevated(pathToExecutable)
-		return
+	var err error
+	if saveGameDir, err = findSaveGameDir(launcherConfig.SaveGameDir); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error(), "(set one with: config set saveGameDir <path>)")
 	}
 
-	// Check if we are starting in Terminal mode
-	if *terminalMode {
-		createWindow(TERMINAL_WINDOW_TITLE, url, defaultWindowWidth, defaultWindowHeight, webview.HintNone)
-		return
+	// Requests are logged along with the service's output
+	if err := startProxiedService(os.Stdout, os.Stdout, nil); err != nil {
+		fmt.Fprintln(os.Stderr, "Error starting service", err.Error())
+		return exitError
+	}
+	fmt.Println("ICARUS Terminal Service running at", withAuthToken(url))
+
+	// Stop the service too if we are interrupted
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		<-interrupted
+		exitApplication(exitOK)
+	}()
+
+	if err := supervisor.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		return exitError
 	}
+	return exitOK
+}
 
-	// If we get this far, we start in Launcher mode
+// runLauncher() starts the service and opens the launcher window, returning
+// when the launcher is closed. If route is set, a terminal is opened at that
+// route too.
+func runLauncher(route string) {
+	launcherUrl := fmt.Sprintf("http://localhost:%d/launcher", port)
 
 	// Check not already running
-	if checkProcessAlreadyExists(LAUNCHER_WINDOW_TITLE) {
+	lock, err := lockInstance(instanceKey)
+	if errors.Is(err, ErrAlreadyRunning) {
+		fmt.Println(err.Error())
 		dialog.Message("%s", "ICARUS Terminal is already running.\n\nYou can only run one instance at a time.").Title("Information").Info()
 		exitApplication(1)
+	} else if err != nil {
+		fmt.Println("Unable to check if the launcher is already running", err.Error())
+	} else {
+		launcherInstanceLock = lock
+		if lock.StalePID != 0 {
+			fmt.Printf("Launcher (PID %d) did not exit cleanly last time\n", lock.StalePID)
+		}
+	}
+
+	// Handle links and requests from other processes (see sendActivation)
+	if activations, err := listenForActivations(activateLauncher); err != nil {
+		fmt.Println("Unable to listen for activations", err.Error())
+	} else {
+		defer activations.Close()
+	}
+	if pathToExecutable, err := os.Executable(); err == nil {
+		if err := registerProtocolHandler(pathToExecutable); err != nil {
+			fmt.Println("Unable to register "+PROTOCOL_SCHEME+":// links", err.Error())
+		}
 	}
 
-	// Check for an update before running main launcher code
-	// updateAvailable, _ := CheckForUpdate()
-	// if updateAvailable {
-	// 	ok := dialog.Message("%s", "A new version of ICARUS Terminal is available.\n\nDo you want to install the update?").Title("New version available").YesNo()
-	// 	if ok {
-	// 		InstallUpdate()
-	// 		return
-	// 	}
-	// }
+	// Apply changes made to the config file while running (see HotReload)
+	watchLauncherConfig(reloadLauncherConfig)
 
-	// Use Windows API to get Save Game dir
-	saveGameDirPath, err := windows.KnownFolderPath(windows.FOLDERID_SavedGames, 0)
+	// Use the directory the user chose, or look for the directory the game has
+	// written Journals to most recently (see saveGameDirCandidates for where
+	// each platform looks). If neither works, ask the user to find it.
+	saveGameDir, err = findSaveGameDir(launcherConfig.SaveGameDir)
+	if err != nil {
+		fmt.Println(err.Error())
+		dialog.Message("%s", "ICARUS Terminal could not find your Elite Dangerous Journal folder.\n\nPlease select the folder the game saves Journal files in (usually Saved Games\\Frontier Developments\\Elite Dangerous).").Title("Journal folder not found").Info()
+		if saveGameDir, err = pickSaveGameDir(""); err == nil {
+			launcherConfig.SaveGameDir = saveGameDir.Path
+			if err := updateLauncherConfig([]string{"saveGameDir"}, func(config *LauncherConfig) error {
+				config.SaveGameDir = saveGameDir.Path
+				return nil
+			}); err != nil {
+				fmt.Println("Error saving launcher config", err.Error())
+			}
+		}
+	}
+	if err != nil {
+		fmt.Println("Starting service without a save game dir", err.Error())
+	} else {
+		fmt.Println("Using save game dir", saveGameDir.Path, "from", saveGameDir.Source)
+	}
 
 	// Run service
-	cmdArg0 := fmt.Sprintf("%s%d", "--port=", *portPtr)
-	cmdArg1 := fmt.Sprintf("%s%s", "--save-game-dir=", saveGameDirPath)
-	serviceCmdInstance := exec.Command(filepath.Join(dirname, SERVICE_EXECUTABLE), cmdArg0, cmdArg1)
-	serviceCmdInstance.Dir = dirname
-	serviceCmdInstance.SysProcAttr = &syscall.SysProcAttr{CreationFlags: 0x08000000, HideWindow: true}
-	serviceCmdErr := serviceCmdInstance.Start()
+	var accessLog io.Writer
+	if dir, err := profileDir(activeProfile); err == nil {
+		if file, err := os.Create(filepath.Join(dir, ACCESS_LOG_FILE)); err == nil {
+			defer file.Close()
+			accessLog = file
+		}
+	}
+	serviceCmdErr := startProxiedService(nil, accessLog, controlApi{launcherControl{}})
 
 	// Exit if service fails to start
 	if serviceCmdErr != nil {
@@ -125,24 +337,25 @@ func main() {
 		dialog.Message("%s%s", "Failed to start ICARUS Terminal Service.\n\n", serviceCmdErr.Error()).Title("Error").Error()
 		exitApplication(1)
 	}
+	if err := writeControlFile(); err != nil {
+		fmt.Println("Unable to write", CONTROL_FILE, err.Error())
+	}
+	forwardEventsToService()
+	startUpdateChecks()
 
-	// Add service to process group so gets shutdown when main process ends
-	processGroup.AddProcess(serviceCmdInstance.Process)
-
-	// Exit if service stops running
+	// Exit if service stops running, and can't be restarted
 	go func() {
-		serviceCmdInstance.Wait()
-		currentTime := time.Now()
-		diff := currentTime.Sub(startTime)
+		// Wait() returns nil once the launcher is quitting, which isn't a crash
+		if err := supervisor.Wait(); err == nil || supervisor.Stopped() {
+			return
+		}
 
 		// If Window is visible, hide it to avoid showing a Window in a broken state
 		if webViewInstance != nil {
-			hwndPtr := webViewInstance.Window()
-			hwnd := win.HWND(hwndPtr)
-			win.ShowWindow(hwnd, win.SW_HIDE)
+			newNativeWindow(webViewInstance).Hide()
 		}
 
-		if diff.Seconds() < 10 {
+		if !supervisor.WasStable() {
 			// Show alternate dialog message if fails within X seconds of startup
 			dialog.Message("%s", "ICARUS Terminal Service failed to start.\n\nAntiVirus or Firewall software may have prevented it from starting or it may be conflicting with another application.").Title("Error").Error()
 		} else {
@@ -152,250 +365,258 @@ func main() {
 		exitApplication(1)
 	}()
 
-	// TODO Only open a window once service is ready
-	time.Sleep(0 * time.Second)
+	if route != "" {
+		if err := openRoute(route); err != nil {
+			fmt.Println("Unable to open", route, err.Error())
+		}
+	}
+	// Reopen the terminals that were open before a silent install
+	restoreLayout()
 
 	// Open main window (block rest of main until closed)
-	createNativeWindow(LAUNCHER_WINDOW_TITLE, launcherUrl, defaultLauncherWindowWidth, defaultLauncherWindowHeight)
+	createNativeWindow(profileTitle(LAUNCHER_WINDOW_TITLE), withAuthToken(launcherUrl), int32(launcherConfig.LauncherWidth), int32(launcherConfig.LauncherHeight))
 
 	// Ensure we terminate all processes cleanly when window closes
 	exitApplication(0)
 }
 
 // createWindow() lets the webview library create a managed window for us
-func createWindow(LAUNCHER_WINDOW_TITLE string, url string, width int32, height int32, hint webview.Hint) {
+func createWindow(url string, options TerminalOptions) {
 	// Passes the pointer to the window as an unsafe reference
-	w := webview.New(DEBUGGER)
+	w := webview.New(launcherConfig.Debugger)
 	defer w.Destroy()
 
-	hwndPtr := w.Window()
-	hwnd := win.HWND(hwndPtr)
-
-	// Center window and force it to redraw
-	screenWidth := int32(win.GetSystemMetrics(win.SM_CXSCREEN))
-	screenHeight := int32(win.GetSystemMetrics(win.SM_CYSCREEN))
-	windowX := int32((screenWidth / 2) - (width / 2))
-	windowY := int32((screenHeight / 2) - (height / 2))
-	win.MoveWindow(hwnd, windowX, windowY, width, height, false)
-
-	// Set window icon
-	hIconSm := win.HICON(win.LoadImage(0, syscall.StringToUTF16Ptr(ICON), win.IMAGE_ICON, 32, 32, win.LR_LOADFROMFILE|win.LR_SHARED|win.LR_LOADTRANSPARENT))
-	hIcon := win.HICON(win.LoadImage(0, syscall.StringToUTF16Ptr(ICON), win.IMAGE_ICON, 64, 64, win.LR_LOADFROMFILE|win.LR_SHARED|win.LR_LOADTRANSPARENT))
-	win.SendMessage(hwnd, win.WM_SETICON, 0, uintptr(hIconSm))
-	win.SendMessage(hwnd, win.WM_SETICON, 1, uintptr(hIcon))
-
-	bindFunctionsToWebView(w)
-
-	w.SetTitle(LAUNCHER_WINDOW_TITLE)
-	w.SetSize(int(width), int(height), hint)
-	w.Navigate(LoadUrl(url))
+	defer setUpTerminalWindow(w, newNativeWindow(w), url, options)()
 	w.Run()
 }
 
-// createNativeWindow() explicitly creates a native window and passes the handle
-// for it to the webview, this allows for greater customisation
-func createNativeWindow(LAUNCHER_WINDOW_TITLE string, url string, width int32, height int32) {
-	// Instance of this executable
-	hInstance := win.GetModuleHandle(nil)
-	if hInstance == 0 {
-		fmt.Println("GetModuleHandle failed:", win.GetLastError())
-	}
-
-	// Register window class
-	atom := RegisterClass(hInstance)
-	if atom == 0 {
-		fmt.Println("RegisterClass failed:", win.GetLastError())
-	}
-
-	// Create our own window
-	// We do this manually and pass it to webview so that we can set the window
-	// location (i.e. centered), style, etc before it is displayed.
-	hwndPtr := CreateWin32Window(hInstance, LAUNCHER_WINDOW_TITLE, width, height)
-	if hwndPtr == 0 {
-		fmt.Println("CreateWin32Window failed:", win.GetLastError())
-	}
-
-	// Center window
-	hwnd := win.HWND(hwndPtr)
-	screenWidth := int32(win.GetSystemMetrics(win.SM_CXSCREEN))
-	screenHeight := int32(win.GetSystemMetrics(win.SM_CYSCREEN))
-	windowX := int32((screenWidth / 2) - (width / 2))
-	windowY := int32((screenHeight / 2) - (height / 2))
-	win.MoveWindow(hwnd, windowX, windowY, width, height, false)
-
-	// Pass the pointer to the window as an unsafe reference
-	webViewInstance = webview.NewWindow(DEBUGGER, unsafe.Pointer(&hwndPtr))
-	defer webViewInstance.Destroy()
-	bindFunctionsToWebView(webViewInstance)
-	webViewInstance.Navigate(LoadUrl(url))
-	webViewInstance.Run()
-}
-
-func bindFunctionsToWebView(w webview.WebView) {
-	hwndPtr := w.Window()
-	hwnd := win.HWND(hwndPtr)
-
-	var isFullScreen = false
-	var isPinned = false
-	defaultWindowStyle := win.GetWindowLong(hwnd, win.GWL_STYLE)
-
-	w.Bind("icarusTerminal_version", func() string {
-		return GetCurrentAppVersion()
-	})
+// setUpTerminalWindow() places, sizes and titles a terminal's window before
+// binding it and applying its initial state, as the webview's SetSize() gives
+// the window back the frame that fullscreen and pinned windows don't have. It
+// returns bindFunctionsToWebView()'s func.
+func setUpTerminalWindow(w webview.WebView, window nativeWindow, url string, options TerminalOptions) func() {
+	if err := window.Place(options.Placement); err != nil {
+		fmt.Println("Unable to place window", err.Error())
+		window.Center(options.Placement.Width, options.Placement.Height)
+	}
+	window.SetIcon()
+	w.SetTitle(options.Title)
+	w.SetSize(int(options.Placement.Width), int(options.Placement.Height), webview.HintNone)
 
-	w.Bind("icarusTerminal_checkForUpdate", func() string {
-		latestRelease, latestReleaseErr := GetLatestRelease()
-		if latestReleaseErr != nil {
-			return ""
-		}
+	stop := bindFunctionsToWebView(w, window, options.InitialState(), false)
+	if script := options.ZoomScript(); script != "" {
+		w.Init(script)
+	}
+	w.Navigate(LoadUrl(withAuthToken(url + options.Route)))
+	return stop
+}
 
-		response, jsonErr := json.Marshal(latestRelease)
-		if jsonErr != nil {
-			return ""
+// bindFunctionsToWebView() adds the binding the UI uses to control its window
+// and the launcher (see rpc.go), and delivers the events the UI subscribes to
+// (see events.go). launcherWindow is whether it is the launcher's own window,
+// rather than a terminal's. The returned func stops delivery, and must be
+// called before the webview is destroyed.
+func bindFunctionsToWebView(w webview.WebView, window nativeWindow, initial WindowState, launcherWindow bool) func() {
+	subscription, _ := launcherEvents.Subscribe(nil, func(event LauncherEvent) {
+		script, err := launcherEventScript(event)
+		if err != nil {
+			fmt.Println("Unable to send event to window", event.Type, err.Error())
+			return
 		}
-
-		return string(response)
-	})
-
-	w.Bind("icarusTerminal_installUpdate", func() {
-		InstallUpdate()
+		w.Dispatch(func() {
+			w.Eval(script)
+		})
 	})
 
-	w.Bind("icarusTerminal_isFullScreen", func() bool {
-		return isFullScreen
-	})
+	control := newWindowControl(window, initial)
+	window.Listen(control.events())
 
-	w.Bind("icarusTerminal_isPinned", func() bool {
-		return isPinned
+	var launcher rpcLauncher = launcherControl{}
+	if !launcherWindow {
+		launcher = terminalControl{}
+	}
+	ctx := &rpcContext{window: control, launcher: launcher, events: subscription, launcherWindow: launcherWindow}
+	w.Bind(RPC_BINDING, func(request json.RawMessage) RpcResponse {
+		return launcherRpc.Call(ctx, request)
 	})
+	return subscription.Close
+}
 
-	w.Bind("icarusTerminal_togglePinWindow", func() bool {
-		if isFullScreen {
-			// Do nothing if in fullscreen mode (option in UI should be disabled)
-			return false
-		}
-
-		var rc win.RECT
-		win.GetWindowRect(hwnd, &rc)
-
-		if isPinned {
-			win.SetWindowLong(hwnd, win.GWL_STYLE, defaultWindowStyle)
-			win.GetWindowRect(hwnd, &rc)
-			currentWindowWidth := rc.Right - rc.Left
-			currentWindowHeight := rc.Bottom - rc.Top
-			win.SetWindowPos(hwnd, win.HWND_NOTOPMOST, rc.Left, rc.Top, currentWindowWidth, currentWindowHeight, win.SWP_FRAMECHANGED)
-			isPinned = false
-		} else {
-			newWindowStyle := defaultWindowStyle &^ (win.WS_BORDER | win.WS_CAPTION | win.WS_THICKFRAME | win.WS_MINIMIZEBOX | win.WS_MAXIMIZEBOX | win.WS_SYSMENU)
-			win.SetWindowLong(hwnd, win.GWL_STYLE, newWindowStyle)
-			win.GetWindowRect(hwnd, &rc)
-			currentWindowWidth := rc.Right - rc.Left
-			currentWindowHeight := rc.Bottom - rc.Top
-			win.SetWindowPos(hwnd, win.HWND_TOPMOST, rc.Left, rc.Top, currentWindowWidth, currentWindowHeight, win.SWP_FRAMECHANGED)
-			isPinned = true
-		}
-
-		return isPinned
-	})
+// forwardToLauncher() hands this process's command line to the running
+// launcher and exits, which is what users expect from opening an app that is
+// already running. If no launcher is running, it returns so this process can
+// carry on.
+func forwardToLauncher(errorTitle string) {
+	err := sendActivation(activation{Args: os.Args[1:]})
+	if err == nil {
+		exitApplication(exitOK)
+	} else if !errors.Is(err, ErrNoRunningInstance) {
+		attachConsole()
+		fmt.Fprintln(os.Stderr, err.Error())
+		dialog.Message("%s", err.Error()).Title(errorTitle).Error()
+		exitApplication(exitError)
+	}
+}
 
-	w.Bind("icarusTerminal_toggleFullScreen", func() bool {
-		// FIXME Always go fullscreen on main monitor.
-		// If the window is on a second monitor, it should go fullscreen on that
-		// display instead. See the following URL for example of how to handle
-		// https://docs.microsoft.com/en-us/windows/win32/gdi/positioning-objects-on-a-multiple-display-setup
-		screenWidth := int32(win.GetSystemMetrics(win.SM_CXSCREEN))
-		screenHeight := int32(win.GetSystemMetrics(win.SM_CYSCREEN))
-		windowX := int32((screenWidth / 2) - (windowWidth / 2))
-		windowY := int32((screenHeight / 2) - (windowHeight / 2))
-
-		if isFullScreen {
-			// Restore default window style and position
-			// TODO Should restore to window size and location before window was set
-			// to full screen (currently just resets to what it thinks is best)
-			win.SetWindowLong(hwnd, win.GWL_STYLE, defaultWindowStyle)
-			win.MoveWindow(hwnd, windowX, windowY, windowWidth, windowHeight, true)
-			isFullScreen = false
-		} else {
-			// Set to fullscreen and remove window border
-			newWindowStyle := defaultWindowStyle &^ (win.WS_CAPTION | win.WS_THICKFRAME | win.WS_MINIMIZEBOX | win.WS_MAXIMIZEBOX | win.WS_SYSMENU)
-			win.SetWindowLong(hwnd, win.GWL_STYLE, newWindowStyle)
-
-			win.SetWindowPos(hwnd, 0, 0, 0, screenWidth, screenHeight, win.SWP_FRAMECHANGED)
-
-			// TODO Implement full screen mode that respects multi monitor setups
-			// const MONITOR_CENTER = 0x0001 // center rect to monitor
-			// const MONITOR_CLIP = 0x0000 // clip rect to monitor
-			// const MONITOR_WORKAREA = 0x0002 // use monitor work area
-			// const MONITOR_AREA = 0x0000 // use monitor entire area
-			// var rc win.RECT;
-			// win.GetWindowRect(hwnd, &rc);
-			// ClipOrCenterRectToMonitor(&rc, MONITOR_AREA);
-			// win.SetWindowPos(hwnd, 0, rc.Left, rc.Top, 0, 0, win.SWP_NOSIZE | win.SWP_NOZORDER | win.SWP_NOACTIVATE | win.SWP_FRAMECHANGED);
-
-			isPinned = false
-			isFullScreen = true
+// activateLauncher() handles the command line of a second launch (see
+// forwardToLauncher): launching again brings the launcher to the front,
+// terminal opens a terminal for the launcher's service and open opens an
+// icarus:// link.
+func activateLauncher(request activation) error {
+	invocation, err := parseCommandLine(request.Args)
+	if err != nil {
+		return err
+	}
+	return onUIThread(func() error {
+		switch invocation.Command.Name {
+		case "launch":
+			if webViewInstance != nil {
+				newNativeWindow(webViewInstance).Focus()
+			}
+			return nil
+		case "terminal":
+			_, err := openTerminal(invocation.Flags)
+			return err
+		case "open":
+			route, err := parseProtocolUrl(invocation.Args[0])
+			if err != nil {
+				return err
+			}
+			return openRoute(route)
 		}
-		return isFullScreen
+		return fmt.Errorf("%s can't be run by the launcher", invocation.Command.Name)
 	})
+}
 
-	w.Bind("icarusTerminal_newWindow", func() int {
-		terminalCmdInstance := exec.Command(filepath.Join(dirname, TERMINAL_EXECUTABLE), "--terminal=true", fmt.Sprintf("--port=%d", port))
-		terminalCmdInstance.Dir = dirname
-		terminalCmdErr := terminalCmdInstance.Start()
-
-		// Exit if service fails to start
-		if terminalCmdErr != nil {
-			fmt.Println("Opening new terminal failed", terminalCmdErr.Error())
-		}
-
-		// Add process to process group so all windows close when main process ends
-		processGroup.AddProcess(terminalCmdInstance.Process)
+// How long onUIThread() waits for f to run, as a window that is closing (or
+// stuck) never runs it. A variable so that tests don't have to wait as long.
+var uiThreadTimeout = 10 * time.Second
 
-		go func() {
-			terminalCmdInstance.Wait()
-			// Code here will execute when window closes
-		}()
+var ErrUIThreadTimeout = errors.New("the launcher's window didn't respond")
 
-		return 0
+// onUIThread() runs f on the UI thread, once there is one, and waits for it.
+// If it returns ErrUIThreadTimeout f may still run later, so it mustn't change
+// anything the caller goes on to use.
+func onUIThread(f func() error) error {
+	if webViewInstance == nil {
+		return f()
+	}
+	result := make(chan error, 1)
+	webViewInstance.Dispatch(func() {
+		result <- f()
 	})
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(uiThreadTimeout):
+		return ErrUIThreadTimeout
+	}
+}
 
-	w.Bind("icarusTerminal_openReleaseNotes", func() {
-		runUnelevated(RELEASE_NOTES_URL)
-	})
+// updateLauncherConfig() changes settings in the config file, then applies
+// those that can be changed while running. keys are the settings update
+// changes, which are written to the file from then on.
+func updateLauncherConfig(keys []string, update func(config *LauncherConfig) error) error {
+	next := configLayers
+	next.File = configLayers.File.clone()
+	next.FileKeys = map[string]bool{}
+	for key := range configLayers.FileKeys {
+		next.FileKeys[key] = true
+	}
+	for _, key := range keys {
+		next.FileKeys[key] = true
+	}
 
-	w.Bind("icarusTerminal_openTerminalInBrowser", func() {
-		runUnelevated(url)
-	})
+	if err := update(&next.File); err != nil {
+		return err
+	}
+	resolved, _, err := next.Resolve()
+	if err != nil {
+		return err
+	}
+	if err := SaveLauncherConfig(next.File, next.FileKeys); err != nil {
+		return err
+	}
 
-	// FIXME Broken and sometimes causes crashes on child Windows. Don't know why.
-	// To replicate, open a new window (A), then a second window (B), then close
-	// A using this method then try and close B using this method. B will stop
-	// responding and if repeatedly triggered will crash the entire app.
-	// I have tried multiple approaches to resolve this but I think it's a bug
-	// in the webview library this app imports.
-	/*
-		w.Bind("icarusTerminal_closeWindow", func() int {
-			w.Terminate()
-			return 0
-		})
-	*/
+	configLayers = next
+	applyLauncherConfig(resolved)
+	return nil
+}
 
-	w.Bind("icarusTerminal_quit", func() int {
-		exitApplication(0)
-		return 0
+// reloadLauncherConfig() is called when the config file changes on disk. An
+// invalid file is ignored (and reported) rather than applied.
+func reloadLauncherConfig() {
+	file, keys, err := LoadLauncherConfig()
+	if err != nil {
+		fmt.Println("Not reloading launcher config", err.Error())
+		return
+	}
+	if webViewInstance == nil {
+		return
+	}
+	webViewInstance.Dispatch(func() {
+		next := configLayers
+		next.File = file
+		next.FileKeys = keys
+		resolved, _, err := next.Resolve()
+		if err != nil {
+			fmt.Println("Not reloading launcher config", err.Error())
+			return
+		}
+		configLayers = next
+		applyLauncherConfig(resolved)
 	})
 }
 
-func exitApplication(exitCode int) {
-	// Placeholder for future logic
-	os.Exit(exitCode)
+// Held while applyLauncherConfig() changes launcherConfig, so that other
+// goroutines can read it (see currentLauncherConfig)
+var launcherConfigMutex sync.RWMutex
+
+// currentLauncherConfig() is a copy of launcherConfig that any goroutine can
+// read. Only startup, before other goroutines run, and applyLauncherConfig()
+// read launcherConfig directly, as the control API and service restarts use
+// it from other goroutines.
+func currentLauncherConfig() LauncherConfig {
+	launcherConfigMutex.RLock()
+	defer launcherConfigMutex.RUnlock()
+	return launcherConfig.clone()
 }
 
-func checkProcessAlreadyExists(windowTitle string) bool {
-	_, err := gow32.CreateMutex(windowTitle)
-	if err != nil {
-		return true
+// applyLauncherConfig() must be called from the UI thread, which is where
+// launcherConfig is read and hotkeys are registered
+func applyLauncherConfig(config LauncherConfig) {
+	launcherConfigMutex.Lock()
+	hotkeysChanged := launcherConfig.copyHotReloadSettings(config)
+	launcherConfigMutex.Unlock()
+	if hotkeysChanged && launcherHotkeys != nil {
+		for _, status := range launcherHotkeys.Apply(launcherConfig.Hotkeys) {
+			if status.Error != "" {
+				fmt.Println("Unable to register hotkey", status.Action, status.Chord, status.Error)
+			}
+		}
 	}
+}
 
-	return false
+var exitOnce sync.Once
+
+// exitApplication() stops the launcher's processes and exits. Only the first
+// call does that, as quitting can take a while (e.g. for an installer to
+// download), and later calls wait for it.
+func exitApplication(exitCode int) {
+	exitOnce.Do(func() {
+		if supervisor != nil {
+			supervisor.Stop()
+		}
+		removeControlFile()
+		// Otherwise the icon lingers in the notification area until moused over
+		removeTrayIcon()
+		processGroup.Dispose()
+		if launcherInstanceLock != nil {
+			launcherInstanceLock.Release()
+		}
+		if updateChecks != nil {
+			updateChecks.installIfAgreed()
+		}
+		os.Exit(exitCode)
+	})
 }
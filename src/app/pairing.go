@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url" // The launcher's URL is the global url
+	"time"
+)
+
+// Size of the pairing QR code image, in pixels
+const pairingQrCodeSize = 256
+
+var ErrLanAccessOff = errors.New("LAN access is off (set accessMode to " + AccessModeLan + " and restart)")
+
+// PairingCode is shown by the launcher for a remote device to enter at /pair,
+// or scan as a QR code of Url
+type PairingCode struct {
+	Code      string `json:"code"`
+	ExpiresAt string `json:"expiresAt"`
+	Url       string `json:"url"`
+	QrCode    string `json:"qrCode"` // PNG data URI
+}
+
+// PairedDevice is a remote device that can use the service until revoked
+type PairedDevice struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	PairedAt string `json:"pairedAt"`
+	LastSeen string `json:"lastSeen"`
+}
+
+// serviceHost() is the address the service listens on for the access mode
+func serviceHost() string {
+	if currentLauncherConfig().AccessMode == AccessModeLan {
+		return "0.0.0.0"
+	}
+	return "127.0.0.1"
+}
+
+// serviceRequest() calls one of the routes the service has for the launcher
+// (see src/service/lib/auth.js), sending body (if not nil) as JSON and
+// decoding the JSON response into result (if not nil)
+func serviceRequest(method string, path string, body interface{}, result interface{}) error {
+	var requestBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(encoded)
+	}
+	request, err := http.NewRequest(method, url+path, requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+authToken)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := http.Client{Timeout: time.Second * 5}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("unable to reach the service: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(response.Body).Decode(&failure) == nil && failure.Error != "" {
+			return errors.New(failure.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, response.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// lanAddresses() are the IPv4 addresses other devices on the LAN can reach
+// this computer on, from the network interfaces that are up
+func lanAddresses() []string {
+	found := []string{}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return found
+	}
+	for _, networkInterface := range interfaces {
+		if networkInterface.Flags&net.FlagUp == 0 || networkInterface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addresses, _ := networkInterface.Addrs()
+		for _, address := range addresses {
+			if ip, ok := address.(*net.IPNet); ok && ip.IP.To4() != nil && !ip.IP.IsLinkLocalUnicast() {
+				found = append(found, ip.IP.String())
+			}
+		}
+	}
+	return found
+}
+
+func lanAddress() (string, error) {
+	if addresses := lanAddresses(); len(addresses) > 0 {
+		return addresses[0], nil
+	}
+	return "", errors.New("no network connection found for other devices to connect to")
+}
+
+// serviceScheme() is how devices on the LAN connect to the service
+func serviceScheme() string {
+	if currentLauncherConfig().Https {
+		return "https"
+	}
+	return "http"
+}
+
+func pairingUrl(host string, code string) string {
+	return fmt.Sprintf("%s://%s/pair?code=%s", serviceScheme(), net.JoinHostPort(host, fmt.Sprint(port)), code)
+}
+
+// qrCodeDataUri() renders text as a QR code, for showing in an <img>
+func qrCodeDataUri(text string) (string, error) {
+	png, err := qrcode.Encode(text, qrcode.Medium, pairingQrCodeSize)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+// startPairing() asks the service for a new pairing code, replacing any code
+// that was being shown
+func startPairing() (PairingCode, error) {
+	var code PairingCode
+	if currentLauncherConfig().AccessMode != AccessModeLan {
+		return code, ErrLanAccessOff
+	}
+	host, err := lanAddress()
+	if err != nil {
+		return code, err
+	}
+	if err := serviceRequest(http.MethodPost, "/api/pairing", nil, &code); err != nil {
+		return code, err
+	}
+	code.Url = pairingUrl(host, code.Code)
+	code.QrCode, err = qrCodeDataUri(code.Url)
+	return code, err
+}
+
+func pairedDevices() ([]PairedDevice, error) {
+	devices := []PairedDevice{}
+	err := serviceRequest(http.MethodGet, "/api/devices", nil, &devices)
+	return devices, err
+}
+
+// revokeDevice() stops a device using the service, closing its connections,
+// and returns the devices that are left
+func revokeDevice(id string) ([]PairedDevice, error) {
+	devices := []PairedDevice{}
+	err := serviceRequest(http.MethodDelete, "/api/devices/"+neturl.PathEscape(id), nil, &devices)
+	return devices, err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServiceRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Not authorized"})
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/devices":
+			json.NewEncoder(w).Encode([]PairedDevice{{Id: "ab12", Name: "Tablet"}})
+		case "DELETE /api/devices/ab12":
+			json.NewEncoder(w).Encode([]PairedDevice{})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "No such device"})
+		}
+	}))
+	defer server.Close()
+	previousUrl := url
+	defer func() { url, authToken = previousUrl, "" }()
+	url = server.URL
+
+	authToken = "wrong"
+	if _, err := pairedDevices(); err == nil || err.Error() != "Not authorized" {
+		t.Errorf("expected the service's error, got %v", err)
+	}
+
+	authToken = "secret"
+	devices, err := pairedDevices()
+	if err != nil || len(devices) != 1 || devices[0].Name != "Tablet" {
+		t.Errorf("expected the paired device, got %v (%v)", devices, err)
+	}
+	if devices, err := revokeDevice("ab12"); err != nil || len(devices) != 0 {
+		t.Errorf("expected no devices after revoking, got %v (%v)", devices, err)
+	}
+	if _, err := revokeDevice("cd34"); err == nil || err.Error() != "No such device" {
+		t.Errorf("expected the service's error, got %v", err)
+	}
+}
+
+func TestStartPairingNeedsLanAccess(t *testing.T) {
+	previous := launcherConfig
+	defer func() { launcherConfig = previous }()
+
+	launcherConfig.AccessMode = AccessModeLocal
+	if _, err := startPairing(); err != ErrLanAccessOff {
+		t.Errorf("expected ErrLanAccessOff, got %v", err)
+	}
+	if host := serviceHost(); host != "127.0.0.1" {
+		t.Errorf("expected the service to only listen locally, got %s", host)
+	}
+	launcherConfig.AccessMode = AccessModeLan
+	if host := serviceHost(); host != "0.0.0.0" {
+		t.Errorf("expected the service to listen on the LAN, got %s", host)
+	}
+}
+
+func TestPairingQrCode(t *testing.T) {
+	port = 3300
+	link := pairingUrl("192.168.1.20", "012345")
+	if link != "http://192.168.1.20:3300/pair?code=012345" {
+		t.Errorf("unexpected pairing URL %s", link)
+	}
+	uri, err := qrCodeDataUri(link)
+	if err != nil || !strings.HasPrefix(uri, "data:image/png;base64,iVBOR") {
+		t.Errorf("expected a PNG data URI, got %.40s (%v)", uri, err)
+	}
+}
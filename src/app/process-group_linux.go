@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// ProcessGroup tracks child processes so they can be stopped when the launcher
+// exits. Linux has no equivalent of a job object, so if the launcher dies
+// without calling Dispose() we rely on hiddenProcessAttributes() instead.
+type ProcessGroup struct {
+	mu        *sync.Mutex
+	processes map[int]*os.Process
+}
+
+func NewProcessGroup() (ProcessGroup, error) {
+	return ProcessGroup{&sync.Mutex{}, map[int]*os.Process{}}, nil
+}
+
+func (g ProcessGroup) Dispose() error {
+	if g.mu == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for pid, p := range g.processes {
+		// Fails harmlessly if the process has already exited
+		p.Signal(syscall.SIGTERM)
+		delete(g.processes, pid)
+	}
+	return nil
+}
+
+func (g ProcessGroup) AddProcess(p *os.Process) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.processes[p.Pid] = p
+	return nil
+}
+
+// hiddenProcessAttributes() asks the kernel to stop a child process if the
+// launcher exits, as there is no console window to hide on Linux
+func hiddenProcessAttributes() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+}
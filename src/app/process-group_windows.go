@@ -3,9 +3,18 @@ package main
 import (
 	"golang.org/x/sys/windows"
 	"os"
+	"syscall"
 	"unsafe"
 )
 
+// Matches the layout of os.Process on Windows, to get at the process handle
+type process struct {
+	Pid    int
+	Handle uintptr
+}
+
+// ProcessGroup is a job object that kills all processes in it when closed,
+// including when the launcher exits or crashes.
 type ProcessGroup windows.Handle
 
 func NewProcessGroup() (ProcessGroup, error) {
@@ -39,3 +48,8 @@ func (g ProcessGroup) AddProcess(p *os.Process) error {
 		windows.Handle(g),
 		windows.Handle((*process)(unsafe.Pointer(p)).Handle))
 }
+
+// hiddenProcessAttributes() stops a child process opening a console window
+func hiddenProcessAttributes() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: 0x08000000, HideWindow: true}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/phayes/freeport"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// Profiles let more than one commander use ICARUS Terminal on the same
+// machine. Each has its own launcher config (and so its own port, save game
+// directory and window sizes), service preferences and instance key, so
+// launchers for different profiles can run side by side.
+const DEFAULT_PROFILE = "default"
+
+// Profiles other than the default live in here, in the launcher config dir
+const PROFILES_DIR = "Profiles"
+
+var activeProfile = DEFAULT_PROFILE
+
+var ErrUnknownProfile = errors.New("no such profile")
+
+// ProfileInfo is what the launcher UI is told about each profile
+type ProfileInfo struct {
+	Name   string `json:"name"`
+	Active bool   `json:"active"` // The profile this launcher is running
+}
+
+// Names end up in paths and instance keys, so have the same rules
+func validateProfileName(name string) error {
+	if !instanceKeyPattern.MatchString(name) {
+		return fmt.Errorf("profile must be 1 to 64 letters, numbers, dashes or underscores (got %q)", name)
+	}
+	return nil
+}
+
+// profileDir() is where a profile keeps its launcher config and preferences.
+// The default profile uses the directory from before there were profiles.
+func profileDir(name string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	if name == DEFAULT_PROFILE {
+		return filepath.Join(configDir, LAUNCHER_CONFIG_DIR), nil
+	}
+	return filepath.Join(configDir, LAUNCHER_CONFIG_DIR, PROFILES_DIR, name), nil
+}
+
+// profileInstanceKey() is the instance key (see lockInstance) for a profile.
+// Prefixed so a profile can't share a key with a launcher given --instance.
+func profileInstanceKey(name string) string {
+	if name == DEFAULT_PROFILE {
+		return DEFAULT_INSTANCE_KEY
+	}
+	return "profile-" + name
+}
+
+// profileTitle() adds the profile to a window title, so commanders can tell
+// their windows apart
+func profileTitle(title string) string {
+	if activeProfile == DEFAULT_PROFILE {
+		return title
+	}
+	return fmt.Sprintf("%s (%s)", title, activeProfile)
+}
+
+func listProfiles() ([]ProfileInfo, error) {
+	names := []string{}
+	dir, err := profileDir(DEFAULT_PROFILE)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(dir, PROFILES_DIR))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && validateProfileName(entry.Name()) == nil && entry.Name() != DEFAULT_PROFILE {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	profiles := []ProfileInfo{{DEFAULT_PROFILE, activeProfile == DEFAULT_PROFILE}}
+	for _, name := range names {
+		profiles = append(profiles, ProfileInfo{name, name == activeProfile})
+	}
+	return profiles, nil
+}
+
+func profileExists(name string) bool {
+	if name == DEFAULT_PROFILE {
+		return true
+	}
+	dir, err := profileDir(name)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// How many free ports createProfile() tries before giving up on finding one
+// no other profile uses
+const profilePortAttempts = 10
+
+// Replaced in tests
+var freePort = freeport.GetFreePort
+
+// createProfile() makes a profile with the default settings, except that the
+// service runs on a port of its own. The port is kept, as the URLs paired
+// devices use and their cookies (see auth.go) are for a port.
+func createProfile(name string) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	if profileExists(name) {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+	dir, err := profileDir(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	config := DefaultLauncherConfig()
+	if config.Port, err = unusedProfilePort(); err != nil {
+		return err
+	}
+	return saveLauncherConfigFile(filepath.Join(dir, LAUNCHER_CONFIG_FILE), config, map[string]bool{"port": true})
+}
+
+// unusedProfilePort() is a free port that no profile is configured to use
+func unusedProfilePort() (int, error) {
+	profiles, err := listProfiles()
+	if err != nil {
+		return 0, err
+	}
+	used := map[int]bool{}
+	for _, profile := range profiles {
+		dir, err := profileDir(profile.Name)
+		if err != nil {
+			return 0, err
+		}
+		// A config that can't be read still has its port, if that was readable
+		config, _, _ := loadLauncherConfigFile(filepath.Join(dir, LAUNCHER_CONFIG_FILE))
+		used[config.Port] = true
+	}
+	for i := 0; i < profilePortAttempts; i++ {
+		port, err := freePort()
+		if err != nil {
+			return 0, err
+		}
+		if !used[port] {
+			return port, nil
+		}
+	}
+	return 0, errors.New("unable to find a port no other profile uses")
+}
+
+// openProfile() starts a launcher for another profile, which hands over to
+// the profile's launcher if it is already running (see forwardToLauncher)
+func openProfile(name string) error {
+	if !profileExists(name) {
+		return fmt.Errorf("%w %q", ErrUnknownProfile, name)
+	}
+	pathToExecutable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(pathToExecutable, "launch", "--profile="+name)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Not in the process group, as it should keep running if this one quits
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Where os.UserConfigDir() looks on Linux and Windows
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("AppData", dir)
+	defer func() { activeProfile = DEFAULT_PROFILE }()
+	// The first port offered is the default profile's, then alt's
+	ports := []int{defaultPort, 41001, 41001, 41002}
+	defer func(original func() (int, error)) { freePort = original }(freePort)
+	freePort = func() (int, error) {
+		port := ports[0]
+		ports = ports[1:]
+		return port, nil
+	}
+
+	profiles, err := listProfiles()
+	if expected := []ProfileInfo{{DEFAULT_PROFILE, true}}; err != nil || !reflect.DeepEqual(profiles, expected) {
+		t.Fatalf("expected %v, got %v (%v)", expected, profiles, err)
+	}
+
+	for _, name := range []string{"alt", "Second_Cmdr"} {
+		if err := createProfile(name); err != nil {
+			t.Fatalf("unexpected error creating %s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"alt", DEFAULT_PROFILE, "../alt", ""} {
+		if err := createProfile(name); err == nil {
+			t.Errorf("expected an error creating %q", name)
+		}
+	}
+
+	activeProfile = "alt"
+	profiles, err = listProfiles()
+	expected := []ProfileInfo{{DEFAULT_PROFILE, false}, {"Second_Cmdr", false}, {"alt", true}}
+	if err != nil || !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("expected %v, got %v (%v)", expected, profiles, err)
+	}
+
+	// Each profile has its own config, with a port of its own that is kept
+	config, keys, err := LoadLauncherConfig()
+	if err != nil || config.Port != 41001 || !keys["port"] {
+		t.Errorf("expected the new profile to have a port of its own, got %d (%v)", config.Port, err)
+	}
+	activeProfile = "Second_Cmdr"
+	if config, _, err := LoadLauncherConfig(); err != nil || config.Port != 41002 {
+		t.Errorf("expected a port no other profile uses, got %d (%v)", config.Port, err)
+	}
+	if profileInstanceKey("alt") == profileInstanceKey(DEFAULT_PROFILE) {
+		t.Errorf("expected profiles to have their own instance keys")
+	}
+}
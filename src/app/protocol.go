@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	neturl "net/url" // The launcher's URL is the global url
+	"regexp"
+	"strings"
+)
+
+// Links like icarus://nav/route?system=Sol open a page in a terminal
+const PROTOCOL_SCHEME = "icarus"
+
+var ErrNotProtocolUrl = errors.New("not an " + PROTOCOL_SCHEME + ":// link")
+
+// Letters, numbers and dashes, which is all client page names use
+var protocolPathSegment = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// parseProtocolUrl() turns an icarus:// link into the route to open in the
+// client, e.g. icarus://nav/route?system=Sol becomes /nav/route?system=Sol.
+// Links come from other apps and web pages, so anything that doesn't look
+// like a page in the client is rejected.
+func parseProtocolUrl(link string) (string, error) {
+	parsed, err := neturl.Parse(strings.TrimSpace(link))
+	if err != nil || !strings.EqualFold(parsed.Scheme, PROTOCOL_SCHEME) {
+		return "", fmt.Errorf("%w: %q", ErrNotProtocolUrl, link)
+	}
+	if parsed.User != nil || parsed.Port() != "" || parsed.Opaque != "" {
+		return "", fmt.Errorf("%w: %q", ErrNotProtocolUrl, link)
+	}
+
+	// Browsers (and Windows) sometimes add a trailing slash to links without
+	// a path, e.g. icarus://nav/
+	segments := []string{}
+	for _, segment := range strings.Split(parsed.Host+"/"+parsed.Path, "/") {
+		if segment == "" {
+			continue
+		}
+		if !protocolPathSegment.MatchString(segment) {
+			return "", fmt.Errorf("invalid page %q in %q", segment, link)
+		}
+		segments = append(segments, segment)
+	}
+
+	route := "/" + strings.Join(segments, "/")
+	if query := parsed.Query().Encode(); query != "" {
+		route += "?" + query
+	}
+	return route, nil
+}
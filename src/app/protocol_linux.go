@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const PROTOCOL_DESKTOP_FILE = "icarus-terminal-protocol.desktop"
+
+// registerProtocolHandler() adds a desktop entry that handles icarus:// links
+// and makes it the default handler for them. It is done on every launch to
+// follow the app if it moves.
+func registerProtocolHandler(pathToExecutable string) error {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	applicationsDir := filepath.Join(dataDir, "applications")
+	if err := os.MkdirAll(applicationsDir, 0700); err != nil {
+		return err
+	}
+
+	// Exec arguments are quoted as the Desktop Entry spec requires
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", "$", `\$`).Replace(pathToExecutable)
+	entry := fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=%s
+Exec="%s" open %%u
+Icon=%s
+NoDisplay=true
+MimeType=x-scheme-handler/%s;
+`, TERMINAL_WINDOW_TITLE, quoted, filepath.Join(filepath.Dir(pathToExecutable), ICON), PROTOCOL_SCHEME)
+	if err := ioutil.WriteFile(filepath.Join(applicationsDir, PROTOCOL_DESKTOP_FILE), []byte(entry), 0600); err != nil {
+		return err
+	}
+
+	// Not all desktops have xdg-mime, in which case the MimeType in the entry
+	// is usually enough once the desktop database is updated
+	exec.Command("update-desktop-database", applicationsDir).Run()
+	return exec.Command("xdg-mime", "default", PROTOCOL_DESKTOP_FILE, "x-scheme-handler/"+PROTOCOL_SCHEME).Run()
+}
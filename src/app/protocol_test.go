@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseProtocolUrl(t *testing.T) {
+	tests := []struct {
+		link  string
+		route string
+		valid bool
+	}{
+		{"icarus://nav/route?system=Sol", "/nav/route?system=Sol", true},
+		{"icarus://nav/route/?system=Sol%20A&from=Achenar", "/nav/route?from=Achenar&system=Sol+A", true},
+		{"ICARUS://ship", "/ship", true},
+		{"icarus://eng/", "/eng", true},
+		{"icarus:///log", "/log", true},
+		{"icarus://", "/", true},
+		{"  icarus://ghostnet\n", "/ghostnet", true},
+		{"https://example.com/nav", "", false},
+		{"icarus:nav", "", false},
+		{"icarus://nav/../../settings", "", false},
+		{"icarus://nav/%2E%2E/x", "", false},
+		{"icarus://user@nav", "", false},
+		{"icarus://nav:3300/map", "", false},
+		{"icarus://nav/<script>", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		route, err := parseProtocolUrl(test.link)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", test.link, route)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.link, err)
+		} else if route != test.route {
+			t.Errorf("%q: expected %s, got %s", test.link, test.route, route)
+		}
+	}
+
+	if _, err := parseProtocolUrl("https://example.com"); !errors.Is(err, ErrNotProtocolUrl) {
+		t.Errorf("expected ErrNotProtocolUrl, got %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/sys/windows/registry"
+)
+
+// registerProtocolHandler() makes Windows open icarus:// links with this
+// executable. It is registered for the current user (as the installer is), so
+// doesn't need elevation, and is done on every launch to follow the app if
+// it moves.
+func registerProtocolHandler(pathToExecutable string) error {
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, `Software\Classes\`+PROTOCOL_SCHEME, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	key.SetStringValue("", "URL:"+TERMINAL_WINDOW_TITLE)
+	key.SetStringValue("URL Protocol", "")
+
+	icon, _, err := registry.CreateKey(key, "DefaultIcon", registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer icon.Close()
+	icon.SetStringValue("", fmt.Sprintf(`"%s",0`, pathToExecutable))
+
+	command, _, err := registry.CreateKey(key, `shell\open\command`, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer command.Close()
+	return command.SetStringValue("", fmt.Sprintf(`"%s" open "%%1"`, pathToExecutable))
+}
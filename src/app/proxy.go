@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	neturl "net/url" // The launcher's URL is the global url
+	"strings"
+	"sync"
+	"time"
+)
+
+// The launcher owns the port clients connect to, and proxies them to the
+// service, which listens on a port of its own on 127.0.0.1. The service can
+// then be restarted, on a different port, without clients having to go
+// anywhere else: while it is down they get a holding page that reloads
+// itself, and WebSockets reconnect once it is back.
+
+// First byte of a TLS handshake, to tell HTTPS from HTTP on the same port
+const tlsHandshakeRecord = 0x16
+
+// How long a new connection has to send something before it is dropped
+const proxyHandshakeTimeout = 10 * time.Second
+
+// Requests to the launcher's port, in the active profile's directory
+const ACCESS_LOG_FILE = "Access.log"
+
+// Path devices download the certificate authority from (see certificates.go)
+const CA_CERTIFICATE_PATH = "/ca.crt"
+
+// Paths anyone can use, so unpaired devices can pair
+var publicPaths = map[string]bool{
+	"/pair":             true,
+	CA_CERTIFICATE_PATH: true,
+}
+
+const serviceHoldingPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta http-equiv="refresh" content="2">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>ICARUS Terminal</title>
+  <style>
+    body { background: black; color: rgb(250, 135, 0); font-family: sans-serif; text-align: center; padding-top: 30vh; }
+  </style>
+</head>
+<body>
+  <h1>ICARUS Terminal Service is starting</h1>
+  <p>This page will reload when it is ready.</p>
+</body>
+</html>`
+
+// serviceProxy is the handler for the launcher's port
+type serviceProxy struct {
+	certificates *ServiceCertificates // Set if HTTPS is on
+	accessLog    io.Writer
+	control      http.Handler // The launcher's control API (see control.go), if any
+
+	mutex   sync.RWMutex
+	backend *httputil.ReverseProxy // nil while the service is down
+}
+
+func newServiceProxy(certificates *ServiceCertificates, accessLog io.Writer) *serviceProxy {
+	if accessLog == nil {
+		accessLog = ioutil.Discard
+	}
+	return &serviceProxy{certificates: certificates, accessLog: accessLog}
+}
+
+// SetBackend() sends requests to the service on internalPort, or to the
+// holding page if it is 0
+func (p *serviceProxy) SetBackend(internalPort int) {
+	var backend *httputil.ReverseProxy
+	if internalPort != 0 {
+		target := &neturl.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", internalPort)}
+		backend = httputil.NewSingleHostReverseProxy(target)
+		backend.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			// The service stopped since SetBackend() was called
+			sendServiceUnavailable(w, r)
+		}
+	}
+	p.mutex.Lock()
+	p.backend = backend
+	p.mutex.Unlock()
+}
+
+func (p *serviceProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	p.serve(recorder, r)
+	logAccess(p.accessLog, r, recorder.status, time.Since(started))
+}
+
+func (p *serviceProxy) serve(w http.ResponseWriter, r *http.Request) {
+	if p.certificates != nil {
+		if r.URL.Path == CA_CERTIFICATE_PATH {
+			w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", CA_CERTIFICATE_FILE))
+			http.ServeFile(w, r, p.certificates.CaFile)
+			return
+		}
+		// This computer's windows use HTTP, as they don't trust the certificate
+		if r.TLS == nil && !isLoopbackAddress(r.RemoteAddr) {
+			http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusFound)
+			return
+		}
+	}
+
+	// The control API is the launcher's own, and checks tokens itself
+	if p.control != nil && strings.HasPrefix(r.URL.Path, CONTROL_API_PATH) {
+		p.control.ServeHTTP(w, r)
+		return
+	}
+
+	if r.URL.Path == AUTH_EXCHANGE_PATH {
+		exchangeAuthCode(w, r)
+		return
+	}
+
+	// The service checks tokens, but requests without one don't reach it
+	if authToken != "" && requestToken(r) == "" && !publicPaths[r.URL.Path] {
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, "/pair", http.StatusFound)
+			return
+		}
+		http.Error(w, "Not authorized. Open ICARUS Terminal from the launcher, or pair this device at /pair.", http.StatusUnauthorized)
+		return
+	}
+
+	p.mutex.RLock()
+	backend := p.backend
+	p.mutex.RUnlock()
+	if backend == nil {
+		sendServiceUnavailable(w, r)
+		return
+	}
+	if r.TLS != nil {
+		r.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		r.Header.Set("X-Forwarded-Proto", "http")
+	}
+	backend.ServeHTTP(w, r)
+}
+
+// exchangeAuthCode() gives a browser opened with a link from browserLink() the
+// cookie the service looks for, then sends it on to the page the link was for
+func exchangeAuthCode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if authToken == "" || !isLoopbackAddress(r.RemoteAddr) || !takeAuthCode(r.URL.Query().Get(AUTH_CODE_PARAM)) {
+		http.Error(w, "This link has expired. Open ICARUS Terminal in the browser from the launcher again.", http.StatusForbidden)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: authCookieName(), Value: authToken, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	next := r.URL.Query().Get("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// requestToken() is the token a client sent, looked for the same way the
+// service does (see src/service/lib/auth.js)
+func requestToken(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimPrefix(authorization, "Bearer ")
+	}
+	if cookie, err := r.Cookie(authCookieName()); err == nil {
+		return cookie.Value
+	}
+	return r.URL.Query().Get(AUTH_TOKEN_PARAM)
+}
+
+func sendServiceUnavailable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "2")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, serviceHoldingPage)
+		return
+	}
+	http.Error(w, "ICARUS Terminal Service is starting", http.StatusServiceUnavailable)
+}
+
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// logAccess() writes a line for each request, without tokens
+func logAccess(accessLog io.Writer, r *http.Request, status int, duration time.Duration) {
+	link := *r.URL
+	query := link.Query()
+	for _, param := range []string{AUTH_TOKEN_PARAM, AUTH_CODE_PARAM} {
+		if query.Get(param) != "" {
+			query.Set(param, "-")
+			link.RawQuery = query.Encode()
+		}
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	fmt.Fprintf(accessLog, "%s %s %s %s %s %d %s\n", time.Now().Format(time.RFC3339), r.RemoteAddr, scheme, r.Method, link.RequestURI(), status, duration.Round(time.Millisecond))
+}
+
+// statusRecorder keeps the status for the access log. It can still be
+// hijacked, which the proxy needs for WebSockets.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+	return hijacker.Hijack()
+}
+
+// listenForClients() opens the launcher's port on host, serving HTTPS as
+// well as HTTP on it if the proxy has certificates
+func listenForClients(host string, publicPort int, proxy *serviceProxy) (*http.Server, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, fmt.Sprint(publicPort)))
+	if err != nil {
+		return nil, err
+	}
+	if proxy.certificates != nil {
+		certificate, err := tls.LoadX509KeyPair(proxy.certificates.CertFile, proxy.certificates.KeyFile)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		listener = newSniffingListener(listener, &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			NextProtos:   []string{"http/1.1"},
+		})
+	}
+	server := &http.Server{Handler: proxy, ReadHeaderTimeout: proxyHandshakeTimeout}
+	go server.Serve(listener)
+	return server, nil
+}
+
+// sniffingListener accepts HTTPS and HTTP on the same port, by looking at the
+// first byte each client sends. Connections are looked at in their own
+// goroutines, so slow clients don't hold up others.
+type sniffingListener struct {
+	net.Listener
+	config   *tls.Config
+	accepted chan net.Conn
+	failed   chan error
+	closed   chan struct{}
+	close    sync.Once
+}
+
+func newSniffingListener(listener net.Listener, config *tls.Config) *sniffingListener {
+	s := &sniffingListener{
+		Listener: listener,
+		config:   config,
+		accepted: make(chan net.Conn),
+		failed:   make(chan error, 1),
+		closed:   make(chan struct{}),
+	}
+	go s.acceptLoop()
+	return s
+}
+
+func (s *sniffingListener) acceptLoop() {
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			s.failed <- err
+			return
+		}
+		go s.sniff(conn)
+	}
+}
+
+func (s *sniffingListener) sniff(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(proxyHandshakeTimeout))
+	reader := bufio.NewReader(conn)
+	first, err := reader.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+	var sniffed net.Conn = &peekedConn{conn, reader}
+	if first[0] == tlsHandshakeRecord {
+		sniffed = tls.Server(sniffed, s.config)
+	}
+	select {
+	case s.accepted <- sniffed:
+	case <-s.closed:
+		conn.Close()
+	}
+}
+
+func (s *sniffingListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-s.accepted:
+		return conn, nil
+	case err := <-s.failed:
+		return nil, err
+	}
+}
+
+func (s *sniffingListener) Close() error {
+	s.close.Do(func() { close(s.closed) })
+	return s.Listener.Close()
+}
+
+// peekedConn reads the bytes that were peeked at before the rest
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
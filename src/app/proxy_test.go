@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backendPort() starts a stand in for the service, returning its port
+func backendPort(t *testing.T, handler http.Handler) int {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	parsed, _ := neturl.Parse(server.URL)
+	internalPort, _ := strconv.Atoi(parsed.Port())
+	return internalPort
+}
+
+func withSession(t *testing.T) {
+	previousToken, previousPort := authToken, port
+	t.Cleanup(func() { authToken, port = previousToken, previousPort })
+	authToken, port = "secret", 3300
+}
+
+func TestServiceProxy(t *testing.T) {
+	withSession(t)
+	var accessLog bytes.Buffer
+	proxy := newServiceProxy(nil, &accessLog)
+
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		response := httptest.NewRecorder()
+		proxy.ServeHTTP(response, request)
+		return response
+	}
+	page := map[string]string{"Accept": "text/html", "Cookie": "icarus_token_3300=secret"}
+
+	// Requests without a token don't reach the service
+	if response := get("/launcher", map[string]string{"Accept": "text/html"}); response.Code != http.StatusFound || response.Header().Get("Location") != "/pair" {
+		t.Errorf("expected pages without a token to go to /pair, got %d %s", response.Code, response.Header().Get("Location"))
+	}
+	if response := get("/api/devices", nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", response.Code)
+	}
+
+	// While the service is down
+	response := get("/launcher", page)
+	if response.Code != http.StatusServiceUnavailable || !strings.Contains(response.Body.String(), `http-equiv="refresh"`) {
+		t.Errorf("expected the holding page, got %d %s", response.Code, response.Body.String())
+	}
+	if response := get("/pair", map[string]string{"Accept": "text/html"}); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected /pair to need no token, got %d", response.Code)
+	}
+
+	proxy.SetBackend(backendPort(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.URL.RequestURI(), r.Header.Get("X-Forwarded-Proto"))
+	})))
+	if response := get("/launcher?token=secret", map[string]string{"Accept": "text/html"}); response.Code != http.StatusOK || response.Body.String() != "/launcher?token=secret http" {
+		t.Errorf("expected the service's response, got %d %s", response.Code, response.Body.String())
+	}
+	if response := get("/nav/map", map[string]string{"Authorization": "Bearer device-token"}); response.Code != http.StatusOK {
+		t.Errorf("expected other tokens to be left to the service, got %d", response.Code)
+	}
+	if strings.Contains(accessLog.String(), "secret") || !strings.Contains(accessLog.String(), "GET /launcher?token=- 200") {
+		t.Errorf("expected requests logged without tokens, got:\n%s", accessLog.String())
+	}
+
+	// The service stopping is the same as it being down
+	proxy.SetBackend(0)
+	if response := get("/launcher", page); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the holding page once the service stops, got %d", response.Code)
+	}
+}
+
+func TestServiceProxyExchangesAuthCodes(t *testing.T) {
+	withSession(t)
+	proxy := newServiceProxy(nil, nil)
+	exchange := func(link string, remoteAddr string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, link, nil)
+		request.RemoteAddr = remoteAddr
+		response := httptest.NewRecorder()
+		proxy.ServeHTTP(response, request)
+		return response
+	}
+
+	link := browserLink("http://localhost:3300/nav/map?system=Sol")
+	response := exchange(link, "127.0.0.1:50000")
+	cookies := response.Result().Cookies()
+	if response.Code != http.StatusFound || response.Header().Get("Location") != "/nav/map?system=Sol" {
+		t.Errorf("expected to be sent on to the page, got %d %s", response.Code, response.Header().Get("Location"))
+	}
+	if len(cookies) != 1 || cookies[0].Name != authCookieName() || cookies[0].Value != "secret" || !cookies[0].HttpOnly {
+		t.Errorf("expected the session's cookie, got %v", cookies)
+	}
+	if response := exchange(link, "127.0.0.1:50000"); response.Code != http.StatusForbidden || len(response.Result().Cookies()) != 0 {
+		t.Errorf("expected the link to only work once, got %d", response.Code)
+	}
+
+	// Only this computer's browser is given links, and only to this service
+	if response := exchange(browserLink("http://localhost:3300"), "192.168.1.20:50000"); response.Code != http.StatusForbidden {
+		t.Errorf("expected other devices to be refused, got %d", response.Code)
+	}
+	parsed, _ := neturl.Parse(browserLink("http://localhost:3300"))
+	query := parsed.Query()
+	query.Set("next", "//example.com/")
+	if response := exchange(AUTH_EXCHANGE_PATH+"?"+query.Encode(), "127.0.0.1:50000"); response.Header().Get("Location") != "/" {
+		t.Errorf("expected to stay on this service, got %s", response.Header().Get("Location"))
+	}
+}
+
+func TestServiceProxyWebSocket(t *testing.T) {
+	withSession(t)
+	proxy := newServiceProxy(nil, nil)
+	proxy.SetBackend(backendPort(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buffered, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buffered.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		buffered.Flush()
+		line, _ := buffered.ReadString('\n')
+		buffered.WriteString("echo " + line)
+		buffered.Flush()
+	})))
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nCookie: icarus_token_3300=secret\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil || response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected the upgrade to be passed through, got %v %v", response, err)
+	}
+	fmt.Fprint(conn, "hello\n")
+	if line, _ := reader.ReadString('\n'); line != "echo hello\n" {
+		t.Errorf("expected messages to be passed through, got %q", line)
+	}
+}
+
+func TestListenForClientsWithHttps(t *testing.T) {
+	withSession(t)
+	dir, err := ioutil.TempDir("", "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certificates, err := ensureCertificates(dir, []string{"localhost", "127.0.0.1"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := newServiceProxy(&certificates, nil)
+	proxy.SetBackend(backendPort(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("X-Forwarded-Proto"))
+	})))
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	publicPort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	server, err := listenForClients("127.0.0.1", publicPort, proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	caPem, _ := ioutil.ReadFile(certificates.CaFile)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPem)
+	client := http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	for _, scheme := range []string{"http", "https"} {
+		response, err := client.Get(fmt.Sprintf("%s://localhost:%d/?token=secret", scheme, publicPort))
+		if err != nil {
+			t.Fatalf("%s: %v", scheme, err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if string(body) != scheme {
+			t.Errorf("expected %s to be served on the same port, got %q", scheme, body)
+		}
+	}
+
+	response, err := client.Get(fmt.Sprintf("http://localhost:%d%s", publicPort, CA_CERTIFICATE_PATH))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if !bytes.Equal(body, caPem) {
+		t.Error("expected the certificate authority to be offered without a token")
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Params for the methods that take them (see rpcMethod)
+type (
+	rpcOpacityParams struct {
+		Percent int `json:"percent"`
+	}
+	rpcHotkeyParams struct {
+		Action string `json:"action"`
+		Chord  string `json:"chord"`
+	}
+	rpcPathParams struct {
+		Path string `json:"path"` // "" opens a picker
+	}
+	rpcConfigParams struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	rpcNameParams struct {
+		Name string `json:"name"`
+	}
+	rpcIdParams struct {
+		Id string `json:"id"`
+	}
+	rpcEventsParams struct {
+		Types []string `json:"types"`
+	}
+	rpcEnabledParams struct {
+		Enabled bool `json:"enabled"`
+	}
+	rpcInstallParams struct {
+		Strategy string `json:"strategy"` // See update-install.go, defaults to now (since 4)
+	}
+)
+
+// requireUpdateChecks() is the update scheduler, which only the launcher has
+func requireUpdateChecks() (*updateScheduler, error) {
+	if updateChecks == nil {
+		return nil, &RpcError{Code: rpcUnavailable, Message: "updates are not being checked for"}
+	}
+	return updateChecks, nil
+}
+
+func requireRpcParam(name string, value string) error {
+	if value == "" {
+		return &RpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("%s is required", name)}
+	}
+	return nil
+}
+
+var rpcMethods = []rpcMethod{
+	// The launcher
+	{
+		Name: "app.version", Since: 1,
+		Description: "The launcher's version",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return launcherControl{}.Version(), nil
+		},
+	},
+	{
+		Name: "app.checkForUpdate", Since: 1,
+		Description: "The latest release, and whether it is newer than this one",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return ctx.launcher.LatestRelease()
+		},
+	},
+	{
+		Name: "app.installUpdate", Since: 1, LauncherOnly: true, Params: rpcInstallParams{},
+		Description: "Downloads and runs the installer for the latest release, now (quitting cleanly first), onExit (when the launcher next quits) or silent (then reopening the same terminals)",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			strategy, err := parseInstallStrategy(params.(*rpcInstallParams).Strategy)
+			if err != nil {
+				return nil, err
+			}
+			return nil, ctx.launcher.InstallUpdate(strategy)
+		},
+	},
+	{
+		Name: "app.openReleaseNotes", Since: 1,
+		Description: "Opens the release notes in the browser",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			ctx.launcher.OpenUrl(currentLauncherConfig().ReleaseNotesUrl)
+			return nil, nil
+		},
+	},
+	{
+		Name: "app.openInBrowser", Since: 1,
+		Description: "Opens the terminal in the browser",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			ctx.launcher.OpenUrl(browserLink(url))
+			return nil, nil
+		},
+	},
+	{
+		Name: "updates.getStatus", Since: 3, LauncherOnly: true,
+		Description: "What the background update checks found, and when they next run",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			updates, err := requireUpdateChecks()
+			if err != nil {
+				return nil, err
+			}
+			return updates.Status(currentLauncherConfig()), nil
+		},
+	},
+	{
+		Name: "updates.checkNow", Since: 3, LauncherOnly: true,
+		Description: "Starts checking for an update, which is reported by update.progress events",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			updates, err := requireUpdateChecks()
+			if err != nil {
+				return nil, err
+			}
+			return updates.CheckInBackground(currentLauncherConfig())
+		},
+	},
+	{
+		Name: "updates.setInstallOnQuit", Since: 3, LauncherOnly: true, Params: rpcEnabledParams{},
+		Description: "Installs the update that was found when the launcher quits, or stops it being",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			updates, err := requireUpdateChecks()
+			if err != nil {
+				return nil, err
+			}
+			return updates.SetInstallOnQuit(currentLauncherConfig(), params.(*rpcEnabledParams).Enabled)
+		},
+	},
+	{
+		Name: "app.quit", Since: 1, LauncherOnly: true,
+		Description: "Quits the launcher, closing its windows",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			ctx.launcher.Quit()
+			return nil, nil
+		},
+	},
+
+	// The window the call came from
+	{
+		Name: "window.getState", Since: 1,
+		Description: "Whether the window is fullscreen, pinned or an overlay",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return ctx.window.Info(), nil
+		},
+	},
+	{
+		Name: "window.toggleFullScreen", Since: 1,
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return ctx.window.ToggleFullScreen()
+		},
+	},
+	{
+		Name: "window.togglePinned", Since: 1,
+		Description: "Keeps the window on top of others, or stops doing so",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return ctx.window.TogglePinned()
+		},
+	},
+	{
+		Name: "window.toggleOverlay", Since: 1,
+		Description: "Turns the window into a translucent overlay, or back",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return ctx.window.ToggleOverlay()
+		},
+	},
+	{
+		Name: "window.toggleClickThrough", Since: 1,
+		Description: "Lets clicks through an overlay to the window beneath, or stops doing so",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return ctx.window.ToggleClickThrough()
+		},
+	},
+	{
+		Name: "window.setOverlayOpacity", Since: 1, Params: rpcOpacityParams{},
+		Description: "Sets the overlay's opacity, as a percentage",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return ctx.window.SetOpacity(params.(*rpcOpacityParams).Percent), nil
+		},
+	},
+	{
+		Name: "window.close", Since: 1,
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			ctx.window.window.Close()
+			return nil, nil
+		},
+	},
+
+	// Events pushed to the window (see events.go)
+	{
+		Name: "events.subscribe", Since: 2, Params: rpcEventsParams{},
+		Description: "Sets the types of event the window gets, replacing those it had; an empty list unsubscribes",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return ctx.events.SetTypes(params.(*rpcEventsParams).Types)
+		},
+	},
+
+	// Terminals opened by the launcher
+	{
+		Name: "terminals.open", Since: 1, Params: NewWindowOptions{},
+		Description: "Opens a terminal window, returning its id. Terminals ask their launcher to open it.",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			options := *params.(*NewWindowOptions)
+			// Mistakes in the options are the caller's
+			if _, _, err := terminalArgs(options.flags()); err != nil {
+				return nil, &RpcError{Code: rpcInvalidParams, Message: err.Error()}
+			}
+			pid, err := ctx.launcher.OpenTerminal(options)
+			if err != nil {
+				fmt.Println("Opening new terminal failed", err.Error())
+				return nil, err
+			}
+			return ControlWindow{pid, options.Route}, nil
+		},
+	},
+
+	// Settings
+	{
+		Name: "hotkeys.get", Since: 1, LauncherOnly: true,
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return launcherHotkeys.Status(), nil
+		},
+	},
+	{
+		Name: "hotkeys.set", Since: 1, LauncherOnly: true, Params: rpcHotkeyParams{},
+		Description: "Assigns a chord (e.g. Ctrl+Shift+F10) to an action, or unassigns it if empty",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			p := params.(*rpcHotkeyParams)
+			if _, ok := defaultHotkeys[HotkeyAction(p.Action)]; !ok {
+				return nil, &RpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("unknown hotkey action %q", p.Action)}
+			}
+			if err := updateLauncherConfig([]string{"hotkeys"}, func(config *LauncherConfig) error {
+				config.Hotkeys[HotkeyAction(p.Action)] = p.Chord
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+			return launcherHotkeys.Status(), nil
+		},
+	},
+	{
+		Name: "tray.get", Since: 1,
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			config := currentLauncherConfig()
+			return TraySettings{config.CloseToTray, config.MinimizeToTray}, nil
+		},
+	},
+	{
+		Name: "tray.set", Since: 1, LauncherOnly: true, Params: TraySettings{},
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			settings := *params.(*TraySettings)
+			return settings, updateLauncherConfig([]string{"closeToTray", "minimizeToTray"}, func(config *LauncherConfig) error {
+				config.CloseToTray = settings.CloseToTray
+				config.MinimizeToTray = settings.MinimizeToTray
+				return nil
+			})
+		},
+	},
+	{
+		Name: "saveGameDir.get", Since: 1, LauncherOnly: true,
+		Description: "The Journal folder the service uses, or will after a restart",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			if pending, _, err := configLayers.Resolve(); err == nil && pending.SaveGameDir != "" {
+				return saveGameDirStatus(SaveGameDir{Path: pending.SaveGameDir, Source: "config"}, saveGameDir), nil
+			}
+			return saveGameDirStatus(saveGameDir, saveGameDir), nil
+		},
+	},
+	{
+		// The service keeps using the old directory until it is restarted (see
+		// restartRequired)
+		Name: "saveGameDir.set", Since: 1, LauncherOnly: true, Params: rpcPathParams{},
+		Description: "Sets the Journal folder, opening a folder picker if path is empty",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			var selected SaveGameDir
+			if path := params.(*rpcPathParams).Path; path == "" {
+				picked, err := ctx.launcher.PickSaveGameDir(saveGameDir.Path)
+				if err != nil {
+					return nil, err
+				}
+				selected = picked
+			} else {
+				validPath, err := validateSaveGameDir(path)
+				if err != nil {
+					return nil, &RpcError{Code: rpcInvalidParams, Message: err.Error()}
+				}
+				selected = SaveGameDir{Path: validPath, Source: "user"}
+			}
+			if err := updateLauncherConfig([]string{"saveGameDir"}, func(config *LauncherConfig) error {
+				config.SaveGameDir = selected.Path
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+			return saveGameDirStatus(selected, saveGameDir), nil
+		},
+	},
+	{
+		Name: "config.get", Since: 1,
+		Description: "Each setting, where it comes from, and whether changing it needs a restart",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return configLayers.Status(currentLauncherConfig())
+		},
+	},
+	{
+		// Changes are saved to the config file; settings overridden by an
+		// environment variable or flag keep their override until restarted.
+		Name: "config.set", Since: 1, LauncherOnly: true, Params: rpcConfigParams{},
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			p := params.(*rpcConfigParams)
+			if err := requireRpcParam("key", p.Key); err != nil {
+				return nil, err
+			}
+			if err := updateLauncherConfig([]string{p.Key}, func(config *LauncherConfig) error {
+				return config.SetJSON(p.Key, p.Value)
+			}); err != nil {
+				return nil, err
+			}
+			return configLayers.Status(currentLauncherConfig())
+		},
+	},
+
+	// Profiles, each with its own launcher (see profiles.go)
+	{
+		Name: "profiles.list", Since: 1,
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return listProfiles()
+		},
+	},
+	{
+		Name: "profiles.create", Since: 1, LauncherOnly: true, Params: rpcNameParams{},
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			if err := createProfile(params.(*rpcNameParams).Name); err != nil {
+				return nil, &RpcError{Code: rpcInvalidParams, Message: err.Error()}
+			}
+			return listProfiles()
+		},
+	},
+	{
+		Name: "profiles.open", Since: 1, LauncherOnly: true, Params: rpcNameParams{},
+		Description: "Opens the profile's own launcher, or brings it to the front",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			name := params.(*rpcNameParams).Name
+			if name == activeProfile {
+				ctx.window.window.Focus()
+				return nil, nil
+			}
+			return nil, ctx.launcher.OpenProfile(name)
+		},
+	},
+
+	// Remote devices, for LAN access (see pairing.go and certificates.go)
+	{
+		Name: "devices.startPairing", Since: 1, LauncherOnly: true,
+		Description: "A code (and QR code) for a device to pair with",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return startPairing()
+		},
+	},
+	{
+		Name: "devices.list", Since: 1,
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return pairedDevices()
+		},
+	},
+	{
+		Name: "devices.revoke", Since: 1, LauncherOnly: true, Params: rpcIdParams{},
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			id := params.(*rpcIdParams).Id
+			if err := requireRpcParam("id", id); err != nil {
+				return nil, err
+			}
+			return revokeDevice(id)
+		},
+	},
+	{
+		Name: "certificate.export", Since: 1, LauncherOnly: true,
+		Description: "Saves the certificate authority devices install to trust HTTPS, returning where (\"\" if cancelled)",
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			path, err := ctx.launcher.PickCertificatePath()
+			if err != nil || path == "" {
+				return "", err
+			}
+			return path, exportCaCertificate(path)
+		},
+	},
+
+	// Clients get a holding page until the service is back (see proxy.go)
+	{
+		Name: "service.restart", Since: 1, LauncherOnly: true,
+		Call: func(ctx *rpcContext, params interface{}) (interface{}, error) {
+			return nil, ctx.launcher.RestartService()
+		},
+	},
+}
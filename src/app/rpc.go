@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sqweek/dialog"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The UI calls the launcher through a single binding, RPC_BINDING, with a
+// JSON-RPC 2.0 request (e.g. {"jsonrpc": "2.0", "id": 1, "method":
+// "window.togglePinned"}) and gets a JSON-RPC response back. The methods are
+// in rpcMethods (see rpc-methods.go); rpc.discover lists them, so the client
+// (src/client/lib/window.js) can tell what the launcher it runs in supports.
+const RPC_BINDING = "icarusTerminal_rpc"
+
+// Increased whenever methods are added or changed. Each method has the version
+// it was added in.
+const RPC_VERSION = 4
+
+const rpcDiscoverMethod = "rpc.discover"
+
+// Error codes, from JSON-RPC 2.0 and then the launcher's own
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+
+	rpcFailed       = -32000 // See the message
+	rpcLauncherOnly = -32001 // Can't be called from a terminal, only the launcher's window
+	rpcUnavailable  = -32002 // Not possible right now or on this platform, e.g. LAN access is off
+	rpcNotFound     = -32003 // e.g. an unknown profile
+)
+
+type RpcRequest struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// RpcResponse has either Result (which is null for methods with nothing to
+// return) or Error
+type RpcResponse struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RpcError       `json:"error,omitempty"`
+}
+
+type RpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RpcError) Error() string {
+	return e.Message
+}
+
+// rpcMethod is a method the UI can call. Params is the zero value of a struct
+// its params (an object, by name) are decoded into, or nil if it takes none;
+// Call is given a pointer to the decoded struct.
+type rpcMethod struct {
+	Name         string
+	Since        int  // The RPC_VERSION it was added in
+	LauncherOnly bool // Only the launcher's window can call it, not terminals
+	Description  string
+	Params       interface{}
+	Call         func(ctx *rpcContext, params interface{}) (interface{}, error)
+}
+
+// rpcMethodInfo describes a method for rpc.discover
+type rpcMethodInfo struct {
+	Name         string   `json:"name"`
+	Since        int      `json:"since"`
+	LauncherOnly bool     `json:"launcherOnly"`
+	Description  string   `json:"description"`
+	Params       []string `json:"params"`
+}
+
+type rpcCapabilities struct {
+	Version    int             `json:"version"`
+	AppVersion string          `json:"appVersion"`
+	Launcher   bool            `json:"launcher"` // Whether LauncherOnly methods can be called
+	Methods    []rpcMethodInfo `json:"methods"`
+}
+
+// rpcContext is what methods act on: the window the call came from, its
+// subscription to launcher events, and the launcher (which tests replace).
+// launcherWindow is whether the window is the launcher's own, rather than a
+// terminal, which decides whether LauncherOnly methods can be called.
+type rpcContext struct {
+	window         *windowControl
+	events         *eventSubscription
+	launcher       rpcLauncher
+	launcherWindow bool
+}
+
+// rpcLauncher is what methods ask the launcher to do that goes beyond this
+// process, e.g. opening windows or dialogs
+type rpcLauncher interface {
+	LatestRelease() (Release, error)
+	InstallUpdate(strategy string) error
+	OpenTerminal(options NewWindowOptions) (int, error)
+	OpenProfile(name string) error
+	OpenUrl(link string)
+	PickSaveGameDir(startDir string) (SaveGameDir, error)
+	PickCertificatePath() (string, error) // "" if cancelled
+	RestartService() error
+	Quit()
+}
+
+// rpcRegistry is the methods by name
+type rpcRegistry map[string]rpcMethod
+
+var launcherRpc = newRpcRegistry(rpcMethods)
+
+func newRpcRegistry(methods []rpcMethod) rpcRegistry {
+	registry := rpcRegistry{}
+	for _, method := range methods {
+		if _, exists := registry[method.Name]; exists || method.Name == rpcDiscoverMethod {
+			panic("duplicate RPC method " + method.Name)
+		}
+		registry[method.Name] = method
+	}
+	return registry
+}
+
+// Call() handles a request, returning the response for it
+func (r rpcRegistry) Call(ctx *rpcContext, request json.RawMessage) RpcResponse {
+	var parsed RpcRequest
+	if err := json.Unmarshal(request, &parsed); err != nil {
+		return rpcErrorResponse(nil, &RpcError{Code: rpcParseError, Message: err.Error()})
+	}
+	result, err := r.call(ctx, parsed)
+	if err != nil {
+		return rpcErrorResponse(parsed.Id, rpcErrorFor(err))
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return rpcErrorResponse(parsed.Id, &RpcError{Code: rpcInternalError, Message: err.Error()})
+	}
+	return RpcResponse{JsonRpc: "2.0", Id: rpcId(parsed.Id), Result: encoded}
+}
+
+func (r rpcRegistry) call(ctx *rpcContext, request RpcRequest) (interface{}, error) {
+	if request.JsonRpc != "2.0" || request.Method == "" {
+		return nil, &RpcError{Code: rpcInvalidRequest, Message: `expected a JSON-RPC 2.0 request, with "jsonrpc": "2.0" and a method`}
+	}
+	if request.Method == rpcDiscoverMethod {
+		return r.Discover(ctx.launcherWindow), nil
+	}
+	method, ok := r[request.Method]
+	if !ok {
+		return nil, &RpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", request.Method)}
+	}
+	if method.LauncherOnly && !ctx.launcherWindow {
+		return nil, &RpcError{Code: rpcLauncherOnly, Message: fmt.Sprintf("%s can only be used from the launcher", method.Name)}
+	}
+	params, err := decodeRpcParams(method, request.Params)
+	if err != nil {
+		return nil, err
+	}
+	return method.Call(ctx, params)
+}
+
+// decodeRpcParams() decodes params into a new method.Params, strictly, so
+// that mistakes aren't ignored
+func decodeRpcParams(method rpcMethod, params json.RawMessage) (interface{}, error) {
+	trimmed := string(bytes.TrimSpace(params))
+	if method.Params == nil {
+		switch trimmed {
+		case "", "null", "{}", "[]":
+			return nil, nil
+		}
+		return nil, &RpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("%s takes no params", method.Name)}
+	}
+	value := reflect.New(reflect.TypeOf(method.Params))
+	if trimmed == "" || trimmed == "null" {
+		return value.Interface(), nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value.Interface()); err != nil {
+		return nil, &RpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("invalid params for %s: %s", method.Name, err.Error())}
+	}
+	return value.Interface(), nil
+}
+
+// Discover() describes the methods, for rpc.discover from the launcher's
+// window or a terminal's
+func (r rpcRegistry) Discover(launcherWindow bool) rpcCapabilities {
+	methods := []rpcMethodInfo{{
+		Name:        rpcDiscoverMethod,
+		Since:       1,
+		Description: "Lists the methods the launcher supports",
+		Params:      []string{},
+	}}
+	for _, method := range r {
+		methods = append(methods, rpcMethodInfo{
+			Name:         method.Name,
+			Since:        method.Since,
+			LauncherOnly: method.LauncherOnly,
+			Description:  method.Description,
+			Params:       rpcParamNames(method.Params),
+		})
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+	return rpcCapabilities{
+		Version:    RPC_VERSION,
+		AppVersion: GetCurrentAppVersion(),
+		Launcher:   launcherWindow,
+		Methods:    methods,
+	}
+}
+
+func rpcParamNames(params interface{}) []string {
+	names := []string{}
+	if params == nil {
+		return names
+	}
+	paramsType := reflect.TypeOf(params)
+	for i := 0; i < paramsType.NumField(); i++ {
+		field := paramsType.Field(i)
+		if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// rpcErrorFor() gives errors from the rest of the launcher a code, so the UI
+// can tell them apart without parsing messages
+func rpcErrorFor(err error) *RpcError {
+	var rpcErr *RpcError
+	var configErr *ConfigError
+	var rateLimitErr *RateLimitError
+	switch {
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.As(err, &rateLimitErr):
+		return &RpcError{Code: rpcUnavailable, Message: err.Error(), Data: map[string]time.Time{"retryAfter": rateLimitErr.Until}}
+	case errors.As(err, &configErr):
+		return &RpcError{Code: rpcInvalidParams, Message: err.Error(), Data: map[string][]string{"problems": configErr.Problems}}
+	case errors.Is(err, ErrUnknownConfigKey), errors.Is(err, ErrInvalidRequest), errors.Is(err, ErrUnknownEventType):
+		return &RpcError{Code: rpcInvalidParams, Message: err.Error()}
+	case errors.Is(err, ErrUnknownProfile), errors.Is(err, ErrNoSuchWindow):
+		return &RpcError{Code: rpcNotFound, Message: err.Error()}
+	case errors.Is(err, ErrLanAccessOff),
+		errors.Is(err, ErrInvalidWindowTransition),
+		errors.Is(err, ErrNotInOverlayMode),
+		errors.Is(err, ErrHotkeyInUse),
+		errors.Is(err, ErrNoClickThroughHotkey),
+		errors.Is(err, ErrHotkeysUnsupported),
+		errors.Is(err, ErrNoUpdate),
+		errors.Is(err, ErrUpdatesUnsupported),
+		errors.Is(err, ErrUpdateChecksNotRunning),
+		errors.Is(err, ErrUIThreadTimeout),
+		errors.Is(err, ErrWindowsUnsupported):
+		return &RpcError{Code: rpcUnavailable, Message: err.Error()}
+	}
+	return &RpcError{Code: rpcFailed, Message: err.Error()}
+}
+
+func rpcErrorResponse(id json.RawMessage, err *RpcError) RpcResponse {
+	return RpcResponse{JsonRpc: "2.0", Id: rpcId(id), Error: err}
+}
+
+// rpcId() is the request's id, which is null if it didn't have one
+func rpcId(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+// launcherControl is the rpcLauncher for the running launcher, as well as the
+// control API's launcherController (see control.go)
+
+func (launcherControl) OpenTerminal(options NewWindowOptions) (int, error) {
+	return openTerminal(options.flags())
+}
+
+// terminalControl is the rpcLauncher for terminal windows, which ask the
+// launcher to open terminals so that it can act on them like any other
+type terminalControl struct {
+	launcherControl
+}
+
+func (terminalControl) OpenTerminal(options NewWindowOptions) (int, error) {
+	var window ControlWindow
+	err := callControlApi(http.MethodPost, "windows", options, &window)
+	if errors.Is(err, ErrNoRunningInstance) {
+		// e.g. a terminal for a service the launcher didn't start
+		return openTerminal(options.flags())
+	}
+	return window.Id, err
+}
+
+func (launcherControl) OpenProfile(name string) error {
+	return openProfile(name)
+}
+
+func (launcherControl) OpenUrl(link string) {
+	runUnelevated(link)
+}
+
+func (launcherControl) PickSaveGameDir(startDir string) (SaveGameDir, error) {
+	return pickSaveGameDir(startDir)
+}
+
+func (launcherControl) PickCertificatePath() (string, error) {
+	path, err := dialog.File().Title("Save certificate").Filter("Certificate", "crt").Save()
+	if errors.Is(err, dialog.ErrCancelled) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if filepath.Ext(path) == "" {
+		path += ".crt"
+	}
+	return path, nil
+}
+
+func (launcherControl) RestartService() error {
+	if supervisor == nil {
+		return &RpcError{Code: rpcUnavailable, Message: "the service is managed by the launcher"}
+	}
+	return supervisor.Restart()
+}
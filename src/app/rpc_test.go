@@ -0,0 +1,612 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNativeWindow records what was done to a window, and the events its UI
+// was sent (see newTestRpcContext)
+type fakeNativeWindow struct {
+	calls                []string
+	events               []LauncherEvent
+	noClickThroughHotkey bool // The launcher hasn't registered HotkeyToggleClickThrough
+}
+
+func (w *fakeNativeWindow) Center(width int32, height int32)      {}
+func (w *fakeNativeWindow) Place(placement windowPlacement) error { return nil }
+func (w *fakeNativeWindow) SetIcon()                              {}
+func (w *fakeNativeWindow) Hide()                                 { w.calls = append(w.calls, "hide") }
+func (w *fakeNativeWindow) Focus()                                { w.calls = append(w.calls, "focus") }
+func (w *fakeNativeWindow) Close()                                { w.calls = append(w.calls, "close") }
+func (w *fakeNativeWindow) ApplyState(current WindowState, next WindowState) {
+	w.calls = append(w.calls, "apply "+next.Mode.String())
+}
+func (w *fakeNativeWindow) ClickThroughHotkeyRegistered() bool { return !w.noClickThroughHotkey }
+func (w *fakeNativeWindow) Listen(events windowEvents)         {}
+
+// fakeRpcLauncher records what methods asked the launcher to do
+type fakeRpcLauncher struct {
+	calls   []string
+	release Release
+	picked  string // What the pickers return
+}
+
+func (l *fakeRpcLauncher) record(call string) { l.calls = append(l.calls, call) }
+
+func (l *fakeRpcLauncher) LatestRelease() (Release, error) {
+	if l.release.ProductVersion == "" {
+		return Release{}, errors.New("unable to reach GitHub")
+	}
+	return l.release, nil
+}
+func (l *fakeRpcLauncher) InstallUpdate(strategy string) error {
+	l.record("install " + strategy)
+	return nil
+}
+// OpenTerminal() records the window the terminal process would open with
+func (l *fakeRpcLauncher) OpenTerminal(options NewWindowOptions) (int, error) {
+	_, opened, err := terminalArgs(options.flags())
+	if err != nil {
+		return 0, err
+	}
+	l.record(fmt.Sprintf("terminal %s %dx%d pinned=%v", opened.Route, opened.Placement.Width, opened.Placement.Height, opened.Pinned))
+	return 4242, nil
+}
+func (l *fakeRpcLauncher) OpenProfile(name string) error {
+	if !profileExists(name) {
+		return ErrUnknownProfile
+	}
+	l.record("profile " + name)
+	return nil
+}
+func (l *fakeRpcLauncher) OpenUrl(link string) { l.record("url " + link) }
+func (l *fakeRpcLauncher) PickSaveGameDir(startDir string) (SaveGameDir, error) {
+	return SaveGameDir{Path: l.picked, Source: "user"}, nil
+}
+func (l *fakeRpcLauncher) PickCertificatePath() (string, error) { return l.picked, nil }
+func (l *fakeRpcLauncher) RestartService() error {
+	l.record("restart")
+	return nil
+}
+func (l *fakeRpcLauncher) Quit() { l.record("quit") }
+
+// newTestRpcContext() is the context for calls from window's UI, which gets
+// the launcher events it subscribes to. It is the launcher's window.
+func newTestRpcContext(t *testing.T, window *fakeNativeWindow, launcher *fakeRpcLauncher) *rpcContext {
+	subscription, err := launcherEvents.Subscribe(nil, func(event LauncherEvent) {
+		window.events = append(window.events, event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(subscription.Close)
+	return &rpcContext{window: newWindowControl(window, NewWindowState()), events: subscription, launcher: launcher, launcherWindow: true}
+}
+
+func callRpc(ctx *rpcContext, method string, params interface{}) RpcResponse {
+	request := map[string]interface{}{"jsonrpc": "2.0", "id": 7, "method": method}
+	if params != nil {
+		request["params"] = params
+	}
+	encoded, _ := json.Marshal(request)
+	return launcherRpc.Call(ctx, encoded)
+}
+
+// withRpcLauncher() makes this process the launcher, with its config in a
+// temporary directory
+func withRpcLauncher(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	// Where os.UserConfigDir() looks on Linux and Windows
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("AppData", dir)
+
+	previousConfig, previousLayers, previousHotkeys, previousDir := launcherConfig, configLayers, launcherHotkeys, saveGameDir
+	previousUrl, previousToken, previousProfile := url, authToken, activeProfile
+	t.Cleanup(func() {
+		launcherConfig, configLayers, launcherHotkeys, saveGameDir = previousConfig, previousLayers, previousHotkeys, previousDir
+		url, authToken, activeProfile = previousUrl, previousToken, previousProfile
+	})
+	launcherConfig = DefaultLauncherConfig()
+	configLayers = launcherConfigLayers{
+		File:     DefaultLauncherConfig(),
+		FileKeys: map[string]bool{},
+		Env:      func(string) (string, bool) { return "", false },
+		Flags:    map[string]string{},
+	}
+	launcherHotkeys = NewHotkeyManager(&fakeHotkeyBackend{registered: map[int]KeyChord{}, taken: map[string]bool{}}, map[HotkeyAction]func(){})
+	launcherHotkeys.Apply(launcherConfig.Hotkeys)
+	saveGameDir = SaveGameDir{}
+	activeProfile = DEFAULT_PROFILE
+	return dir
+}
+
+func TestRpcRequests(t *testing.T) {
+	withRpcLauncher(t)
+	ctx := newTestRpcContext(t, &fakeNativeWindow{}, &fakeRpcLauncher{})
+
+	tests := []struct {
+		request string
+		code    int
+	}{
+		{`{"jsonrpc": "2.0", "id": 1, "method": "window.getState"}`, 0},
+		{`not json`, rpcParseError},
+		{`{"id": 1, "method": "window.getState"}`, rpcInvalidRequest},
+		{`{"jsonrpc": "2.0", "id": 1}`, rpcInvalidRequest},
+		{`{"jsonrpc": "2.0", "id": 1, "method": "window.explode"}`, rpcMethodNotFound},
+		{`{"jsonrpc": "2.0", "id": 1, "method": "window.getState", "params": {"fast": true}}`, rpcInvalidParams},
+		{`{"jsonrpc": "2.0", "id": 1, "method": "window.getState", "params": {}}`, 0},
+		{`{"jsonrpc": "2.0", "id": 1, "method": "window.setOverlayOpacity", "params": {"percent": "lots"}}`, rpcInvalidParams},
+		{`{"jsonrpc": "2.0", "id": 1, "method": "window.setOverlayOpacity", "params": {"opacity": 50}}`, rpcInvalidParams},
+		{`{"jsonrpc": "2.0", "id": 1, "method": "window.setOverlayOpacity", "params": [50]}`, rpcInvalidParams},
+	}
+	for _, test := range tests {
+		response := launcherRpc.Call(ctx, json.RawMessage(test.request))
+		encoded, _ := json.Marshal(response)
+		if test.code == 0 {
+			if response.Error != nil || response.Result == nil || string(response.Id) != "1" {
+				t.Errorf("%s: expected a result, got %s", test.request, encoded)
+			}
+			continue
+		}
+		if response.Error == nil || response.Error.Code != test.code || response.Result != nil {
+			t.Errorf("%s: expected error %d, got %s", test.request, test.code, encoded)
+		}
+	}
+
+	// Responses always have an id, and methods with nothing to return have a null result
+	response := launcherRpc.Call(ctx, json.RawMessage(`{"jsonrpc": "2.0", "method": "window.close"}`))
+	if encoded, _ := json.Marshal(response); string(encoded) != `{"jsonrpc":"2.0","id":null,"result":null}` {
+		t.Errorf("unexpected response %s", encoded)
+	}
+
+	// Terminals can't use the launcher's methods
+	ctx.launcherWindow = false
+	for _, method := range []string{"hotkeys.get", "tray.set", "app.quit", "app.installUpdate"} {
+		if response := callRpc(ctx, method, nil); response.Error == nil || response.Error.Code != rpcLauncherOnly {
+			t.Errorf("expected %s to be launcher only, got %+v", method, response)
+		}
+	}
+}
+
+func TestRpcDiscover(t *testing.T) {
+	withRpcLauncher(t)
+	ctx := newTestRpcContext(t, &fakeNativeWindow{}, &fakeRpcLauncher{})
+
+	var capabilities rpcCapabilities
+	if err := json.Unmarshal(callRpc(ctx, "rpc.discover", nil).Result, &capabilities); err != nil {
+		t.Fatal(err)
+	}
+	if capabilities.Version != RPC_VERSION || !capabilities.Launcher || len(capabilities.Methods) != len(launcherRpc)+1 {
+		t.Errorf("unexpected capabilities %+v", capabilities)
+	}
+	for _, method := range capabilities.Methods {
+		if method.Since < 1 || method.Since > RPC_VERSION {
+			t.Errorf("%s: since %d is not a released version", method.Name, method.Since)
+		}
+		if method.Name == "hotkeys.set" && (!method.LauncherOnly || !reflect.DeepEqual(method.Params, []string{"action", "chord"})) {
+			t.Errorf("unexpected description %+v", method)
+		}
+	}
+
+	// Whether it's the launcher depends on the window, not what this process has set up
+	ctx.launcherWindow = false
+	if err := json.Unmarshal(callRpc(ctx, "rpc.discover", nil).Result, &capabilities); err != nil || capabilities.Launcher {
+		t.Errorf("expected a terminal not to be told it is the launcher, got %+v %v", capabilities, err)
+	}
+}
+
+func TestRpcErrorCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{&ConfigError{Source: "config", Problems: []string{"bad port"}}, rpcInvalidParams},
+		{ErrUnknownConfigKey, rpcInvalidParams},
+		{ErrUnknownProfile, rpcNotFound},
+		{ErrLanAccessOff, rpcUnavailable},
+		{ErrInvalidWindowTransition, rpcUnavailable},
+		{ErrUpdateChecksNotRunning, rpcUnavailable},
+		{&RpcError{Code: rpcLauncherOnly}, rpcLauncherOnly},
+		{errors.New("disk full"), rpcFailed},
+	}
+	for _, test := range tests {
+		if code := rpcErrorFor(test.err).Code; code != test.code {
+			t.Errorf("%v: expected %d, got %d", test.err, test.code, code)
+		}
+	}
+}
+
+// Each method has a test here, which TestRpcMethods checks for
+var rpcMethodTests = map[string]func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher){
+	"app.version": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var version versionInfo
+		expectRpcResult(t, callRpc(ctx, "app.version", nil), &version)
+		if version.Version != GetCurrentAppVersion() {
+			t.Errorf("unexpected version %+v", version)
+		}
+	},
+	"app.checkForUpdate": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcError(t, callRpc(ctx, "app.checkForUpdate", nil), rpcFailed)
+		launcher.release = Release{InstalledVersion: "1.0.0", ProductVersion: "1.1.0", IsUpgrade: true}
+		var release Release
+		expectRpcResult(t, callRpc(ctx, "app.checkForUpdate", nil), &release)
+		if release != launcher.release {
+			t.Errorf("unexpected release %+v", release)
+		}
+	},
+	"app.installUpdate": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcResult(t, callRpc(ctx, "app.installUpdate", nil), nil)
+		expectRpcResult(t, callRpc(ctx, "app.installUpdate", map[string]string{"strategy": InstallOnExit}), nil)
+		expectRpcError(t, callRpc(ctx, "app.installUpdate", map[string]string{"strategy": "later"}), rpcInvalidParams)
+		expectCalls(t, launcher.calls, "install now", "install onExit")
+	},
+	"app.openReleaseNotes": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcResult(t, callRpc(ctx, "app.openReleaseNotes", nil), nil)
+		expectCalls(t, launcher.calls, "url "+RELEASE_NOTES_URL)
+	},
+	"app.openInBrowser": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		url, authToken = "http://localhost:3300", "secret"
+		expectRpcResult(t, callRpc(ctx, "app.openInBrowser", nil), nil)
+		if len(launcher.calls) != 1 || !strings.HasPrefix(launcher.calls[0], "url http://localhost:3300"+AUTH_EXCHANGE_PATH+"?") || strings.Contains(launcher.calls[0], "secret") {
+			t.Errorf("expected a one-time link without the session token, got %q", launcher.calls)
+		}
+	},
+	"app.quit": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcResult(t, callRpc(ctx, "app.quit", nil), nil)
+		expectCalls(t, launcher.calls, "quit")
+	},
+	"window.getState": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var state windowStateInfo
+		expectRpcResult(t, callRpc(ctx, "window.getState", nil), &state)
+		if state != (windowStateInfo{Opacity: defaultOverlayOpacity}) {
+			t.Errorf("unexpected state %+v", state)
+		}
+	},
+	"window.toggleFullScreen": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var state windowStateInfo
+		expectRpcResult(t, callRpc(ctx, "window.toggleFullScreen", nil), &state)
+		if !state.FullScreen || state.Pinned {
+			t.Errorf("expected fullscreen, got %+v", state)
+		}
+		expectRpcError(t, callRpc(ctx, "window.toggleOverlay", nil), rpcUnavailable)
+		expectRpcResult(t, callRpc(ctx, "window.toggleFullScreen", nil), &state)
+		if state.FullScreen {
+			t.Errorf("expected fullscreen to be off, got %+v", state)
+		}
+		expectCalls(t, window.calls, "apply "+WindowModeFullScreen.String(), "apply "+WindowModeNormal.String())
+	},
+	"window.togglePinned": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var state windowStateInfo
+		expectRpcResult(t, callRpc(ctx, "window.togglePinned", nil), &state)
+		if !state.Pinned {
+			t.Errorf("expected the window to be pinned, got %+v", state)
+		}
+	},
+	"window.toggleOverlay": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var state windowStateInfo
+		expectRpcResult(t, callRpc(ctx, "window.toggleOverlay", nil), &state)
+		if !state.Overlay || !state.Pinned {
+			t.Errorf("expected an overlay, got %+v", state)
+		}
+	},
+	"window.toggleClickThrough": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcError(t, callRpc(ctx, "window.toggleClickThrough", nil), rpcUnavailable)
+		callRpc(ctx, "window.toggleOverlay", nil)
+		var state windowStateInfo
+		expectRpcResult(t, callRpc(ctx, "window.toggleClickThrough", nil), &state)
+		if !state.ClickThrough {
+			t.Errorf("expected click through, got %+v", state)
+		}
+
+		// Without the hotkey, the window could never be clicked again
+		other := &fakeNativeWindow{noClickThroughHotkey: true}
+		otherCtx := newTestRpcContext(t, other, launcher)
+		callRpc(otherCtx, "window.toggleOverlay", nil)
+		expectRpcError(t, callRpc(otherCtx, "window.toggleClickThrough", nil), rpcUnavailable)
+	},
+	"window.setOverlayOpacity": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var state windowStateInfo
+		expectRpcResult(t, callRpc(ctx, "window.setOverlayOpacity", map[string]int{"percent": 55}), &state)
+		if state.Opacity != 55 || len(window.calls) != 0 {
+			t.Errorf("expected the opacity to be kept for overlay mode, got %+v %v", state, window.calls)
+		}
+		callRpc(ctx, "window.toggleOverlay", nil)
+		expectRpcResult(t, callRpc(ctx, "window.setOverlayOpacity", map[string]int{"percent": 5}), &state)
+		if state.Opacity != minOverlayOpacity || len(window.calls) != 2 {
+			t.Errorf("expected the opacity to be clamped and applied, got %+v %v", state, window.calls)
+		}
+	},
+	"window.close": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcResult(t, callRpc(ctx, "window.close", nil), nil)
+		expectCalls(t, window.calls, "close")
+	},
+	"terminals.open": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		previousWidth, previousHeight := windowWidth, windowHeight
+		t.Cleanup(func() { windowWidth, windowHeight = previousWidth, previousHeight })
+		windowWidth, windowHeight = 1024, 768 // From the config, unless the options say otherwise
+		var opened ControlWindow
+		expectRpcResult(t, callRpc(ctx, "terminals.open", map[string]interface{}{"route": "/nav/map", "width": 800, "pinned": true}), &opened)
+		if opened.Route != "/nav/map" {
+			t.Errorf("unexpected window %+v", opened)
+		}
+
+		// Mistakes are the caller's, and no terminal is opened for them
+		expectRpcError(t, callRpc(ctx, "terminals.open", map[string]interface{}{"width": -1}), rpcInvalidParams)
+		expectRpcError(t, callRpc(ctx, "terminals.open", map[string]interface{}{"route": "nav"}), rpcInvalidParams)
+		expectRpcError(t, callRpc(ctx, "terminals.open", map[string]interface{}{"route": "/", "zoom": 2}), rpcInvalidParams)
+		expectCalls(t, launcher.calls, "terminal /nav/map 800x768 pinned=true")
+	},
+	"hotkeys.get": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var status []HotkeyStatus
+		expectRpcResult(t, callRpc(ctx, "hotkeys.get", nil), &status)
+		if len(status) != len(defaultHotkeys) {
+			t.Errorf("expected the status of each hotkey, got %+v", status)
+		}
+	},
+	"hotkeys.set": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var status []HotkeyStatus
+		expectRpcResult(t, callRpc(ctx, "hotkeys.set", rpcHotkeyParams{string(HotkeyToggleOverlay), "Ctrl+Alt+O"}), &status)
+		if launcherConfig.Hotkeys[HotkeyToggleOverlay] != "Ctrl+Alt+O" {
+			t.Errorf("expected the hotkey to be applied, got %v", launcherConfig.Hotkeys)
+		}
+		expectRpcError(t, callRpc(ctx, "hotkeys.set", rpcHotkeyParams{"explode", "Ctrl+E"}), rpcInvalidParams)
+	},
+	"tray.get": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var settings TraySettings
+		expectRpcResult(t, callRpc(ctx, "tray.get", nil), &settings)
+		if settings != (TraySettings{launcherConfig.CloseToTray, launcherConfig.MinimizeToTray}) {
+			t.Errorf("unexpected settings %+v", settings)
+		}
+	},
+	"tray.set": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var settings TraySettings
+		expectRpcResult(t, callRpc(ctx, "tray.set", TraySettings{true, false}), &settings)
+		if !launcherConfig.CloseToTray || launcherConfig.MinimizeToTray {
+			t.Errorf("expected the settings to be applied, got %+v", launcherConfig)
+		}
+	},
+	"saveGameDir.get": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var status SaveGameDirStatus
+		expectRpcResult(t, callRpc(ctx, "saveGameDir.get", nil), &status)
+		if status.Valid || status.Error == "" {
+			t.Errorf("expected no save game dir, got %+v", status)
+		}
+	},
+	"saveGameDir.set": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		journalDir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "Journals")
+		os.MkdirAll(journalDir, 0700)
+		ioutil.WriteFile(filepath.Join(journalDir, "Journal.2022-01-01T000000.01.log"), []byte("{}"), 0600)
+		ioutil.WriteFile(filepath.Join(journalDir, "Status.json"), []byte("{}"), 0600)
+
+		var status SaveGameDirStatus
+		expectRpcResult(t, callRpc(ctx, "saveGameDir.set", rpcPathParams{journalDir}), &status)
+		if !status.Valid || !status.RestartRequired || configLayers.File.SaveGameDir != journalDir {
+			t.Errorf("expected the dir to be saved for the next start, got %+v", status)
+		}
+		launcher.picked = journalDir
+		expectRpcResult(t, callRpc(ctx, "saveGameDir.set", nil), &status)
+		expectRpcError(t, callRpc(ctx, "saveGameDir.set", rpcPathParams{os.TempDir()}), rpcInvalidParams)
+	},
+	"config.get": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var status []ConfigSettingStatus
+		expectRpcResult(t, callRpc(ctx, "config.get", nil), &status)
+		if len(status) != len(configSettings) {
+			t.Errorf("expected each setting, got %d", len(status))
+		}
+	},
+	"config.set": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcResult(t, callRpc(ctx, "config.set", map[string]interface{}{"key": "port", "value": 3400}), nil)
+		if configLayers.File.Port != 3400 {
+			t.Errorf("expected the port to be saved, got %d", configLayers.File.Port)
+		}
+		expectRpcError(t, callRpc(ctx, "config.set", map[string]interface{}{"key": "port", "value": 99999}), rpcInvalidParams)
+		expectRpcError(t, callRpc(ctx, "config.set", map[string]interface{}{"key": "colour", "value": "orange"}), rpcInvalidParams)
+		expectRpcError(t, callRpc(ctx, "config.set", map[string]interface{}{"value": 3400}), rpcInvalidParams)
+	},
+	"profiles.list": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var profiles []ProfileInfo
+		expectRpcResult(t, callRpc(ctx, "profiles.list", nil), &profiles)
+		if !reflect.DeepEqual(profiles, []ProfileInfo{{DEFAULT_PROFILE, true}}) {
+			t.Errorf("unexpected profiles %v", profiles)
+		}
+	},
+	"profiles.create": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var profiles []ProfileInfo
+		expectRpcResult(t, callRpc(ctx, "profiles.create", rpcNameParams{"alt"}), &profiles)
+		if len(profiles) != 2 {
+			t.Errorf("expected the new profile, got %v", profiles)
+		}
+		expectRpcError(t, callRpc(ctx, "profiles.create", rpcNameParams{"../alt"}), rpcInvalidParams)
+	},
+	"profiles.open": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcResult(t, callRpc(ctx, "profiles.open", rpcNameParams{DEFAULT_PROFILE}), nil)
+		expectCalls(t, window.calls, "focus")
+		expectRpcError(t, callRpc(ctx, "profiles.open", rpcNameParams{"missing"}), rpcNotFound)
+	},
+	"devices.startPairing": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcError(t, callRpc(ctx, "devices.startPairing", nil), rpcUnavailable)
+	},
+	"devices.list": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		withDevicesService(t)
+		var devices []PairedDevice
+		expectRpcResult(t, callRpc(ctx, "devices.list", nil), &devices)
+		if len(devices) != 1 || devices[0].Id != "ab12" {
+			t.Errorf("unexpected devices %v", devices)
+		}
+	},
+	"devices.revoke": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		withDevicesService(t)
+		var devices []PairedDevice
+		expectRpcResult(t, callRpc(ctx, "devices.revoke", rpcIdParams{"ab12"}), &devices)
+		if len(devices) != 0 {
+			t.Errorf("expected no devices, got %v", devices)
+		}
+		expectRpcError(t, callRpc(ctx, "devices.revoke", nil), rpcInvalidParams)
+	},
+	"certificate.export": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		var path string
+		expectRpcResult(t, callRpc(ctx, "certificate.export", nil), &path)
+		if path != "" {
+			t.Errorf("expected nothing to be saved when cancelled, got %s", path)
+		}
+		launcher.picked = filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "ca.crt")
+		expectRpcResult(t, callRpc(ctx, "certificate.export", nil), &path)
+		if data, err := ioutil.ReadFile(path); err != nil || !strings.Contains(string(data), "BEGIN CERTIFICATE") {
+			t.Errorf("expected the certificate at %s (%v)", path, err)
+		}
+	},
+	"events.subscribe": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcError(t, callRpc(ctx, "events.subscribe", map[string][]string{"types": {"window.exploded"}}), rpcInvalidParams)
+		callRpc(ctx, "window.togglePinned", nil)
+		if len(window.events) != 0 {
+			t.Errorf("expected no events before subscribing, got %+v", window.events)
+		}
+
+		var types []string
+		expectRpcResult(t, callRpc(ctx, "events.subscribe", map[string][]string{"types": {EventWindowStateChanged, EventServiceStatus}}), &types)
+		if !reflect.DeepEqual(types, []string{EventServiceStatus, EventWindowStateChanged}) {
+			t.Errorf("unexpected types %v", types)
+		}
+		callRpc(ctx, "window.togglePinned", nil)
+		terminalsChanged()
+		if len(window.events) != 1 || window.events[0].Type != EventWindowStateChanged || window.events[0].Payload.(windowStateInfo).Pinned {
+			t.Errorf("expected the window being unpinned, got %+v", window.events)
+		}
+
+		expectRpcResult(t, callRpc(ctx, "events.subscribe", map[string][]string{"types": {}}), &types)
+		callRpc(ctx, "window.togglePinned", nil)
+		if len(types) != 0 || len(window.events) != 1 {
+			t.Errorf("expected no more events after unsubscribing, got %v %+v", types, window.events)
+		}
+	},
+	"updates.getStatus": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcError(t, callRpc(ctx, "updates.getStatus", nil), rpcUnavailable)
+		withUpdateChecks(t, &fakeUpdates{release: upgradeTo("1.1.0"), now: time.Now()})
+		updateChecks.Check(launcherConfig)
+		var status UpdateStatus
+		expectRpcResult(t, callRpc(ctx, "updates.getStatus", nil), &status)
+		if !status.Enabled || status.Release == nil || status.Release.ProductVersion != "1.1.0" {
+			t.Errorf("unexpected status %+v", status)
+		}
+	},
+	"updates.checkNow": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		fake := &fakeUpdates{release: upgradeTo("1.1.0"), now: time.Now()}
+		withUpdateChecks(t, fake)
+		callRpc(ctx, "events.subscribe", map[string][]string{"types": {EventUpdateProgress}})
+		var status UpdateStatus
+		expectRpcResult(t, callRpc(ctx, "updates.checkNow", nil), &status)
+		if !status.Checking {
+			t.Errorf("expected a check to have started, got %+v", status)
+		}
+		for deadline := time.Now().Add(time.Second); updateChecks.Status(launcherConfig).Checking && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		if status := updateChecks.Status(launcherConfig); status.Checking || status.Release == nil {
+			t.Errorf("expected the check to find 1.1.0, got %+v", status)
+		}
+
+		// Until GitHub's rate limit resets, checks are refused
+		updateChecks.state.RetryAfter = fake.now.Add(time.Hour)
+		expectRpcError(t, callRpc(ctx, "updates.checkNow", nil), rpcUnavailable)
+	},
+	"updates.setInstallOnQuit": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		withUpdateChecks(t, &fakeUpdates{release: upgradeTo("1.1.0"), now: time.Now()})
+		expectRpcError(t, callRpc(ctx, "updates.setInstallOnQuit", map[string]bool{"enabled": true}), rpcUnavailable)
+		updateChecks.Check(launcherConfig)
+		response := callRpc(ctx, "updates.setInstallOnQuit", map[string]bool{"enabled": true})
+		if !canInstallUpdates {
+			expectRpcError(t, response, rpcUnavailable)
+			return
+		}
+		var status UpdateStatus
+		expectRpcResult(t, response, &status)
+		if !status.InstallOnQuit {
+			t.Errorf("expected the update to be installed on quit, got %+v", status)
+		}
+	},
+	"service.restart": func(t *testing.T, ctx *rpcContext, window *fakeNativeWindow, launcher *fakeRpcLauncher) {
+		expectRpcResult(t, callRpc(ctx, "service.restart", nil), nil)
+		expectCalls(t, launcher.calls, "restart")
+	},
+}
+
+func TestRpcMethods(t *testing.T) {
+	for name := range launcherRpc {
+		if _, ok := rpcMethodTests[name]; !ok {
+			t.Errorf("%s has no test in rpcMethodTests", name)
+		}
+	}
+	for name, test := range rpcMethodTests {
+		t.Run(name, func(t *testing.T) {
+			withRpcLauncher(t)
+			window := &fakeNativeWindow{}
+			launcher := &fakeRpcLauncher{}
+			test(t, newTestRpcContext(t, window, launcher), window, launcher)
+		})
+	}
+}
+
+// withUpdateChecks() gives the launcher an update scheduler that uses fake
+func withUpdateChecks(t *testing.T, fake *fakeUpdates) {
+	previous := updateChecks
+	t.Cleanup(func() { updateChecks = previous })
+	updateChecks = newTestUpdateScheduler(t, fake)
+}
+
+// withDevicesService() stands in for the service's devices API
+func withDevicesService(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/devices":
+			json.NewEncoder(w).Encode([]PairedDevice{{Id: "ab12", Name: "Tablet"}})
+		case "DELETE /api/devices/ab12":
+			json.NewEncoder(w).Encode([]PairedDevice{})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "No such device"})
+		}
+	}))
+	t.Cleanup(server.Close)
+	url, authToken = server.URL, "secret"
+}
+
+func expectRpcResult(t *testing.T, response RpcResponse, result interface{}) {
+	t.Helper()
+	if response.Error != nil {
+		t.Fatalf("unexpected error %d %s", response.Error.Code, response.Error.Message)
+	}
+	if result != nil {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			t.Fatalf("unexpected result %s (%v)", response.Result, err)
+		}
+	}
+}
+
+func expectRpcError(t *testing.T, response RpcResponse, code int) {
+	t.Helper()
+	if response.Error == nil || response.Error.Code != code {
+		t.Errorf("expected error %d, got %+v (result %s)", code, response.Error, response.Result)
+	}
+}
+
+func expectCalls(t *testing.T, calls []string, expected ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %q, got %q", expected, calls)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/sqweek/dialog"
+)
+
+// pickSaveGameDir() asks the user to find the Journal folder themselves,
+// until they choose a valid one or give up.
+func pickSaveGameDir(startDir string) (SaveGameDir, error) {
+	for {
+		selected, err := dialog.Directory().Title("Select your Elite Dangerous Journal folder").SetStartDir(startDir).Browse()
+		if err != nil {
+			return SaveGameDir{}, err
+		}
+
+		path, err := validateSaveGameDir(selected)
+		if err == nil {
+			return SaveGameDir{path, "user", latestJournal(path)}, nil
+		}
+
+		if !dialog.Message("%s\n\nDo you want to choose another folder?", err.Error()).Title("Not a Journal folder").YesNo() {
+			return SaveGameDir{}, err
+		}
+		startDir = selected
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The Steam app id for Elite Dangerous, used by Proton to name its prefix
+const ELITE_DANGEROUS_STEAM_APP_ID = "359320"
+
+// Where the game writes Journals, relative to a Saved Games folder
+var ELITE_DANGEROUS_SAVE_PATH = filepath.Join("Frontier Developments", "Elite Dangerous")
+
+var ErrSaveGameDirNotFound = errors.New("could not find the Elite Dangerous save game directory")
+
+// saveGameCandidate is a directory that might contain Journals, along with
+// where we heard about it (e.g. "steam") so the UI can explain the choice.
+type saveGameCandidate struct {
+	Path   string
+	Source string
+}
+
+// SaveGameDir is a candidate that exists, with the time of its newest Journal
+// (zero if it doesn't have any)
+type SaveGameDir struct {
+	Path          string    `json:"path"`
+	Source        string    `json:"source"`
+	LatestJournal time.Time `json:"latestJournal"`
+}
+
+// SaveGameDirStatus is what the settings UI is told about the save game
+// directory the service is using
+type SaveGameDirStatus struct {
+	SaveGameDir
+	Valid           bool   `json:"valid"`
+	Error           string `json:"error,omitempty"`
+	RestartRequired bool   `json:"restartRequired"` // The service is using a different directory
+}
+
+// findSaveGameDir() returns the directory the user chose (if it is still
+// valid), otherwise the valid candidate the game has written to most
+// recently. Each platform provides its own saveGameDirCandidates().
+func findSaveGameDir(configured string) (SaveGameDir, error) {
+	var chosen *SaveGameDir
+	if configured != "" {
+		chosen = &SaveGameDir{Path: configured, Source: "config"}
+	}
+	return selectSaveGameDir(chosen, rankSaveGameDirs(saveGameDirCandidates()))
+}
+
+func selectSaveGameDir(configured *SaveGameDir, discovered []SaveGameDir) (SaveGameDir, error) {
+	if configured != nil {
+		path, err := validateSaveGameDir(configured.Path)
+		if err == nil {
+			return SaveGameDir{path, configured.Source, latestJournal(path)}, nil
+		}
+		fmt.Println("Ignoring save game dir", configured.Path, err.Error())
+	}
+	for _, dir := range discovered {
+		if _, err := validateSaveGameDir(dir.Path); err == nil {
+			return dir, nil
+		}
+	}
+	return SaveGameDir{}, ErrSaveGameDirNotFound
+}
+
+// validateSaveGameDir() checks a directory looks like one the game writes
+// to, returning the path to use. Users often pick the Saved Games folder
+// itself, so that (and the Frontier Developments folder) are accepted too.
+func validateSaveGameDir(dir string) (string, error) {
+	if strings.TrimSpace(dir) == "" {
+		return "", errors.New("no directory selected")
+	}
+	for _, path := range []string{filepath.Join(dir, ELITE_DANGEROUS_SAVE_PATH), filepath.Join(dir, filepath.Base(ELITE_DANGEROUS_SAVE_PATH))} {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			dir = path
+			break
+		}
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s does not exist", dir)
+	}
+	if journals, _ := filepath.Glob(filepath.Join(dir, "Journal.*.log")); len(journals) == 0 {
+		return "", fmt.Errorf("%s does not contain any Journal files (Journal.*.log)", dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Status.json")); err != nil {
+		return "", fmt.Errorf("%s does not contain Status.json (start the game at least once)", dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+// saveGameDirStatus() describes dir, compared with the directory the service
+// was started with
+func saveGameDirStatus(dir SaveGameDir, active SaveGameDir) SaveGameDirStatus {
+	status := SaveGameDirStatus{SaveGameDir: dir, RestartRequired: dir.Path != active.Path}
+	if path, err := validateSaveGameDir(dir.Path); err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Path = path
+		status.Valid = true
+		status.LatestJournal = latestJournal(path)
+	}
+	return status
+}
+
+// rankSaveGameDirs() drops candidates that don't exist (or are the same
+// directory as an earlier one) and sorts the rest by their newest Journal, newest first.
+// Directories without any Journals are kept, after those with Journals, in
+// the order they were given.
+func rankSaveGameDirs(candidates []saveGameCandidate) []SaveGameDir {
+	seen := map[string]bool{}
+	ranked := []SaveGameDir{}
+	for _, candidate := range candidates {
+		// ~/.steam/steam is usually a symlink to another Steam root
+		path := filepath.Clean(candidate.Path)
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil || seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			continue
+		}
+		ranked = append(ranked, SaveGameDir{path, candidate.Source, latestJournal(path)})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].LatestJournal.After(ranked[j].LatestJournal)
+	})
+	return ranked
+}
+
+func latestJournal(dir string) time.Time {
+	latest := time.Time{}
+	journals, _ := filepath.Glob(filepath.Join(dir, "Journal.*.log"))
+	for _, journal := range journals {
+		if info, err := os.Stat(journal); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// steamLibraryFolders() returns the libraries listed in a Steam
+// libraryfolders.vdf file. Missing or unreadable files have no libraries.
+func steamLibraryFolders(pathToVdf string) []string {
+	file, err := os.Open(pathToVdf)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	libraries, err := parseLibraryFolders(file)
+	if err != nil {
+		fmt.Println("Unable to parse", pathToVdf, err.Error())
+	}
+	return libraries
+}
+
+// parseLibraryFolders() reads the paths out of libraryfolders.vdf. Newer
+// versions of Steam write an object per library with a "path" key, older
+// versions map the library number directly to its path.
+func parseLibraryFolders(r io.Reader) ([]string, error) {
+	root, err := parseVdf(r)
+	if err != nil {
+		return nil, err
+	}
+
+	folders, ok := root["libraryfolders"].(map[string]interface{})
+	if !ok {
+		// Very old releases of Steam used "LibraryFolders"
+		folders, ok = root["LibraryFolders"].(map[string]interface{})
+	}
+	if !ok {
+		return nil, errors.New("no libraryfolders section")
+	}
+
+	keys := []string{}
+	for key := range folders {
+		if isDigits(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return len(keys[i]) < len(keys[j]) || (len(keys[i]) == len(keys[j]) && keys[i] < keys[j])
+	})
+
+	libraries := []string{}
+	for _, key := range keys {
+		switch library := folders[key].(type) {
+		case string:
+			libraries = append(libraries, library)
+		case map[string]interface{}:
+			if path, ok := library["path"].(string); ok {
+				libraries = append(libraries, path)
+			}
+		}
+	}
+	return libraries, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseVdf() parses Valve's KeyValues text format into nested maps, where
+// each value is either a string or a map[string]interface{}. It handles only
+// what Steam writes to its own config files (quoted keys and values, nested
+// objects and // comments), not conditionals or #include.
+func parseVdf(r io.Reader) (map[string]interface{}, error) {
+	tokens, err := vdfTokens(r)
+	if err != nil {
+		return nil, err
+	}
+	object, rest, err := parseVdfObject(tokens, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected %q", rest[0])
+	}
+	return object, nil
+}
+
+func parseVdfObject(tokens []string, nested bool) (map[string]interface{}, []string, error) {
+	object := map[string]interface{}{}
+	for len(tokens) > 0 {
+		key := tokens[0]
+		if key == "}" {
+			if !nested {
+				return nil, nil, errors.New("unexpected }")
+			}
+			return object, tokens[1:], nil
+		}
+		if key == "{" {
+			return nil, nil, errors.New("unexpected {")
+		}
+		if len(tokens) < 2 {
+			return nil, nil, fmt.Errorf("missing value for %q", key)
+		}
+
+		if tokens[1] == "{" {
+			child, rest, err := parseVdfObject(tokens[2:], true)
+			if err != nil {
+				return nil, nil, err
+			}
+			object[key] = child
+			tokens = rest
+		} else if tokens[1] == "}" {
+			return nil, nil, fmt.Errorf("missing value for %q", key)
+		} else {
+			object[key] = tokens[1]
+			tokens = tokens[2:]
+		}
+	}
+	if nested {
+		return nil, nil, errors.New("missing }")
+	}
+	return object, tokens, nil
+}
+
+// vdfTokens() splits a VDF file into strings (with quotes and escapes
+// removed) and braces
+func vdfTokens(r io.Reader) ([]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s := string(data)
+
+	tokens := []string{}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '{' || c == '}':
+			tokens = append(tokens, string(c))
+		case c == '/' && strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			var token strings.Builder
+			closed := false
+			for i++; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					token.WriteByte(s[i])
+				} else if s[i] == '"' {
+					closed = true
+					break
+				} else {
+					token.WriteByte(s[i])
+				}
+			}
+			if !closed {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, token.String())
+		case unicode.IsSpace(rune(c)):
+		default:
+			// Unquoted tokens are allowed, but Steam doesn't write them
+			start := i
+			for i < len(s) && !unicode.IsSpace(rune(s[i])) && s[i] != '{' && s[i] != '}' && s[i] != '"' {
+				i++
+			}
+			tokens = append(tokens, s[start:i])
+			i--
+		}
+	}
+	return tokens, nil
+}
+
+// protonSaveGameDir() is where Proton keeps the game's Saved Games folder
+// inside a Steam library
+func protonSaveGameDir(library string) string {
+	return filepath.Join(library, "steamapps", "compatdata", ELITE_DANGEROUS_STEAM_APP_ID, "pfx", "drive_c", "users", "steamuser", "Saved Games", ELITE_DANGEROUS_SAVE_PATH)
+}
+
+// wineSaveGameDirs() returns the Saved Games folder of every user in a Wine
+// prefix (Wine names the user after the Linux user, Proton uses "steamuser")
+func wineSaveGameDirs(prefix string) []string {
+	dirs, _ := filepath.Glob(filepath.Join(prefix, "drive_c", "users", "*", "Saved Games", ELITE_DANGEROUS_SAVE_PATH))
+	return dirs
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Where Steam may be installed, relative to the home directory (native
+// package, Debian/Ubuntu package and Flatpak)
+var steamRoots = []string{
+	filepath.Join(".local", "share", "Steam"),
+	filepath.Join(".steam", "steam"),
+	filepath.Join(".steam", "root"),
+	filepath.Join(".var", "app", "com.valvesoftware.Steam", ".local", "share", "Steam"),
+}
+
+// saveGameDirCandidates() looks in the Proton prefix of every Steam library,
+// then in Wine prefixes (the default one, $WINEPREFIX and those Lutris creates
+// under ~/Games).
+func saveGameDirCandidates() []saveGameCandidate {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	candidates := []saveGameCandidate{}
+	for _, root := range steamRoots {
+		root = filepath.Join(home, root)
+		libraries := []string{root}
+		libraries = append(libraries, steamLibraryFolders(filepath.Join(root, "steamapps", "libraryfolders.vdf"))...)
+		libraries = append(libraries, steamLibraryFolders(filepath.Join(root, "config", "libraryfolders.vdf"))...)
+		for _, library := range libraries {
+			candidates = append(candidates, saveGameCandidate{protonSaveGameDir(library), "steam"})
+		}
+	}
+
+	prefixes := []string{filepath.Join(home, ".wine")}
+	if prefix := os.Getenv("WINEPREFIX"); prefix != "" {
+		prefixes = append([]string{prefix}, prefixes...)
+	}
+	lutrisPrefixes, _ := filepath.Glob(filepath.Join(home, "Games", "*"))
+	prefixes = append(prefixes, lutrisPrefixes...)
+	for _, prefix := range prefixes {
+		for _, dir := range wineSaveGameDirs(prefix) {
+			candidates = append(candidates, saveGameCandidate{dir, "wine"})
+		}
+	}
+
+	return candidates
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLibraryFolders(t *testing.T) {
+	tests := []struct {
+		name     string
+		vdf      string
+		expected []string
+		valid    bool
+	}{
+		{
+			name: "current format",
+			vdf: `"libraryfolders"
+{
+	"contentstatsid"		"-1234"
+	"0"
+	{
+		"path"		"/home/cmdr/.local/share/Steam"
+		"label"		""
+		"apps"
+		{
+			"228980"		"0"
+		}
+	}
+	"1"
+	{
+		"path"		"/mnt/games/SteamLibrary" // Second drive
+		"apps"
+		{
+			"359320"		"45121352191"
+		}
+	}
+}`,
+			expected: []string{"/home/cmdr/.local/share/Steam", "/mnt/games/SteamLibrary"},
+			valid:    true,
+		},
+		{
+			name: "legacy format with escapes",
+			vdf: `"LibraryFolders"
+{
+	"TimeNextStatsReport"		"1600000000"
+	"ContentStatsID"		"-1234"
+	"10"		"E:\\Games\\Steam"
+	"2"		"D:\\SteamLibrary"
+}`,
+			expected: []string{`D:\SteamLibrary`, `E:\Games\Steam`},
+			valid:    true,
+		},
+		{name: "empty", vdf: `"libraryfolders" {}`, expected: []string{}, valid: true},
+		{name: "missing section", vdf: `"config" { "a" "b" }`, valid: false},
+		{name: "unterminated string", vdf: `"libraryfolders" { "0" "/home`, valid: false},
+		{name: "missing brace", vdf: `"libraryfolders" { "0" { "path" "/a" }`, valid: false},
+		{name: "missing value", vdf: `"libraryfolders" { "0" }`, valid: false},
+	}
+
+	for _, test := range tests {
+		libraries, err := parseLibraryFolders(strings.NewReader(test.vdf))
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", test.name, libraries)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		} else if !reflect.DeepEqual(libraries, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, libraries)
+		}
+	}
+}
+
+func TestRankSaveGameDirs(t *testing.T) {
+	root, err := ioutil.TempDir("", "savegame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	now := time.Now()
+	writeJournal := func(dir string, name string, modified time.Time) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steam := filepath.Join(root, "steam")
+	wine := filepath.Join(root, "wine")
+	empty := filepath.Join(root, "empty")
+	writeJournal(steam, "Journal.2022-01-01T000000.01.log", now.Add(-48*time.Hour))
+	writeJournal(wine, "Journal.2021-01-01T000000.01.log", now.Add(-72*time.Hour))
+	writeJournal(wine, "Journal.2022-06-01T000000.01.log", now.Add(-1*time.Hour))
+	writeJournal(wine, "Status.json", now) // Not a Journal
+	if err := os.MkdirAll(empty, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ranked := rankSaveGameDirs([]saveGameCandidate{
+		{empty, "knownFolder"},
+		{filepath.Join(root, "missing"), "steam"},
+		{steam, "steam"},
+		{wine, "wine"},
+		{steam + string(filepath.Separator), "steam"}, // Same directory again
+	})
+
+	paths := []string{}
+	for _, dir := range ranked {
+		paths = append(paths, dir.Path)
+	}
+	if expected := []string{wine, steam, empty}; !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+	if ranked[0].Source != "wine" || now.Sub(ranked[0].LatestJournal).Round(time.Hour) != time.Hour {
+		t.Errorf("expected the newest wine Journal, got %+v", ranked[0])
+	}
+	if !ranked[2].LatestJournal.IsZero() {
+		t.Errorf("expected no Journal time for a directory without Journals, got %v", ranked[2].LatestJournal)
+	}
+}
+
+func TestValidateSaveGameDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "savegame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	savedGames := filepath.Join(root, "Saved Games")
+	journalDir := filepath.Join(savedGames, ELITE_DANGEROUS_SAVE_PATH)
+	noStatus := filepath.Join(root, "no-status")
+	for _, dir := range []string{journalDir, noStatus} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		ioutil.WriteFile(filepath.Join(dir, "Journal.2022-01-01T000000.01.log"), []byte("{}"), 0600)
+	}
+	ioutil.WriteFile(filepath.Join(journalDir, "Status.json"), []byte("{}"), 0600)
+
+	tests := []struct {
+		dir      string
+		expected string
+		valid    bool
+	}{
+		{journalDir, journalDir, true},
+		{savedGames, journalDir, true},                                         // Saved Games folder
+		{filepath.Join(savedGames, "Frontier Developments"), journalDir, true}, // Frontier Developments folder
+		{noStatus, "", false},
+		{root, "", false}, // No Journals
+		{filepath.Join(root, "missing"), "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		path, err := validateSaveGameDir(test.dir)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("validateSaveGameDir(%q): expected an error, got %s", test.dir, path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("validateSaveGameDir(%q): unexpected error %v", test.dir, err)
+		} else if path != test.expected {
+			t.Errorf("validateSaveGameDir(%q): expected %s, got %s", test.dir, test.expected, path)
+		}
+	}
+
+	// The user's choice wins over discovered directories while it is valid
+	discovered := []SaveGameDir{{Path: noStatus, Source: "steam"}, {Path: journalDir, Source: "wine"}}
+	if dir, err := selectSaveGameDir(&SaveGameDir{Path: savedGames, Source: "config"}, discovered); err != nil || dir.Source != "config" || dir.Path != journalDir {
+		t.Errorf("expected the configured dir, got %+v (%v)", dir, err)
+	}
+	if dir, err := selectSaveGameDir(&SaveGameDir{Path: noStatus, Source: "config"}, discovered); err != nil || dir.Source != "wine" {
+		t.Errorf("expected the first valid discovered dir, got %+v (%v)", dir, err)
+	}
+	if _, err := selectSaveGameDir(nil, discovered[:1]); err != ErrSaveGameDirNotFound {
+		t.Errorf("expected ErrSaveGameDirNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/sys/windows"
+	"path/filepath"
+)
+
+// savedGamesDir() returns the user's Saved Games folder
+func savedGamesDir() (string, error) {
+	return windows.KnownFolderPath(windows.FOLDERID_SavedGames, 0)
+}
+
+// On Windows the game always uses the Saved Games known folder
+func saveGameDirCandidates() []saveGameCandidate {
+	saveGameDirPath, err := savedGamesDir()
+	if err != nil {
+		fmt.Println("Unable to get Saved Games folder", err.Error())
+		return nil
+	}
+	return []saveGameCandidate{{filepath.Join(saveGameDirPath, ELITE_DANGEROUS_SAVE_PATH), "knownFolder"}}
+}
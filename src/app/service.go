@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"github.com/phayes/freeport"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// How long the service has to keep running for it to count as started
+const serviceStableAfter = 10 * time.Second
+
+// Times in a row the service can stop before becoming stable before the
+// launcher gives up on restarting it
+const maxServiceRestarts = 3
+
+// How often to check if a new service is listening yet
+const serviceReadyPollInterval = 200 * time.Millisecond
+
+// serviceSupervisor runs the service behind the proxy (see proxy.go),
+// starting it again on a new port whenever it stops
+type serviceSupervisor struct {
+	proxy  *serviceProxy
+	output io.Writer // The service's output, discarded if nil
+
+	mutex     sync.Mutex
+	run       *serviceRun
+	restart   bool // The current run is being stopped to restart it
+	stopped   bool // The launcher is exiting
+	wasStable bool // The service has run for at least serviceStableAfter
+}
+
+type serviceRun struct {
+	cmd       *exec.Cmd
+	port      int
+	startedAt time.Time
+	exited    chan struct{}
+}
+
+// startProxiedService() opens the launcher's port and starts the service
+// behind it. control, if not nil, serves the control API on the same port.
+func startProxiedService(output io.Writer, accessLog io.Writer, control http.Handler) error {
+	if authToken == "" {
+		if err := resolveAuthToken(); err != nil {
+			return err
+		}
+	}
+	var certificates *ServiceCertificates
+	if currentLauncherConfig().Https {
+		loaded, err := serviceCertificates()
+		if err != nil {
+			return err
+		}
+		certificates = &loaded
+	}
+	proxy := newServiceProxy(certificates, accessLog)
+	proxy.control = control
+	if _, err := listenForClients(serviceHost(), port, proxy); err != nil {
+		return err
+	}
+	supervisor = newServiceSupervisor(proxy, output)
+	serviceStatusChanged("starting")
+	return supervisor.Start()
+}
+
+func newServiceSupervisor(proxy *serviceProxy, output io.Writer) *serviceSupervisor {
+	return &serviceSupervisor{proxy: proxy, output: output}
+}
+
+// Start() starts the service, returning an error if it can't be run at all
+func (s *serviceSupervisor) Start() error {
+	internalPort, err := freeport.GetFreePort()
+	if err != nil {
+		return err
+	}
+	cmd, err := startService(internalPort, s.output)
+	if err != nil {
+		return err
+	}
+	run := &serviceRun{cmd, internalPort, time.Now(), make(chan struct{})}
+	s.mutex.Lock()
+	s.run = run
+	s.mutex.Unlock()
+	go s.waitUntilReady(run)
+	return nil
+}
+
+// waitUntilReady() sends clients to the service once it is listening, which
+// it only does once it has loaded the Journals
+func (s *serviceSupervisor) waitUntilReady(run *serviceRun) {
+	ticker := time.NewTicker(serviceReadyPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-run.exited:
+			return
+		case <-ticker.C:
+			conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", run.port), serviceReadyPollInterval)
+			if err != nil {
+				continue
+			}
+			conn.Close()
+			s.mutex.Lock()
+			ready := s.run == run
+			if ready {
+				s.proxy.SetBackend(run.port)
+			}
+			s.mutex.Unlock()
+			if ready {
+				serviceStatusChanged("running")
+			}
+			return
+		}
+	}
+}
+
+// Wait() restarts the service whenever it stops, returning the error it
+// stopped with once it has stopped too many times in a row without becoming
+// stable, or nil once Stop() is called
+func (s *serviceSupervisor) Wait() error {
+	failures := 0
+	for {
+		s.mutex.Lock()
+		run := s.run
+		s.mutex.Unlock()
+
+		err := run.cmd.Wait()
+		close(run.exited)
+		s.proxy.SetBackend(0)
+
+		s.mutex.Lock()
+		restart, stopped := s.restart, s.stopped
+		s.restart = false
+		if time.Since(run.startedAt) >= serviceStableAfter {
+			s.wasStable = true
+			failures = 0
+		}
+		s.mutex.Unlock()
+
+		if stopped {
+			serviceStatusChanged("stopped")
+			return nil
+		}
+		if !restart {
+			failures++
+			if err == nil {
+				err = fmt.Errorf("service exited")
+			}
+			if failures > maxServiceRestarts {
+				serviceStatusChanged("failed")
+				return err
+			}
+			fmt.Println("Service stopped unexpectedly, restarting", err.Error())
+			time.Sleep(time.Duration(failures) * time.Second)
+		}
+		serviceStatusChanged("restarting")
+		if err := s.Start(); err != nil {
+			serviceStatusChanged("failed")
+			return err
+		}
+	}
+}
+
+// serviceStatusChanged() lets the UI know, e.g. to say the service is
+// restarting rather than that the connection was lost (see events.go)
+func serviceStatusChanged(status string) {
+	launcherEvents.Publish(EventServiceStatus, serviceStatusPayload{status})
+}
+
+// WasStable() is false if the service never got going, e.g. because it was
+// blocked by antivirus software
+func (s *serviceSupervisor) WasStable() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.wasStable
+}
+
+// Stopped() is whether Stop() has been called, as the launcher is exiting
+func (s *serviceSupervisor) Stopped() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stopped
+}
+
+// Restart() stops the service so Wait() starts it again. Clients get the
+// holding page in the meantime.
+func (s *serviceSupervisor) Restart() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.run == nil || s.stopped {
+		return fmt.Errorf("service is not running")
+	}
+	s.restart = true
+	return s.run.cmd.Process.Kill()
+}
+
+// Stop() stops Wait() restarting the service, which is stopped along with
+// the launcher's other processes
+func (s *serviceSupervisor) Stop() {
+	s.mutex.Lock()
+	s.stopped = true
+	s.mutex.Unlock()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const minTerminalZoom = 0.25
+const maxTerminalZoom = 5.0
+
+// TerminalOptions is how a terminal window opens, from the flags given to the
+// terminal command
+type TerminalOptions struct {
+	Title      string
+	Route      string // Path in the client to open, e.g. /nav/map
+	Placement  windowPlacement
+	Pinned     bool
+	FullScreen bool
+	Zoom       float64 // 1 is 100%
+}
+
+// windowPlacement is where a window goes: on Monitor (numbered from 1, with 0
+// for the primary monitor), either centered or, if Positioned, at X,Y from
+// the top left of the monitor's work area (the screen without the taskbar).
+type windowPlacement struct {
+	Monitor    int
+	Positioned bool
+	X          int32
+	Y          int32
+	Width      int32
+	Height     int32
+}
+
+// screenRect is an area of the desktop, e.g. a monitor's work area
+type screenRect struct {
+	X      int32
+	Y      int32
+	Width  int32
+	Height int32
+}
+
+// parseTerminalOptions() reads the terminal command's flags. The size comes
+// from the launcher config, which --width and --height override (see
+// configFlags), so has already been checked.
+func parseTerminalOptions(flags map[string]string, width int32, height int32) (TerminalOptions, error) {
+	options := TerminalOptions{
+		Title:     profileTitle(TERMINAL_WINDOW_TITLE),
+		Route:     "/",
+		Placement: windowPlacement{Width: width, Height: height},
+		Zoom:      1,
+	}
+	problems := []string{}
+	parseInt := func(name string) int {
+		n, err := strconv.Atoi(strings.TrimSpace(flags[name]))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("--%s must be a whole number (got %q)", name, flags[name]))
+		}
+		return n
+	}
+
+	_, hasX := flags["x"]
+	_, hasY := flags["y"]
+	if hasX != hasY {
+		problems = append(problems, "--x and --y must be given together")
+	} else if hasX {
+		options.Placement.Positioned = true
+		options.Placement.X = int32(parseInt("x"))
+		options.Placement.Y = int32(parseInt("y"))
+	}
+
+	if _, ok := flags["monitor"]; ok {
+		if options.Placement.Monitor = parseInt("monitor"); options.Placement.Monitor < 0 {
+			problems = append(problems, fmt.Sprintf("--monitor must be 1 or more, or 0 for the primary monitor (got %d)", options.Placement.Monitor))
+		}
+	}
+
+	if route, ok := flags["route"]; ok {
+		if !strings.HasPrefix(route, "/") || strings.HasPrefix(route, "//") {
+			problems = append(problems, fmt.Sprintf("--route must be a path starting with / (got %q)", route))
+		} else {
+			options.Route = route
+		}
+	}
+
+	if title := strings.TrimSpace(flags["title"]); title != "" {
+		options.Title = title
+	}
+
+	options.Pinned, _ = strconv.ParseBool(flags["pinned"])
+	options.FullScreen, _ = strconv.ParseBool(flags["fullscreen"])
+	if options.Pinned && options.FullScreen {
+		problems = append(problems, "--pinned and --fullscreen can't be used together")
+	}
+
+	if text, ok := flags["zoom"]; ok {
+		zoom, err := parseZoom(text)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		options.Zoom = zoom
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return options, &ConfigError{ConfigSourceFlag, problems}
+	}
+	return options, nil
+}
+
+// parseZoom() accepts a scale factor (1.5) or a percentage (150%)
+func parseZoom(text string) (float64, error) {
+	text = strings.TrimSpace(text)
+	scale := 1.0
+	if strings.HasSuffix(text, "%") {
+		text = strings.TrimSuffix(text, "%")
+		scale = 100
+	}
+	zoom, err := strconv.ParseFloat(text, 64)
+	zoom /= scale
+	if err != nil || zoom < minTerminalZoom || zoom > maxTerminalZoom {
+		return 1, fmt.Errorf("--zoom must be between %g and %g, e.g. 1.5 or 150%% (got %q)", minTerminalZoom, maxTerminalZoom, text)
+	}
+	return zoom, nil
+}
+
+// InitialState is the window mode the terminal starts in
+func (o TerminalOptions) InitialState() WindowState {
+	state := NewWindowState()
+	if o.FullScreen {
+		state.Mode = WindowModeFullScreen
+	} else if o.Pinned {
+		state.Mode = WindowModePinned
+	}
+	return state
+}
+
+// ZoomScript is run on every page the terminal loads, as the webview library
+// has no zoom setting of its own
+func (o TerminalOptions) ZoomScript() string {
+	if o.Zoom == 1 {
+		return ""
+	}
+	return fmt.Sprintf("document.addEventListener('DOMContentLoaded', function () { document.documentElement.style.zoom = '%g' })", o.Zoom)
+}
+
+// flags returns the terminal command flags that parseTerminalOptions() reads
+// back as the same options
+func (o TerminalOptions) flags() map[string]string {
+	flags := map[string]string{
+		"title":  o.Title,
+		"route":  o.Route,
+		"width":  strconv.Itoa(int(o.Placement.Width)),
+		"height": strconv.Itoa(int(o.Placement.Height)),
+		"zoom":   strconv.FormatFloat(o.Zoom, 'g', -1, 64),
+	}
+	if o.Placement.Monitor != 0 {
+		flags["monitor"] = strconv.Itoa(o.Placement.Monitor)
+	}
+	if o.Placement.Positioned {
+		flags["x"] = strconv.Itoa(int(o.Placement.X))
+		flags["y"] = strconv.Itoa(int(o.Placement.Y))
+	}
+	if o.Pinned {
+		flags["pinned"] = "true"
+	}
+	if o.FullScreen {
+		flags["fullscreen"] = "true"
+	}
+	return flags
+}
+
+// placeInArea() returns where the top left of a window goes in area. Windows
+// are kept inside the area where they fit, so a saved position from a larger
+// monitor doesn't put a window off screen.
+func placeInArea(area screenRect, placement windowPlacement) (int32, int32) {
+	x := area.X + (area.Width-placement.Width)/2
+	y := area.Y + (area.Height-placement.Height)/2
+	if placement.Positioned {
+		x = clampToArea(area.X+placement.X, area.X, area.Width, placement.Width)
+		y = clampToArea(area.Y+placement.Y, area.Y, area.Height, placement.Height)
+	}
+	return x, y
+}
+
+func clampToArea(position int32, start int32, length int32, size int32) int32 {
+	if position > start+length-size {
+		position = start + length - size
+	}
+	if position < start {
+		position = start
+	}
+	return position
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseTerminalOptions(t *testing.T) {
+	options, err := parseTerminalOptions(map[string]string{}, 1280, 860)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if options.Route != "/" || options.Zoom != 1 || options.Placement.Positioned || options.InitialState() != NewWindowState() {
+		t.Errorf("expected a centered, normal window at the root, got %+v", options)
+	}
+	if options.Placement.Width != 1280 || options.Placement.Height != 860 {
+		t.Errorf("expected the size to be passed through, got %+v", options.Placement)
+	}
+	if options.ZoomScript() != "" {
+		t.Errorf("expected no zoom script at 100%%, got %q", options.ZoomScript())
+	}
+
+	options, err = parseTerminalOptions(map[string]string{
+		"x":       "100",
+		"y":       "-20",
+		"monitor": "2",
+		"route":   "/nav/map",
+		"pinned":  "true",
+		"zoom":    "150%",
+	}, 800, 600)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := windowPlacement{Monitor: 2, Positioned: true, X: 100, Y: -20, Width: 800, Height: 600}
+	if options.Placement != expected {
+		t.Errorf("expected %+v, got %+v", expected, options.Placement)
+	}
+	if options.Route != "/nav/map" || options.Zoom != 1.5 || !options.InitialState().IsPinned() {
+		t.Errorf("unexpected options %+v", options)
+	}
+	if !strings.Contains(options.ZoomScript(), "zoom = '1.5'") {
+		t.Errorf("expected a zoom script, got %q", options.ZoomScript())
+	}
+
+	options, _ = parseTerminalOptions(map[string]string{"fullscreen": "true", "zoom": "0.5"}, 800, 600)
+	if !options.InitialState().IsFullScreen() || options.Zoom != 0.5 {
+		t.Errorf("expected fullscreen at 50%%, got %+v", options)
+	}
+}
+
+func TestParseTerminalOptionsErrors(t *testing.T) {
+	_, err := parseTerminalOptions(map[string]string{
+		"x":          "100",
+		"monitor":    "-1",
+		"route":      "https://example.com",
+		"pinned":     "true",
+		"fullscreen": "true",
+		"zoom":       "10",
+	}, 800, 600)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 5 {
+		t.Fatalf("expected five problems, got %v", err)
+	}
+
+	_, err = parseTerminalOptions(map[string]string{"x": "left", "y": "1"}, 800, 600)
+	if err == nil || !strings.Contains(err.Error(), "--x must be a whole number") {
+		t.Errorf("expected --x to be reported, got %v", err)
+	}
+}
+
+func TestPlaceInArea(t *testing.T) {
+	secondMonitor := screenRect{X: 1920, Y: 0, Width: 1920, Height: 1040}
+	tests := []struct {
+		placement windowPlacement
+		x, y      int32
+	}{
+		{windowPlacement{Width: 800, Height: 600}, 2480, 220},                                    // Centered
+		{windowPlacement{Positioned: true, X: 10, Y: 20, Width: 800, Height: 600}, 1930, 20},     // Relative to the monitor
+		{windowPlacement{Positioned: true, X: 1500, Y: 900, Width: 800, Height: 600}, 3040, 440}, // Kept on screen
+		{windowPlacement{Positioned: true, X: -50, Y: -50, Width: 800, Height: 600}, 1920, 0},
+		{windowPlacement{Positioned: true, X: 10, Y: 10, Width: 2560, Height: 1440}, 1920, 0}, // Too big to fit
+	}
+	for _, test := range tests {
+		if x, y := placeInArea(secondMonitor, test.placement); x != test.x || y != test.y {
+			t.Errorf("%+v: expected %d,%d, got %d,%d", test.placement, test.x, test.y, x, y)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Layouts cycled through by the cycleLayout hotkey
+var terminalLayouts = []string{"tileVertical", "tileHorizontal", "cascade"}
+
+// Terminal processes started by this launcher, so the launcher can act on
+// their windows (e.g. to show or hide all of them from a global hotkey)
+var terminals = struct {
+	sync.Mutex
+	pids        map[int]bool
+	opened      []int                   // The pids in the order the terminals were opened
+	options     map[int]TerminalOptions // What each terminal was opened with
+	hidden      bool
+	layoutIndex int
+}{pids: map[int]bool{}, options: map[int]TerminalOptions{}, layoutIndex: -1}
+
+// NewWindowOptions is what the UI can ask for when opening a terminal (see
+// terminals.open in rpc-methods.go). Anything left out uses the defaults.
+type NewWindowOptions struct {
+	Route  string `json:"route"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Pinned bool   `json:"pinned"`
+	Title  string `json:"title"`
+}
+
+// flags returns the terminal command flags for the options
+func (o NewWindowOptions) flags() map[string]string {
+	flags := map[string]string{}
+	if o.Route != "" {
+		flags["route"] = o.Route
+	}
+	if o.Width != 0 {
+		flags["width"] = strconv.Itoa(o.Width)
+	}
+	if o.Height != 0 {
+		flags["height"] = strconv.Itoa(o.Height)
+	}
+	if o.Pinned {
+		flags["pinned"] = "true"
+	}
+	if o.Title != "" {
+		flags["title"] = o.Title
+	}
+	return flags
+}
+
+// terminalArgs() returns the command line for a terminal process, given the
+// terminal command's flags (other than --port, which is always this
+// launcher's). The flags are checked the same way the terminal will, so that
+// mistakes are reported to the caller rather than in a dialog from the new
+// process.
+func terminalArgs(flags map[string]string) ([]string, TerminalOptions, error) {
+	size := currentLauncherConfig()
+	size.WindowWidth = int(windowWidth)
+	size.WindowHeight = int(windowHeight)
+	for flag, key := range map[string]string{"width": "windowWidth", "height": "windowHeight"} {
+		if text, ok := flags[flag]; ok {
+			if err := size.Set(key, text); err != nil {
+				return nil, TerminalOptions{}, err
+			}
+		}
+	}
+	if err := size.Validate(); err != nil {
+		return nil, TerminalOptions{}, err
+	}
+	options, err := parseTerminalOptions(flags, int32(size.WindowWidth), int32(size.WindowHeight))
+	if err != nil {
+		return nil, options, err
+	}
+
+	// The terminal is for this launcher's service and profile
+	args := []string{"terminal", fmt.Sprintf("--port=%d", port)}
+	if activeProfile != DEFAULT_PROFILE {
+		args = append(args, "--profile="+activeProfile)
+	}
+	names := []string{}
+	for name := range flags {
+		if name != "port" && name != "profile" && name != "instance" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("--%s=%s", name, flags[name]))
+	}
+	return args, options, nil
+}
+
+// openTerminal() starts a new terminal window in its own process, returning
+// its process id. flags are as given to the terminal command, and may be nil.
+func openTerminal(flags map[string]string) (int, error) {
+	args, options, err := terminalArgs(flags)
+	if err != nil {
+		return 0, err
+	}
+	terminalCmdInstance := exec.Command(filepath.Join(dirname, TERMINAL_EXECUTABLE), args...)
+	terminalCmdInstance.Dir = dirname
+	terminalCmdInstance.Env = authTokenEnv()
+	if err := terminalCmdInstance.Start(); err != nil {
+		return 0, err
+	}
+
+	// Add process to process group so all windows close when main process ends
+	processGroup.AddProcess(terminalCmdInstance.Process)
+
+	pid := terminalCmdInstance.Process.Pid
+	terminals.Lock()
+	terminals.pids[pid] = true
+	terminals.opened = append(terminals.opened, pid)
+	terminals.options[pid] = options
+	terminals.Unlock()
+	terminalsChanged()
+
+	go func() {
+		terminalCmdInstance.Wait()
+		// Code here will execute when window closes
+		terminals.Lock()
+		delete(terminals.pids, pid)
+		delete(terminals.options, pid)
+		for i, openedPid := range terminals.opened {
+			if openedPid == pid {
+				terminals.opened = append(terminals.opened[:i], terminals.opened[i+1:]...)
+				break
+			}
+		}
+		terminals.Unlock()
+		terminalsChanged()
+	}()
+
+	return pid, nil
+}
+
+// openRoute() focuses a terminal that was opened at route, or opens a new one.
+// It must be called from the UI thread.
+func openRoute(route string) error {
+	terminals.Lock()
+	pids := []int{}
+	for pid, options := range terminals.options {
+		if options.Route == route {
+			pids = append(pids, pid)
+		}
+	}
+	terminals.Unlock()
+	sort.Ints(pids)
+
+	for _, pid := range pids {
+		if focusTerminalWindow(pid) {
+			return nil
+		}
+	}
+	_, err := openTerminal(map[string]string{"route": route})
+	return err
+}
+
+func terminalPids() []int {
+	terminals.Lock()
+	defer terminals.Unlock()
+	pids := []int{}
+	for pid := range terminals.pids {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+// terminalLayout() returns what each terminal was opened with, in the order
+// they were opened, updated to where their windows are now
+func terminalLayout() ([]TerminalOptions, error) {
+	terminals.Lock()
+	pids := append([]int{}, terminals.opened...)
+	opened := make([]TerminalOptions, len(pids))
+	for i, pid := range pids {
+		opened[i] = terminals.options[pid]
+	}
+	terminals.Unlock()
+
+	// Finding the windows has to be done on the UI thread, which fills in its
+	// own copy in case it only gets to it after onUIThread() has given up
+	layout := make([]TerminalOptions, len(pids))
+	if err := onUIThread(func() error {
+		for i, pid := range pids {
+			layout[i] = currentTerminalWindow(pid, opened[i])
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return layout, nil
+}
+
+func toggleTerminalsVisible() {
+	terminals.Lock()
+	terminals.hidden = !terminals.hidden
+	visible := !terminals.hidden
+	terminals.Unlock()
+	setTerminalWindowsVisible(terminalPids(), visible)
+}
+
+func toggleTerminalsOverlay() {
+	toggleTerminalWindowsOverlay(terminalPids())
+}
+
+func toggleTerminalsClickThrough() {
+	toggleTerminalWindowsClickThrough(terminalPids())
+}
+
+func cycleTerminalLayout() {
+	terminals.Lock()
+	terminals.layoutIndex = (terminals.layoutIndex + 1) % len(terminalLayouts)
+	layout := terminalLayouts[terminals.layoutIndex]
+	terminals.Unlock()
+	arrangeTerminalWindows(terminalPids(), layout)
+}
+
+// launcherHotkeyHandlers maps each hotkey action to what the launcher does
+func launcherHotkeyHandlers() map[HotkeyAction]func() {
+	return map[HotkeyAction]func(){
+		HotkeyToggleTerminals:    toggleTerminalsVisible,
+		HotkeyToggleOverlay:      toggleTerminalsOverlay,
+		HotkeyCycleLayout:        cycleTerminalLayout,
+		HotkeyToggleClickThrough: toggleTerminalsClickThrough,
+		HotkeyNewTerminal: func() {
+			if _, err := openTerminal(nil); err != nil {
+				fmt.Println("Opening new terminal failed", err.Error())
+			}
+		},
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"github.com/webview/webview"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerminalArgs(t *testing.T) {
+	port = 3300
+	windowWidth, windowHeight = defaultWindowWidth, defaultWindowHeight
+
+	args, _, err := terminalArgs(NewWindowOptions{}.flags())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := []string{"terminal", "--port=3300"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+
+	args, _, err = terminalArgs(NewWindowOptions{Route: "/ship/status", Width: 800, Pinned: true, Title: "Ship"}.flags())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{"terminal", "--port=3300", "--pinned=true", "--route=/ship/status", "--title=Ship", "--width=800"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+
+	// The terminal command must accept what the launcher passes it
+	invocation, err := parseCommandLine(args)
+	if err != nil {
+		t.Fatalf("unexpected error parsing %v: %v", args, err)
+	}
+	options, err := parseTerminalOptions(invocation.Flags, 800, defaultWindowHeight)
+	if err != nil || options.Route != "/ship/status" || options.Title != "Ship" || !options.Pinned {
+		t.Errorf("expected the options to survive the command line, got %+v (%v)", options, err)
+	}
+
+	if _, _, err := terminalArgs(NewWindowOptions{Route: "nav"}.flags()); err == nil || !strings.Contains(err.Error(), "--route") {
+		t.Errorf("expected an invalid route to be reported, got %v", err)
+	}
+	if _, _, err := terminalArgs(NewWindowOptions{Width: 100}.flags()); err == nil || !strings.Contains(err.Error(), "windowWidth") {
+		t.Errorf("expected a window that is too small to be reported, got %v", err)
+	}
+}
+
+func TestTerminalArgsUseLauncher(t *testing.T) {
+	port = 3300
+	windowWidth, windowHeight = defaultWindowWidth, defaultWindowHeight
+	activeProfile = "alt"
+	defer func() { activeProfile = DEFAULT_PROFILE }()
+
+	// A second launch's port and profile are for a service that isn't running
+	args, options, err := terminalArgs(map[string]string{"port": "4000", "profile": "other", "instance": "other", "zoom": "150%"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := []string{"terminal", "--port=3300", "--profile=alt", "--zoom=150%"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+	if expected := TERMINAL_WINDOW_TITLE + " (alt)"; options.Title != expected {
+		t.Errorf("expected the title %q, got %q", expected, options.Title)
+	}
+}
+
+// stuckWebView never runs what is dispatched to it, like a window that is closing
+type stuckWebView struct {
+	webview.WebView
+}
+
+func (stuckWebView) Dispatch(f func()) {}
+
+func TestTerminalLayoutWhenUIThreadIsStuck(t *testing.T) {
+	previousWebView, previousTimeout := webViewInstance, uiThreadTimeout
+	t.Cleanup(func() { webViewInstance, uiThreadTimeout = previousWebView, previousTimeout })
+	webViewInstance, uiThreadTimeout = stuckWebView{}, 10*time.Millisecond
+
+	if layout, err := terminalLayout(); !errors.Is(err, ErrUIThreadTimeout) || layout != nil {
+		t.Errorf("expected to give up waiting for the UI thread, got %v %v", layout, err)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os/exec"
+)
+
+// There is no tray icon on Linux (the StatusNotifierItem protocol needs a
+// D-Bus client), so close/minimise to tray settings have no effect.
+func removeTrayIcon() {}
+
+// showTrayNotification() uses notify-send, which is installed by default on
+// most desktops, and does nothing if it is missing.
+func showTrayNotification(title string, message string) {
+	exec.Command("notify-send", "--app-name="+LAUNCHER_WINDOW_TITLE, title, message).Start()
+}
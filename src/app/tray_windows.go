@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nvsoft/win"
+	"syscall"
+	"unsafe"
+)
+
+// Not defined in github.com/nvsoft/win
+const MF_STRING = 0x00000000
+const MF_SEPARATOR = 0x00000800
+
+// Sent to the launcher window by the shell for mouse events on the tray icon
+const WM_ICARUS_TRAY = win.WM_APP + 2
+const TRAY_ICON_ID = 1
+
+const (
+	TRAY_MENU_OPEN_LAUNCHER = iota + 1
+	TRAY_MENU_NEW_TERMINAL
+	TRAY_MENU_OPEN_IN_BROWSER
+	TRAY_MENU_CHECK_FOR_UPDATE
+	TRAY_MENU_QUIT
+)
+
+var procAppendMenu = user32.NewProc("AppendMenuW")
+
+// Sent by Explorer when the taskbar is recreated (e.g. after it crashes) at
+// which point every application needs to add its tray icon again.
+var wmTaskbarCreated = win.RegisterWindowMessage(syscall.StringToUTF16Ptr("TaskbarCreated"))
+
+var trayIcon *win.NOTIFYICONDATA
+
+func addTrayIcon(hwnd win.HWND) error {
+	nid := win.NOTIFYICONDATA{}
+	nid.CbSize = uint32(unsafe.Sizeof(nid))
+	nid.HWnd = hwnd
+	nid.UID = TRAY_ICON_ID
+	nid.UFlags = win.NIF_ICON | win.NIF_MESSAGE | win.NIF_TIP
+	nid.UCallbackMessage = WM_ICARUS_TRAY
+	nid.HIcon = win.HICON(win.LoadImage(0, syscall.StringToUTF16Ptr(ICON), win.IMAGE_ICON, 32, 32, win.LR_LOADFROMFILE|win.LR_SHARED|win.LR_LOADTRANSPARENT))
+	copy(nid.SzTip[:len(nid.SzTip)-1], syscall.StringToUTF16(LAUNCHER_WINDOW_TITLE))
+
+	if !win.Shell_NotifyIcon(win.NIM_ADD, &nid) {
+		return fmt.Errorf("Shell_NotifyIcon failed: %d", win.GetLastError())
+	}
+	nid.UVersion = win.NOTIFYICON_VERSION
+	win.Shell_NotifyIcon(win.NIM_SETVERSION, &nid)
+
+	trayIcon = &nid
+	return nil
+}
+
+func removeTrayIcon() {
+	if trayIcon == nil {
+		return
+	}
+	win.Shell_NotifyIcon(win.NIM_DELETE, trayIcon)
+	trayIcon = nil
+}
+
+// showTrayNotification() displays a balloon (or toast, on Windows 10 and
+// newer) notification from the tray icon. It does nothing if there is no icon.
+func showTrayNotification(title string, message string) {
+	if trayIcon == nil {
+		return
+	}
+	nid := *trayIcon
+	nid.UFlags = win.NIF_INFO
+	nid.DwInfoFlags = win.NIIF_INFO
+	copy(nid.SzInfoTitle[:len(nid.SzInfoTitle)-1], syscall.StringToUTF16(title))
+	copy(nid.SzInfo[:len(nid.SzInfo)-1], syscall.StringToUTF16(message))
+	win.Shell_NotifyIcon(win.NIM_MODIFY, &nid)
+}
+
+func showLauncherWindow(hwnd win.HWND) {
+	win.ShowWindow(hwnd, win.SW_SHOW)
+	win.ShowWindow(hwnd, win.SW_RESTORE)
+	win.SetForegroundWindow(hwnd)
+}
+
+// handleTrayMessage() is called from WndProc for WM_ICARUS_TRAY messages
+func handleTrayMessage(hwnd win.HWND, lParam uintptr) {
+	switch uint32(lParam) {
+	case win.WM_LBUTTONDBLCLK:
+		showLauncherWindow(hwnd)
+	case win.WM_RBUTTONUP, win.WM_CONTEXTMENU:
+		showTrayMenu(hwnd)
+	}
+}
+
+func showTrayMenu(hwnd win.HWND) {
+	menu := win.CreatePopupMenu()
+	defer win.DestroyMenu(menu)
+
+	appendMenuItem(menu, TRAY_MENU_OPEN_LAUNCHER, "Open Launcher")
+	appendMenuItem(menu, TRAY_MENU_NEW_TERMINAL, "New Terminal")
+	appendMenuItem(menu, TRAY_MENU_OPEN_IN_BROWSER, "Open in Browser")
+	procAppendMenu.Call(uintptr(menu), MF_SEPARATOR, 0, 0)
+	appendMenuItem(menu, TRAY_MENU_CHECK_FOR_UPDATE, "Check for Updates")
+	procAppendMenu.Call(uintptr(menu), MF_SEPARATOR, 0, 0)
+	appendMenuItem(menu, TRAY_MENU_QUIT, "Quit")
+
+	var pt win.POINT
+	win.GetCursorPos(&pt)
+
+	// The window must be in the foreground or the menu won't close when the
+	// user clicks somewhere else
+	win.SetForegroundWindow(hwnd)
+	selected := win.TrackPopupMenuEx(menu, win.TPM_RETURNCMD|win.TPM_RIGHTBUTTON, pt.X, pt.Y, hwnd, nil)
+
+	switch selected {
+	case TRAY_MENU_OPEN_LAUNCHER:
+		showLauncherWindow(hwnd)
+	case TRAY_MENU_NEW_TERMINAL:
+		if _, err := openTerminal(nil); err != nil {
+			fmt.Println("Opening new terminal failed", err.Error())
+		}
+	case TRAY_MENU_OPEN_IN_BROWSER:
+		runUnelevated(browserLink(url))
+	case TRAY_MENU_CHECK_FOR_UPDATE:
+		go func() {
+			title, message := "", ""
+			release, err := GetLatestRelease()
+			switch {
+			case err != nil:
+				title, message = "Unable to check for updates", err.Error()
+			case release.IsUpgrade:
+				title, message = "New version available", fmt.Sprintf("ICARUS Terminal %s is available. Open the launcher to install it.", release.ProductVersion)
+			default:
+				title, message = "No updates available", fmt.Sprintf("ICARUS Terminal %s is the latest version.", release.InstalledVersion)
+			}
+			// Back to the UI thread, which owns the tray icon
+			webViewInstance.Dispatch(func() {
+				showTrayNotification(title, message)
+			})
+		}()
+	case TRAY_MENU_QUIT:
+		exitApplication(0)
+	}
+}
+
+func appendMenuItem(menu win.HMENU, id int, label string) {
+	procAppendMenu.Call(uintptr(menu), MF_STRING, uintptr(id), uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(label))))
+}
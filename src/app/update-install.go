@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How an update is installed, chosen when asking for it (see app.installUpdate
+// in rpc-methods.go and update/install in control.go)
+const (
+	InstallNow    = "now"    // Quit cleanly, then run the installer
+	InstallOnExit = "onExit" // Run the installer whenever the launcher next quits
+	InstallSilent = "silent" // As now, but without the installer's UI, reopening the same terminals afterwards
+)
+
+// The terminals that were open when the launcher quit for a silent install,
+// kept in the profile's directory until the launcher next starts
+const LAYOUT_FILE = "Layout.json"
+
+// How long quitting for the installer waits for terminals to close themselves
+// before they are ended along with the launcher
+const terminalsCloseTimeout = 5 * time.Second
+
+// parseInstallStrategy() checks strategy is one of the above, defaulting to
+// InstallNow
+func parseInstallStrategy(strategy string) (string, error) {
+	switch strategy {
+	case "":
+		return InstallNow, nil
+	case InstallNow, InstallOnExit, InstallSilent:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("%w: unknown install strategy %q (expected %s, %s or %s)", ErrInvalidRequest, strategy, InstallNow, InstallOnExit, InstallSilent)
+}
+
+// savedLayout is what LAYOUT_FILE holds
+type savedLayout struct {
+	Windows []map[string]string `json:"windows"` // Each terminal's flags, in the order they were opened
+}
+
+// saveLayout() saves the terminals' options, as returned by terminalLayout()
+func saveLayout(path string, layout []TerminalOptions) error {
+	saved := savedLayout{Windows: []map[string]string{}}
+	for _, options := range layout {
+		saved.Windows = append(saved.Windows, options.flags())
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// takeLayout() reads the layout saved at path and removes it, so it is only
+// restored once. It returns each terminal's flags, or none if there isn't one.
+func takeLayout(path string) ([]map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	os.Remove(path)
+	var saved savedLayout
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	return saved.Windows, nil
+}
+
+// restoreLayout() reopens the terminals that were open before the launcher
+// quit for a silent install. The installer starts the default profile's
+// launcher, so other profiles get theirs back when they are next opened.
+func restoreLayout() {
+	dir, err := profileDir(activeProfile)
+	if err != nil {
+		return
+	}
+	windows, err := takeLayout(filepath.Join(dir, LAYOUT_FILE))
+	if err != nil {
+		fmt.Println("Unable to restore", LAYOUT_FILE, err.Error())
+	}
+	for _, flags := range windows {
+		if _, err := openTerminal(flags); err != nil {
+			// e.g. the window was made smaller than terminals can be opened at
+			fmt.Println("Unable to reopen", flags["route"], "as it was", err.Error())
+			if _, err := openTerminal(map[string]string{"route": flags["route"]}); err != nil {
+				fmt.Println("Unable to reopen", flags["route"], err.Error())
+			}
+		}
+	}
+}
+
+// quitForInstaller() asks the terminals to close, so they can do it cleanly,
+// then quits the launcher, which stops the service and runs the installer
+// (see exitApplication and installIfAgreed)
+func quitForInstaller() {
+	for _, pid := range terminalPids() {
+		closeTerminalWindow(pid)
+	}
+	deadline := time.Now().Add(terminalsCloseTimeout)
+	for len(terminalPids()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	exitApplication(exitOK)
+}
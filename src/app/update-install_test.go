@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseInstallStrategy(t *testing.T) {
+	tests := map[string]string{"": InstallNow, "now": InstallNow, "onExit": InstallOnExit, "silent": InstallSilent}
+	for text, expected := range tests {
+		if strategy, err := parseInstallStrategy(text); err != nil || strategy != expected {
+			t.Errorf("%q: expected %s, got %s %v", text, expected, strategy, err)
+		}
+	}
+	for _, text := range []string{"later", "Silent", "/S"} {
+		if _, err := parseInstallStrategy(text); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("%q: expected an invalid request, got %v", text, err)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, LAYOUT_FILE)
+
+	if windows, err := takeLayout(path); err != nil || windows != nil {
+		t.Errorf("expected no layout before one is saved, got %v %v", windows, err)
+	}
+	layout := []TerminalOptions{
+		{Title: "Status", Route: "/ship/status", Placement: windowPlacement{Monitor: 2, Positioned: true, X: 10, Y: -5, Width: 800, Height: 600}, Pinned: true, Zoom: 1.25},
+		{Title: "Map", Route: "/nav/map", Placement: windowPlacement{Width: 1280, Height: 860}, FullScreen: true, Zoom: 1},
+	}
+	if err := saveLayout(path, layout); err != nil {
+		t.Fatal(err)
+	}
+	windows, err := takeLayout(path)
+	if err != nil || len(windows) != len(layout) {
+		t.Fatalf("unexpected layout %v %v", windows, err)
+	}
+	// Each terminal is reopened in order, as it was
+	for i, flags := range windows {
+		_, options, err := terminalArgs(flags)
+		if err != nil || !reflect.DeepEqual(options, layout[i]) {
+			t.Errorf("expected %+v, got %+v %v", layout[i], options, err)
+		}
+	}
+	if windows, _ := takeLayout(path); windows != nil {
+		t.Errorf("expected the layout to only be restored once, got %v", windows)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The launcher checks for updates in the background, soon after it starts and
+// then every updateCheckHours, unless checkForUpdates is turned off (see
+// LauncherConfig). When one is found it tells the UI (with update.progress
+// events, see events.go) and the user (with a notification), and downloads it
+// straight away if downloadUpdates is on. The user can then have it installed
+// now or when they next quit (see update-install.go).
+const UPDATE_STATE_FILE = "Updates.json"
+
+const defaultUpdateCheckHours = 24
+const maxUpdateCheckHours = 24 * 7
+
+// How long after starting the first check waits, so it doesn't slow down
+// starting the service and the launcher's window is there to notify from
+const updateCheckStartDelay = 30 * time.Second
+
+// How often the scheduler looks at whether a check is due, so that changes to
+// the settings and waking from sleep are noticed
+const updateSchedulerTick = time.Minute
+
+var (
+	ErrNoUpdate               = errors.New("there is no update to install")
+	ErrUpdatesUnsupported     = errors.New("updates are not installed by the launcher on this platform")
+	ErrUpdateChecksNotRunning = errors.New("update checks are not running")
+	errUpdateCheckInFlight    = errors.New("already checking for updates")
+)
+
+// updateState is kept between runs, so restarting the launcher doesn't check
+// again (GitHub only allows 60 requests an hour without a token) or notify
+// about the same release twice
+type updateState struct {
+	LastCheck       time.Time `json:"lastCheck"`
+	RetryAfter      time.Time `json:"retryAfter"`      // When GitHub's rate limit resets
+	NotifiedVersion string    `json:"notifiedVersion"` // The last release the user was notified about
+}
+
+// UpdateStatus is what the UI is told about updates
+type UpdateStatus struct {
+	Enabled       bool       `json:"enabled"`
+	LastCheck     *time.Time `json:"lastCheck"` // null if never checked
+	NextCheck     *time.Time `json:"nextCheck"` // null if checks are off
+	Checking      bool       `json:"checking"`
+	Release       *Release   `json:"release"` // The newer release, if there is one
+	Downloaded    bool       `json:"downloaded"`
+	InstallOnQuit bool       `json:"installOnQuit"`
+	CanInstall    bool       `json:"canInstall"` // Whether the launcher can install releases here
+	Error         string     `json:"error"`      // Why the last check failed
+}
+
+type updateScheduler struct {
+	statePath     string
+	latestRelease func() (Release, error)
+	download      func(Release) (string, error)
+	notify        func(title string, message string)
+	now           func() time.Time
+	layout        func() ([]TerminalOptions, error) // The terminals, saved for silent installs
+	quit          func()                            // Quits the launcher for the installer
+	install       func(installerPath string, silent bool)
+
+	mutex           sync.Mutex
+	state           updateState
+	checking        bool
+	release         *Release
+	installerPath   string
+	installStrategy string // How to install as the launcher quits, "" if it shouldn't
+	lastError       string
+
+	downloading sync.Mutex // Held while downloading, so only one download runs
+}
+
+// updateChecks is the launcher's scheduler, nil in other processes
+var updateChecks *updateScheduler
+
+func newUpdateScheduler(statePath string) *updateScheduler {
+	s := &updateScheduler{
+		statePath:     statePath,
+		latestRelease: GetLatestRelease,
+		download:      DownloadUpdate,
+		notify:        notifyUpdate,
+		now:           time.Now,
+		layout:        terminalLayout,
+		quit:          quitForInstaller,
+		install:       runInstaller,
+	}
+	if data, err := ioutil.ReadFile(statePath); err == nil {
+		json.Unmarshal(data, &s.state)
+	}
+	return s
+}
+
+// startUpdateChecks() starts checking for updates in the background
+func startUpdateChecks() {
+	dir, err := profileDir(activeProfile)
+	if err != nil {
+		fmt.Println("Unable to check for updates", err.Error())
+		return
+	}
+	updateChecks = newUpdateScheduler(filepath.Join(dir, UPDATE_STATE_FILE))
+	go updateChecks.Run()
+}
+
+// Run() checks whenever a check is due, reading the settings each time so
+// changes to them apply straight away. It runs in its own goroutine.
+func (s *updateScheduler) Run() {
+	time.Sleep(updateCheckStartDelay)
+	for {
+		if config := currentLauncherConfig(); config.CheckForUpdates && s.Due(config) {
+			s.Check(config)
+		}
+		time.Sleep(updateSchedulerTick)
+	}
+}
+
+// nextCheck() must be called with the mutex held
+func (s *updateScheduler) nextCheck(config LauncherConfig) time.Time {
+	next := s.now()
+	if !s.state.LastCheck.IsZero() {
+		next = s.state.LastCheck.Add(time.Duration(config.UpdateCheckHours) * time.Hour)
+	}
+	if s.state.RetryAfter.After(next) {
+		next = s.state.RetryAfter
+	}
+	return next
+}
+
+func (s *updateScheduler) Due(config LauncherConfig) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !s.now().Before(s.nextCheck(config))
+}
+
+func (s *updateScheduler) Status(config LauncherConfig) UpdateStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := UpdateStatus{
+		Enabled:       config.CheckForUpdates,
+		Checking:      s.checking,
+		Release:       s.release,
+		Downloaded:    s.installerPath != "",
+		InstallOnQuit: s.installStrategy != "",
+		CanInstall:    canInstallUpdates,
+		Error:         s.lastError,
+	}
+	if !s.state.LastCheck.IsZero() {
+		lastCheck := s.state.LastCheck
+		status.LastCheck = &lastCheck
+	}
+	if config.CheckForUpdates {
+		next := s.nextCheck(config)
+		status.NextCheck = &next
+	}
+	return status
+}
+
+// begin() marks a check as started, unless one already is or GitHub's rate
+// limit hasn't reset yet
+func (s *updateScheduler) begin() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.checking {
+		return errUpdateCheckInFlight
+	}
+	if s.now().Before(s.state.RetryAfter) {
+		return &RateLimitError{s.state.RetryAfter}
+	}
+	s.checking = true
+	return nil
+}
+
+// Check() checks for an update now, returning once it has been checked for
+// (and downloaded, if downloadUpdates is on)
+func (s *updateScheduler) Check(config LauncherConfig) error {
+	if err := s.begin(); err != nil {
+		return err
+	}
+	return s.check(config)
+}
+
+// CheckInBackground() starts a check, for the UI, which hears how it went from
+// update.progress events
+func (s *updateScheduler) CheckInBackground(config LauncherConfig) (UpdateStatus, error) {
+	err := s.begin()
+	if err == nil {
+		go s.check(config)
+	} else if errors.Is(err, errUpdateCheckInFlight) {
+		err = nil
+	}
+	return s.Status(config), err
+}
+
+func (s *updateScheduler) check(config LauncherConfig) error {
+	launcherEvents.Publish(EventUpdateProgress, updateProgressPayload{Stage: "checking"})
+	release, err := s.latestRelease()
+
+	s.mutex.Lock()
+	s.checking = false
+	s.state.LastCheck = s.now()
+	var rateLimit *RateLimitError
+	if errors.As(err, &rateLimit) {
+		s.state.RetryAfter = rateLimit.Until
+	}
+	s.lastError = ""
+	if err != nil {
+		s.lastError = err.Error()
+	} else if !release.IsUpgrade {
+		s.release = nil
+	} else if s.release == nil || s.release.ProductVersion != release.ProductVersion {
+		s.release, s.installerPath = &release, ""
+	}
+	notify := err == nil && release.IsUpgrade && release.ProductVersion != s.state.NotifiedVersion
+	if notify {
+		s.state.NotifiedVersion = release.ProductVersion
+	}
+	s.save()
+	s.mutex.Unlock()
+
+	if err != nil {
+		updateFailed(release, err)
+		return err
+	}
+	if !release.IsUpgrade {
+		launcherEvents.Publish(EventUpdateProgress, updateProgressPayload{Stage: "upToDate", Version: release.InstalledVersion})
+		return nil
+	}
+	launcherEvents.Publish(EventUpdateProgress, updateProgressPayload{Stage: "available", Version: release.ProductVersion})
+
+	downloaded := false
+	if config.DownloadUpdates && canInstallUpdates {
+		_, err := s.Download()
+		downloaded = err == nil
+	}
+	if notify {
+		if downloaded {
+			s.notify("Update ready", fmt.Sprintf("ICARUS Terminal %s has been downloaded. Open the launcher to install it now, or when you quit.", release.ProductVersion))
+		} else {
+			s.notify("New version available", fmt.Sprintf("ICARUS Terminal %s is available. Open the launcher to install it.", release.ProductVersion))
+		}
+	}
+	return nil
+}
+
+// save() must be called with the mutex held
+func (s *updateScheduler) save() {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.statePath), 0700)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(s.statePath, data, 0600)
+	}
+	if err != nil {
+		fmt.Println("Unable to save", UPDATE_STATE_FILE, err.Error())
+	}
+}
+
+// Download() downloads the installer for the release that was found, if it
+// hasn't been already, returning where it is
+func (s *updateScheduler) Download() (string, error) {
+	s.downloading.Lock()
+	defer s.downloading.Unlock()
+
+	s.mutex.Lock()
+	release, installerPath := s.release, s.installerPath
+	s.mutex.Unlock()
+	if release == nil {
+		return "", ErrNoUpdate
+	}
+	if installerPath != "" {
+		return installerPath, nil
+	}
+
+	installerPath, err := s.download(*release)
+	if err != nil {
+		updateFailed(*release, err)
+		return "", err
+	}
+	s.mutex.Lock()
+	if s.release != nil && s.release.ProductVersion == release.ProductVersion {
+		s.installerPath = installerPath
+	}
+	s.mutex.Unlock()
+	launcherEvents.Publish(EventUpdateProgress, updateProgressPayload{Stage: "ready", Version: release.ProductVersion, Percent: 100})
+	return installerPath, nil
+}
+
+// SetInstallOnQuit() is how the user agrees to the update being installed
+// when the launcher next quits. It is downloaded now if it hasn't been, so
+// quitting isn't held up.
+func (s *updateScheduler) SetInstallOnQuit(config LauncherConfig, enabled bool) (UpdateStatus, error) {
+	if !canInstallUpdates {
+		return s.Status(config), ErrUpdatesUnsupported
+	}
+	s.mutex.Lock()
+	if enabled && s.release == nil {
+		s.mutex.Unlock()
+		return s.Status(config), ErrNoUpdate
+	}
+	s.installStrategy = ""
+	if enabled {
+		s.installStrategy = InstallOnExit
+	}
+	downloaded := s.installerPath != ""
+	s.mutex.Unlock()
+	if enabled && !downloaded {
+		go s.Download()
+	}
+	return s.Status(config), nil
+}
+
+// Install() installs the update that was found with strategy (see
+// update-install.go), checking for one first if that hasn't been done. Other
+// than for InstallOnExit it is downloaded, then the launcher quits for it.
+func (s *updateScheduler) Install(config LauncherConfig, strategy string) error {
+	if !canInstallUpdates {
+		return ErrUpdatesUnsupported
+	}
+	s.mutex.Lock()
+	found := s.release != nil
+	s.mutex.Unlock()
+	if !found {
+		if err := s.Check(config); err != nil {
+			return err
+		}
+	}
+	if strategy == InstallOnExit {
+		_, err := s.SetInstallOnQuit(config, true)
+		return err
+	}
+
+	installerPath, err := s.Download()
+	if err != nil {
+		return err
+	}
+	if strategy == InstallSilent {
+		// Installing anyway would lose the terminals
+		layout, err := s.layout()
+		if err != nil {
+			err = fmt.Errorf("unable to find the terminals to reopen: %w", err)
+			s.mutex.Lock()
+			release := Release{}
+			if s.release != nil {
+				release = *s.release
+			}
+			s.mutex.Unlock()
+			updateFailed(release, err)
+			return err
+		}
+		if err := saveLayout(filepath.Join(filepath.Dir(s.statePath), LAYOUT_FILE), layout); err != nil {
+			fmt.Println("Unable to save", LAYOUT_FILE, err.Error())
+		}
+	}
+	s.mutex.Lock()
+	s.installStrategy = strategy
+	progress := updateProgressPayload{Stage: "installing", Percent: 100}
+	if s.release != nil {
+		progress.Version = s.release.ProductVersion
+	}
+	s.mutex.Unlock()
+	fmt.Println("Quitting to install", installerPath)
+	launcherEvents.Publish(EventUpdateProgress, progress)
+	s.quit()
+	return nil
+}
+
+// installIfAgreed() runs the installer as the launcher quits, if the user
+// asked for that. It only does so once.
+func (s *updateScheduler) installIfAgreed() {
+	s.mutex.Lock()
+	strategy := s.installStrategy
+	s.installStrategy = ""
+	s.mutex.Unlock()
+	if strategy == "" {
+		return
+	}
+	if installerPath, err := s.Download(); err == nil {
+		s.install(installerPath, strategy == InstallSilent)
+	}
+}
+
+// notifyUpdate() shows an OS notification from the launcher's tray icon
+func notifyUpdate(title string, message string) {
+	if webViewInstance == nil {
+		return
+	}
+	// Back to the UI thread, which owns the tray icon
+	webViewInstance.Dispatch(func() {
+		showTrayNotification(title, message)
+	})
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeUpdates stands in for GitHub, downloads and notifications
+type fakeUpdates struct {
+	release       Release
+	err           error
+	checks        int
+	downloads     int
+	notifications []string
+	now           time.Time
+	layout        []TerminalOptions
+	layoutErr     error
+	quits         int
+	installs      []string
+}
+
+func newTestUpdateScheduler(t *testing.T, fake *fakeUpdates) *updateScheduler {
+	dir, err := ioutil.TempDir("", "updates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return newFakeUpdateScheduler(filepath.Join(dir, UPDATE_STATE_FILE), fake)
+}
+
+func newFakeUpdateScheduler(statePath string, fake *fakeUpdates) *updateScheduler {
+	s := newUpdateScheduler(statePath)
+	s.latestRelease = func() (Release, error) {
+		fake.checks++
+		return fake.release, fake.err
+	}
+	s.download = func(release Release) (string, error) {
+		fake.downloads++
+		return "/tmp/ICARUS Update.exe", nil
+	}
+	s.notify = func(title string, message string) {
+		fake.notifications = append(fake.notifications, title+": "+message)
+	}
+	s.now = func() time.Time { return fake.now }
+	s.layout = func() ([]TerminalOptions, error) { return fake.layout, fake.layoutErr }
+	s.quit = func() { fake.quits++ }
+	s.install = func(installerPath string, silent bool) {
+		fake.installs = append(fake.installs, fmt.Sprintf("%s silent=%v", installerPath, silent))
+	}
+	return s
+}
+
+func upgradeTo(version string) Release {
+	return Release{InstalledVersion: "1.0.0", ProductVersion: version, DownloadUrl: "https://example.com/" + version, IsUpgrade: true}
+}
+
+func TestUpdateSchedulerChecks(t *testing.T) {
+	config := DefaultLauncherConfig()
+	fake := &fakeUpdates{release: upgradeTo("1.1.0"), now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	s := newTestUpdateScheduler(t, fake)
+
+	if !s.Due(config) {
+		t.Fatalf("expected a check to be due on first start")
+	}
+	if err := s.Check(config); err != nil {
+		t.Fatal(err)
+	}
+	status := s.Status(config)
+	if status.Release == nil || status.Release.ProductVersion != "1.1.0" || status.Downloaded || status.NextCheck == nil || !status.NextCheck.Equal(fake.now.Add(24*time.Hour)) {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if len(fake.notifications) != 1 || !strings.Contains(fake.notifications[0], "1.1.0 is available") {
+		t.Errorf("expected a notification, got %v", fake.notifications)
+	}
+
+	// Restarting the launcher doesn't check again early, or notify again
+	s = newFakeUpdateScheduler(s.statePath, fake)
+	fake.now = fake.now.Add(23 * time.Hour)
+	if s.Due(config) {
+		t.Errorf("expected no check until %d hours later", config.UpdateCheckHours)
+	}
+	fake.now = fake.now.Add(time.Hour)
+	s.Check(config)
+	if fake.checks != 2 || len(fake.notifications) != 1 {
+		t.Errorf("expected the release to only be notified about once, got %v", fake.notifications)
+	}
+
+	// A newer release is notified about too
+	fake.release = upgradeTo("1.2.0")
+	s.Check(config)
+	if len(fake.notifications) != 2 || s.Status(config).Release.ProductVersion != "1.2.0" {
+		t.Errorf("expected a notification for 1.2.0, got %v", fake.notifications)
+	}
+
+	fake.release = Release{InstalledVersion: "1.2.0", ProductVersion: "1.2.0"}
+	s.Check(config)
+	if status := s.Status(config); status.Release != nil {
+		t.Errorf("expected no update once it is installed, got %+v", status)
+	}
+
+	config.CheckForUpdates = false
+	if status := s.Status(config); status.Enabled || status.NextCheck != nil {
+		t.Errorf("expected no next check when turned off, got %+v", status)
+	}
+}
+
+func TestUpdateSchedulerRateLimit(t *testing.T) {
+	config := DefaultLauncherConfig()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fake := &fakeUpdates{err: &RateLimitError{now.Add(30 * time.Hour)}, now: now}
+	s := newTestUpdateScheduler(t, fake)
+
+	var rateLimit *RateLimitError
+	if err := s.Check(config); !errors.As(err, &rateLimit) {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+	fake.now = now.Add(29 * time.Hour)
+	if s.Due(config) {
+		t.Errorf("expected no check until the rate limit resets")
+	}
+	if err := s.Check(config); !errors.As(err, &rateLimit) || fake.checks != 1 {
+		t.Errorf("expected GitHub not to be asked again, got %v after %d checks", err, fake.checks)
+	}
+	if status := s.Status(config); !status.NextCheck.Equal(now.Add(30*time.Hour)) || status.Error == "" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestUpdateSchedulerDownloads(t *testing.T) {
+	config := DefaultLauncherConfig()
+	config.DownloadUpdates = true
+	fake := &fakeUpdates{release: upgradeTo("1.1.0"), now: time.Now()}
+	s := newTestUpdateScheduler(t, fake)
+
+	if _, err := s.SetInstallOnQuit(config, true); err == nil {
+		t.Errorf("expected there to be nothing to install yet")
+	}
+	s.Check(config)
+	status, err := s.SetInstallOnQuit(config, true)
+	if !canInstallUpdates {
+		// Releases are only installers for Windows
+		if !errors.Is(err, ErrUpdatesUnsupported) || fake.downloads != 0 {
+			t.Errorf("expected updates not to be downloaded or installed, got %v after %d downloads", err, fake.downloads)
+		}
+		return
+	}
+	if err != nil || !status.Downloaded || !status.InstallOnQuit || fake.downloads != 1 {
+		t.Errorf("expected the update to be downloaded once, got %+v %v after %d downloads", status, err, fake.downloads)
+	}
+	if len(fake.notifications) != 1 || !strings.HasPrefix(fake.notifications[0], "Update ready") {
+		t.Errorf("expected a notification that the update is ready, got %v", fake.notifications)
+	}
+}
+
+func TestUpdateSchedulerInstall(t *testing.T) {
+	config := DefaultLauncherConfig()
+	layout := []TerminalOptions{{Route: "/nav/map", Zoom: 1}, {Route: "/", Pinned: true, Zoom: 1}}
+	fake := &fakeUpdates{release: upgradeTo("1.1.0"), now: time.Now(), layout: layout}
+	s := newTestUpdateScheduler(t, fake)
+
+	err := s.Install(config, InstallOnExit)
+	if !canInstallUpdates {
+		if !errors.Is(err, ErrUpdatesUnsupported) || fake.checks != 0 {
+			t.Errorf("expected updates not to be installed, got %v after %d checks", err, fake.checks)
+		}
+		return
+	}
+	if status := s.Status(config); err != nil || fake.checks != 1 || !status.InstallOnQuit || fake.quits != 0 {
+		t.Errorf("expected a check, then the update to be installed on quit, got %+v %v", status, err)
+	}
+
+	// Silent installs quit straight away, saving the terminals to reopen
+	if err := s.Install(config, InstallSilent); err != nil || fake.checks != 1 || fake.quits != 1 {
+		t.Errorf("expected the launcher to quit for the installer, got %v after %d checks", err, fake.checks)
+	}
+	windows, err := takeLayout(filepath.Join(filepath.Dir(s.statePath), LAYOUT_FILE))
+	if err != nil || len(windows) != 2 || windows[0]["route"] != "/nav/map" || windows[1]["pinned"] != "true" {
+		t.Errorf("expected the terminals to be saved, got %v %v", windows, err)
+	}
+
+	// Nor if the terminals can't be found, e.g. the launcher's window is closing
+	fake.layoutErr = ErrUIThreadTimeout
+	s = newTestUpdateScheduler(t, fake)
+	if err := s.Install(config, InstallSilent); !errors.Is(err, ErrUIThreadTimeout) || fake.quits != 1 {
+		t.Errorf("expected the install to fail without quitting, got %v", err)
+	}
+	fake.layoutErr = nil
+
+	fake.release = Release{InstalledVersion: "1.1.0", ProductVersion: "1.1.0"}
+	s = newTestUpdateScheduler(t, fake)
+	if err := s.Install(config, InstallNow); !errors.Is(err, ErrNoUpdate) || fake.quits != 1 {
+		t.Errorf("expected nothing to install, got %v", err)
+	}
+}
+
+// Quitting again, e.g. from a dialog shown while the installer downloads,
+// mustn't run the installer twice
+func TestUpdateSchedulerInstallsOnce(t *testing.T) {
+	fake := &fakeUpdates{release: upgradeTo("1.1.0"), now: time.Now()}
+	s := newTestUpdateScheduler(t, fake)
+	release := fake.release
+	s.release, s.installStrategy = &release, InstallSilent
+
+	s.installIfAgreed()
+	s.installIfAgreed()
+	if len(fake.installs) != 1 || fake.installs[0] != "/tmp/ICARUS Update.exe silent=true" {
+		t.Errorf("expected the installer to run once, got %v", fake.installs)
+	}
+	if s.Status(DefaultLauncherConfig()).InstallOnQuit {
+		t.Errorf("expected nothing left to install on quit")
+	}
+}
+
+// Without a scheduler the launcher can't quit cleanly for the installer, and
+// callers that install in the background hear about it before they start
+func TestInstallUpdateWithoutScheduler(t *testing.T) {
+	if !canInstallUpdates {
+		t.Skip("the release page is opened instead where updates can't be installed")
+	}
+	previous := updateChecks
+	t.Cleanup(func() { updateChecks = previous })
+	updateChecks = nil
+	if err := InstallUpdate(InstallSilent); !errors.Is(err, ErrUpdateChecksNotRunning) {
+		t.Errorf("expected updates not to be installed, got %v", err)
+	}
+	if err := (launcherControl{}).InstallUpdate(InstallSilent); !errors.Is(err, ErrUpdateChecksNotRunning) {
+		t.Errorf("expected the control API to be told, got %v", err)
+	}
+	if status := controlErrorStatus(ErrUpdateChecksNotRunning); status != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", status)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	response := func(status int, headers map[string]string) *http.Response {
+		res := &http.Response{StatusCode: status, Header: http.Header{}}
+		for name, value := range headers {
+			res.Header.Set(name, value)
+		}
+		return res
+	}
+	tests := []struct {
+		response *http.Response
+		until    time.Time // Zero if not rate limited
+	}{
+		{response(http.StatusOK, nil), time.Time{}},
+		{response(http.StatusForbidden, nil), time.Time{}},
+		{response(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1704114000"}), time.Unix(1704114000, 0)},
+		{response(http.StatusTooManyRequests, map[string]string{"Retry-After": "120"}), now.Add(2 * time.Minute)},
+		{response(http.StatusTooManyRequests, nil), now.Add(defaultRateLimitWait)},
+	}
+	for _, test := range tests {
+		err := rateLimited(test.response, now)
+		var rateLimit *RateLimitError
+		if test.until.IsZero() != (err == nil) || (err != nil && (!errors.As(err, &rateLimit) || !rateLimit.Until.Equal(test.until))) {
+			t.Errorf("%d %v: expected rate limited until %v, got %v", test.response.StatusCode, test.response.Header, test.until, err)
+		}
+	}
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"github.com/gonutz/w32/v2"
+	"fmt"
 	"github.com/jmoiron/jsonq"
 	"io"
 	"io/ioutil"
@@ -11,12 +11,26 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const LATEST_RELEASE_URL = "https://api.github.com/repos/acorrow/icarus/releases/latest"
 
+// How long to wait after being rate limited if GitHub doesn't say
+const defaultRateLimitWait = time.Hour
+
+// RateLimitError is returned when GitHub refuses to say what the latest
+// release is until Until, as it allows 60 requests an hour without a token
+type RateLimitError struct {
+	Until time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("GitHub's rate limit was reached, try again after %s", e.Until.Local().Format("15:04"))
+}
+
 type Release struct {
 	InstalledVersion string `json:"installedVersion"`
 	ProductVersion   string `json:"productVersion"`
@@ -34,65 +48,39 @@ func CheckForUpdate() (bool, error) {
 	return latestUpdate.IsUpgrade, nil
 }
 
-func InstallUpdate() {
-	release, err := GetLatestRelease()
-	if err == nil {
-		pathToFile, _ := DownloadUpdate(release.DownloadUrl)
-		runElevated(pathToFile)
-		os.Exit(0)
-	}
-}
-
-func GetCurrentAppVersion() string {
-	pathToExecutable, err := os.Executable()
-	if err != nil {
-		panic("os.Executable() failed")
-	}
-
-	size := w32.GetFileVersionInfoSize(pathToExecutable)
-	if size <= 0 {
-		panic("GetFileVersionInfoSize failed")
+// InstallUpdate() installs the latest release the way strategy says (see
+// update-install.go), publishing its progress as update.progress events (see
+// events.go). Where the launcher can't install releases it opens the release
+// page instead. Only the launcher process installs releases.
+func InstallUpdate(strategy string) error {
+	if err := canStartUpdateInstall(); err != nil {
+		return err
 	}
-
-	info := make([]byte, size)
-	ok := w32.GetFileVersionInfo(pathToExecutable, info)
-	if !ok {
-		panic("GetFileVersionInfo failed")
-	}
-
-	/*
-		fixed, ok := w32.VerQueryValueRoot(info)
-		if !ok {
-				panic("VerQueryValueRoot failed")
-		}
-		version := fixed.FileVersion()
-		fileVersion := fmt.Sprintf(
-				"%d.%d.%d.%d",
-				version&0xFFFF000000000000>>48,
-				version&0x0000FFFF00000000>>32,
-				version&0x00000000FFFF0000>>16,
-				version&0x000000000000FFFF>>0,
-		)
-	*/
-
-	translations, ok := w32.VerQueryValueTranslations(info)
-	if !ok {
-		panic("VerQueryValueTranslations failed")
+	if canInstallUpdates {
+		return updateChecks.Install(currentLauncherConfig(), strategy)
 	}
-	if len(translations) == 0 {
-		panic("no translation found")
+	launcherEvents.Publish(EventUpdateProgress, updateProgressPayload{Stage: "checking"})
+	release, err := GetLatestRelease()
+	if err != nil {
+		updateFailed(release, err)
+		return err
 	}
-	t := translations[0]
+	installRelease(release)
+	return nil
+}
 
-	productVersion, ok := w32.VerQueryValueString(info, t, w32.ProductVersion)
-	if !ok {
-		panic("cannot get product version")
+// canStartUpdateInstall() returns why InstallUpdate() would fail straight
+// away, so callers that run it in the background can say so first
+func canStartUpdateInstall() error {
+	if canInstallUpdates && updateChecks == nil {
+		return ErrUpdateChecksNotRunning
 	}
+	return nil
+}
 
-	// Convert from version with build number (0.0.0.0) to semver version (0.0.0)
-	productVersion = regexp.MustCompile(`(\.[^\.]+)$`).ReplaceAllString(productVersion, ``)
-
-	return productVersion
+func updateFailed(release Release, err error) {
+	fmt.Println("Update failed", err.Error())
+	launcherEvents.Publish(EventUpdateProgress, updateProgressPayload{Stage: "failed", Version: release.ProductVersion, Error: err.Error()})
 }
 
 func GetLatestRelease() (Release, error) {
@@ -114,6 +102,12 @@ func GetLatestRelease() (Release, error) {
 	if res.Body != nil {
 		defer res.Body.Close()
 	}
+	if err := rateLimited(res, time.Now()); err != nil {
+		return release, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return release, fmt.Errorf("checking for updates: %s", res.Status)
+	}
 
 	body, readErr := ioutil.ReadAll(res.Body)
 	if readErr != nil {
@@ -149,16 +143,37 @@ func GetLatestRelease() (Release, error) {
 	return release, nil
 }
 
-func DownloadUpdate(downloadUrl string) (string, error) {
+// rateLimited() returns a RateLimitError if res says the rate limit was
+// reached, with when to try again from its headers
+func rateLimited(res *http.Response, now time.Time) error {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		return &RateLimitError{now.Add(time.Duration(seconds) * time.Second)}
+	}
+	if res.StatusCode == http.StatusForbidden && res.Header.Get("X-RateLimit-Remaining") != "0" {
+		return nil // Forbidden for some other reason
+	}
+	if reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		return &RateLimitError{time.Unix(reset, 0)}
+	}
+	return &RateLimitError{now.Add(defaultRateLimitWait)}
+}
+
+func DownloadUpdate(release Release) (string, error) {
 	tmpDir, _ := ioutil.TempDir("", "*")
 	tmpfile := filepath.Join(tmpDir, "ICARUS Update.exe")
 
 	// Get file to download
-	resp, err := http.Get(downloadUrl)
+	resp, err := http.Get(release.DownloadUrl)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading %s: %s", release.DownloadUrl, resp.Status)
+	}
 
 	// Create file
 	out, err := os.Create(tmpfile)
@@ -168,7 +183,30 @@ func DownloadUpdate(downloadUrl string) (string, error) {
 	defer out.Close()
 
 	// Write to file
-	_, err = io.Copy(out, resp.Body)
+	progress := &downloadProgress{version: release.ProductVersion, total: resp.ContentLength, percent: -1}
+	if _, err := io.Copy(out, io.TeeReader(resp.Body, progress)); err != nil {
+		return "", err
+	}
 
 	return tmpfile, nil
 }
+
+// downloadProgress publishes how much of an update has been downloaded,
+// whenever it reaches another percent
+type downloadProgress struct {
+	version string
+	total   int64 // -1 if the server didn't say
+	written int64
+	percent int
+}
+
+func (p *downloadProgress) Write(data []byte) (int, error) {
+	p.written += int64(len(data))
+	if p.total > 0 {
+		if percent := int(p.written * 100 / p.total); percent != p.percent {
+			p.percent = percent
+			launcherEvents.Publish(EventUpdateProgress, updateProgressPayload{Stage: "downloading", Version: p.version, Percent: percent})
+		}
+	}
+	return len(data), nil
+}
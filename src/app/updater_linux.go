@@ -0,0 +1,19 @@
+package main
+
+// Set at build time, e.g. -ldflags "-X main.appVersion=1.2.3", as Linux
+// executables don't carry version information like Windows ones do
+var appVersion = "0.0.0"
+
+// Releases only include a Windows installer, so on Linux we open the release
+// page and leave it to the user (or their package manager) to update.
+const canInstallUpdates = false
+
+func runInstaller(pathToInstaller string, silent bool) {}
+
+func installRelease(release Release) {
+	runUnelevated(currentLauncherConfig().ReleaseNotesUrl)
+}
+
+func GetCurrentAppVersion() string {
+	return appVersion
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/gonutz/w32/v2"
+	"os"
+	"regexp"
+)
+
+// Releases are Windows installers
+const canInstallUpdates = true
+
+// runInstaller() runs a downloaded installer, which needs to be elevated. A
+// silent install shows no UI and starts the app again once it's done (see
+// .onInstSuccess in resources/installer/installer.nsi).
+func runInstaller(pathToInstaller string, silent bool) {
+	if silent {
+		runElevated(pathToInstaller, "/S", "/relaunch")
+		return
+	}
+	runElevated(pathToInstaller)
+}
+
+// installRelease() runs the installer for a release when no launcher is
+// running to install it (see runUpdateInstall), so there is nothing to close
+// first. The installer waits for this process to exit before replacing it.
+func installRelease(release Release) {
+	pathToFile, err := DownloadUpdate(release)
+	if err != nil {
+		updateFailed(release, err)
+		return
+	}
+	launcherEvents.Publish(EventUpdateProgress, updateProgressPayload{Stage: "installing", Version: release.ProductVersion, Percent: 100})
+	runInstaller(pathToFile, false)
+}
+
+func GetCurrentAppVersion() string {
+	pathToExecutable, err := os.Executable()
+	if err != nil {
+		panic("os.Executable() failed")
+	}
+
+	size := w32.GetFileVersionInfoSize(pathToExecutable)
+	if size <= 0 {
+		panic("GetFileVersionInfoSize failed")
+	}
+
+	info := make([]byte, size)
+	ok := w32.GetFileVersionInfo(pathToExecutable, info)
+	if !ok {
+		panic("GetFileVersionInfo failed")
+	}
+
+	/*
+		fixed, ok := w32.VerQueryValueRoot(info)
+		if !ok {
+				panic("VerQueryValueRoot failed")
+		}
+		version := fixed.FileVersion()
+		fileVersion := fmt.Sprintf(
+				"%d.%d.%d.%d",
+				version&0xFFFF000000000000>>48,
+				version&0x0000FFFF00000000>>32,
+				version&0x00000000FFFF0000>>16,
+				version&0x000000000000FFFF>>0,
+		)
+	*/
+
+	translations, ok := w32.VerQueryValueTranslations(info)
+	if !ok {
+		panic("VerQueryValueTranslations failed")
+	}
+	if len(translations) == 0 {
+		panic("no translation found")
+	}
+	t := translations[0]
+
+	productVersion, ok := w32.VerQueryValueString(info, t, w32.ProductVersion)
+	if !ok {
+		panic("cannot get product version")
+	}
+
+	// Convert from version with build number (0.0.0.0) to semver version (0.0.0)
+	productVersion = regexp.MustCompile(`(\.[^\.]+)$`).ReplaceAllString(productVersion, ``)
+
+	return productVersion
+}
@@ -0,0 +1,120 @@
+package main
+
+// windowControl changes a window's state, for its UI (see rpc.go) and for
+// requests from outside it (see windowEvents). Only used from the window's UI
+// thread.
+type windowControl struct {
+	window nativeWindow
+	state  WindowState
+}
+
+// windowStateInfo is a window's state, as the UI sees it
+type windowStateInfo struct {
+	FullScreen   bool `json:"fullScreen"`
+	Pinned       bool `json:"pinned"`
+	Overlay      bool `json:"overlay"`
+	ClickThrough bool `json:"clickThrough"`
+	Opacity      int  `json:"opacity"`
+}
+
+func newWindowControl(window nativeWindow, initial WindowState) *windowControl {
+	c := &windowControl{window: window, state: NewWindowState()}
+	if initial != c.state {
+		c.apply(initial)
+	}
+	return c
+}
+
+func (c *windowControl) apply(next WindowState) {
+	c.window.ApplyState(c.state, next)
+	c.state = next
+	c.changed()
+}
+
+// changed() lets the window's UI know its state changed, however it was
+// changed (see events.go)
+func (c *windowControl) changed() {
+	launcherEvents.Publish(EventWindowStateChanged, c.Info())
+}
+
+// toggle() applies a transition, leaving the window as it is if the
+// transition is not allowed (e.g. pinning a fullscreen window)
+func (c *windowControl) toggle(transition func(WindowState) (WindowState, error)) (windowStateInfo, error) {
+	next, err := transition(c.state)
+	if err != nil {
+		return c.Info(), err
+	}
+	c.apply(next)
+	return c.Info(), nil
+}
+
+func (c *windowControl) Info() windowStateInfo {
+	return windowStateInfo{
+		FullScreen:   c.state.IsFullScreen(),
+		Pinned:       c.state.IsPinned(),
+		Overlay:      c.state.IsOverlay(),
+		ClickThrough: c.state.ClickThrough,
+		Opacity:      c.state.Opacity,
+	}
+}
+
+func (c *windowControl) ToggleFullScreen() (windowStateInfo, error) {
+	return c.toggle(WindowState.ToggleFullScreen)
+}
+
+func (c *windowControl) TogglePinned() (windowStateInfo, error) {
+	return c.toggle(WindowState.TogglePinned)
+}
+
+func (c *windowControl) ToggleOverlay() (windowStateInfo, error) {
+	return c.toggle(WindowState.ToggleOverlay)
+}
+
+func (c *windowControl) ToggleClickThrough() (windowStateInfo, error) {
+	return c.toggle(func(state WindowState) (WindowState, error) {
+		next, err := state.ToggleClickThrough()
+		// Without the hotkey there would be no way to make the window respond to
+		// the mouse again, so refuse rather than leave it stuck.
+		if err == nil && next.ClickThrough && !c.window.ClickThroughHotkeyRegistered() {
+			return state, ErrNoClickThroughHotkey
+		}
+		return next, err
+	})
+}
+
+// SetOpacity() is remembered for overlay mode if the window isn't in it
+func (c *windowControl) SetOpacity(percent int) windowStateInfo {
+	next := c.state.SetOpacity(percent)
+	if c.state.IsOverlay() {
+		c.apply(next)
+	} else {
+		c.state = next
+		c.changed()
+	}
+	return c.Info()
+}
+
+// events() handles requests from outside the UI, e.g. hotkeys and the
+// launcher's control API
+func (c *windowControl) events() windowEvents {
+	set := func(mode windowSwitch, on bool, transition func(WindowState) (WindowState, error)) {
+		if mode.needsToggle(on) {
+			c.toggle(transition)
+		}
+	}
+	return windowEvents{
+		ToggleClickThrough: func() {
+			// Windows that aren't overlays are left as they are
+			c.toggle(WindowState.ToggleClickThrough)
+		},
+		ToggleOverlay: func() {
+			c.ToggleOverlay()
+		},
+		SetFullScreen: func(mode windowSwitch) {
+			set(mode, c.state.IsFullScreen(), WindowState.ToggleFullScreen)
+		},
+		SetPinned: func(mode windowSwitch) {
+			set(mode, c.state.IsPinned(), WindowState.TogglePinned)
+		},
+	}
+}
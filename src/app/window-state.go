@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WindowMode is how a terminal window is currently presented. A window is only
+// ever in one mode at a time, and only the transitions listed in
+// windowModeTransitions are allowed.
+type WindowMode int
+
+const (
+	WindowModeNormal     WindowMode = iota // Regular window with borders
+	WindowModePinned                       // Borderless and always on top
+	WindowModeOverlay                      // Pinned, translucent and optionally click-through
+	WindowModeFullScreen                   // Borderless and covering the screen
+)
+
+const minOverlayOpacity = 10
+const maxOverlayOpacity = 100
+
+var ErrInvalidWindowTransition = errors.New("invalid window mode transition")
+var ErrNotInOverlayMode = errors.New("window is not in overlay mode")
+
+var windowModeTransitions = map[WindowMode][]WindowMode{
+	WindowModeNormal:     {WindowModePinned, WindowModeOverlay, WindowModeFullScreen},
+	WindowModePinned:     {WindowModeNormal, WindowModeOverlay, WindowModeFullScreen},
+	WindowModeOverlay:    {WindowModeNormal, WindowModePinned, WindowModeFullScreen},
+	WindowModeFullScreen: {WindowModeNormal},
+}
+
+func (m WindowMode) String() string {
+	switch m {
+	case WindowModeNormal:
+		return "normal"
+	case WindowModePinned:
+		return "pinned"
+	case WindowModeOverlay:
+		return "overlay"
+	case WindowModeFullScreen:
+		return "fullscreen"
+	}
+	return fmt.Sprintf("WindowMode(%d)", int(m))
+}
+
+// WindowState is a value type; every method returns the next state and leaves
+// the receiver untouched, so the caller can compare the two when applying the
+// change to a native window.
+type WindowState struct {
+	Mode         WindowMode
+	Opacity      int  // Percentage, only applied in overlay mode
+	ClickThrough bool // Overlay ignores mouse input (only valid in overlay mode)
+}
+
+func NewWindowState() WindowState {
+	return WindowState{Mode: WindowModeNormal, Opacity: defaultOverlayOpacity}
+}
+
+// IsPinned is true for any mode that keeps the window on top of other windows
+func (s WindowState) IsPinned() bool {
+	return s.Mode == WindowModePinned || s.Mode == WindowModeOverlay
+}
+
+func (s WindowState) IsOverlay() bool {
+	return s.Mode == WindowModeOverlay
+}
+
+func (s WindowState) IsFullScreen() bool {
+	return s.Mode == WindowModeFullScreen
+}
+
+func (s WindowState) Transition(mode WindowMode) (WindowState, error) {
+	if mode == s.Mode {
+		return s, nil
+	}
+
+	allowed := false
+	for _, next := range windowModeTransitions[s.Mode] {
+		if next == mode {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return s, fmt.Errorf("%w: %s to %s", ErrInvalidWindowTransition, s.Mode, mode)
+	}
+
+	next := s
+	next.Mode = mode
+	if mode != WindowModeOverlay {
+		next.ClickThrough = false
+	}
+	return next, nil
+}
+
+// TogglePinned unpins a pinned (or overlay) window and pins a normal one.
+// Full screen windows can not be pinned.
+func (s WindowState) TogglePinned() (WindowState, error) {
+	if s.IsPinned() {
+		return s.Transition(WindowModeNormal)
+	}
+	return s.Transition(WindowModePinned)
+}
+
+func (s WindowState) ToggleOverlay() (WindowState, error) {
+	if s.IsOverlay() {
+		return s.Transition(WindowModeNormal)
+	}
+	return s.Transition(WindowModeOverlay)
+}
+
+func (s WindowState) ToggleFullScreen() (WindowState, error) {
+	if s.IsFullScreen() {
+		return s.Transition(WindowModeNormal)
+	}
+	return s.Transition(WindowModeFullScreen)
+}
+
+func (s WindowState) ToggleClickThrough() (WindowState, error) {
+	if !s.IsOverlay() {
+		return s, ErrNotInOverlayMode
+	}
+	next := s
+	next.ClickThrough = !s.ClickThrough
+	return next, nil
+}
+
+// SetOpacity clamps the requested percentage to a range that keeps the window
+// visible, so a bad value from the UI can't make an overlay disappear entirely.
+func (s WindowState) SetOpacity(percent int) WindowState {
+	if percent < minOverlayOpacity {
+		percent = minOverlayOpacity
+	}
+	if percent > maxOverlayOpacity {
+		percent = maxOverlayOpacity
+	}
+	next := s
+	next.Opacity = percent
+	return next
+}
+
+// Alpha converts Opacity to the 0-255 value used by layered windows
+func (s WindowState) Alpha() byte {
+	return byte(s.Opacity * 255 / 100)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWindowStateTransitions(t *testing.T) {
+	tests := []struct {
+		from    WindowMode
+		to      WindowMode
+		allowed bool
+	}{
+		{WindowModeNormal, WindowModePinned, true},
+		{WindowModeNormal, WindowModeOverlay, true},
+		{WindowModeNormal, WindowModeFullScreen, true},
+		{WindowModePinned, WindowModeNormal, true},
+		{WindowModePinned, WindowModeOverlay, true},
+		{WindowModePinned, WindowModeFullScreen, true},
+		{WindowModeOverlay, WindowModeNormal, true},
+		{WindowModeOverlay, WindowModePinned, true},
+		{WindowModeOverlay, WindowModeFullScreen, true},
+		{WindowModeFullScreen, WindowModeNormal, true},
+		{WindowModeFullScreen, WindowModePinned, false},
+		{WindowModeFullScreen, WindowModeOverlay, false},
+	}
+
+	for _, test := range tests {
+		from := WindowState{Mode: test.from, Opacity: 50}
+		next, err := from.Transition(test.to)
+		if test.allowed {
+			if err != nil {
+				t.Errorf("%s to %s: unexpected error %v", test.from, test.to, err)
+			} else if next.Mode != test.to {
+				t.Errorf("%s to %s: ended up in %s", test.from, test.to, next.Mode)
+			}
+		} else {
+			if !errors.Is(err, ErrInvalidWindowTransition) {
+				t.Errorf("%s to %s: expected ErrInvalidWindowTransition, got %v", test.from, test.to, err)
+			}
+			if next != from {
+				t.Errorf("%s to %s: state changed on failed transition", test.from, test.to)
+			}
+		}
+	}
+}
+
+func TestWindowStateToggles(t *testing.T) {
+	state := NewWindowState()
+
+	state, _ = state.TogglePinned()
+	if !state.IsPinned() || state.Mode != WindowModePinned {
+		t.Fatalf("expected pinned, got %s", state.Mode)
+	}
+
+	state, _ = state.ToggleOverlay()
+	if !state.IsOverlay() || !state.IsPinned() {
+		t.Fatalf("expected overlay to count as pinned, got %s", state.Mode)
+	}
+
+	state, _ = state.ToggleClickThrough()
+	if !state.ClickThrough {
+		t.Fatal("expected click-through to be enabled")
+	}
+
+	// Leaving overlay mode always makes the window interactive again
+	state, _ = state.ToggleFullScreen()
+	if !state.IsFullScreen() || state.ClickThrough || state.IsPinned() {
+		t.Fatalf("unexpected full screen state %+v", state)
+	}
+
+	if _, err := state.TogglePinned(); err == nil {
+		t.Error("expected pinning a full screen window to fail")
+	}
+	if _, err := state.ToggleOverlay(); err == nil {
+		t.Error("expected overlay on a full screen window to fail")
+	}
+
+	state, _ = state.ToggleFullScreen()
+	if state.Mode != WindowModeNormal {
+		t.Fatalf("expected normal, got %s", state.Mode)
+	}
+
+	if _, err := state.ToggleClickThrough(); !errors.Is(err, ErrNotInOverlayMode) {
+		t.Errorf("expected ErrNotInOverlayMode, got %v", err)
+	}
+}
+
+func TestWindowStateOpacity(t *testing.T) {
+	tests := []struct {
+		percent  int
+		expected int
+		alpha    byte
+	}{
+		{100, 100, 255},
+		{50, 50, 127},
+		{0, minOverlayOpacity, 25},
+		{-20, minOverlayOpacity, 25},
+		{150, maxOverlayOpacity, 255},
+	}
+
+	for _, test := range tests {
+		state := NewWindowState().SetOpacity(test.percent)
+		if state.Opacity != test.expected {
+			t.Errorf("SetOpacity(%d): expected %d, got %d", test.percent, test.expected, state.Opacity)
+		}
+		if state.Alpha() != test.alpha {
+			t.Errorf("SetOpacity(%d): expected alpha %d, got %d", test.percent, test.alpha, state.Alpha())
+		}
+	}
+}
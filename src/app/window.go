@@ -0,0 +1,50 @@
+package main
+
+// nativeWindow wraps the OS window a webview is displayed in. Each platform
+// has its own implementation (see window_windows.go and window_linux.go) and
+// the rest of the app only talks to windows through this interface.
+type nativeWindow interface {
+	// Center resizes the window and centers it on the screen
+	Center(width int32, height int32)
+	// Place resizes the window and moves it to a monitor, returning an error
+	// (and leaving the window where it is) if there is no such monitor
+	Place(placement windowPlacement) error
+	SetIcon()
+	// Hide can be called from any goroutine
+	Hide()
+	// Focus shows the window (if hidden or minimised) and brings it to the front
+	Focus()
+	// Close asks the window to close, as if the user had closed it
+	Close()
+	// ApplyState updates the window to match the next state
+	ApplyState(current WindowState, next WindowState)
+	// ClickThroughHotkeyRegistered is whether the launcher has the hotkey that
+	// toggles click-through (see HotkeyToggleClickThrough)
+	ClickThroughHotkeyRegistered() bool
+	// Listen handles requests that don't come from the UI, e.g. hotkeys and
+	// messages from the launcher
+	Listen(events windowEvents)
+}
+
+type windowEvents struct {
+	ToggleClickThrough func()
+	ToggleOverlay      func()
+	SetFullScreen      func(windowSwitch)
+	SetPinned          func(windowSwitch)
+}
+
+// windowSwitch is what the launcher asks a terminal window to do with a mode
+// it can toggle, e.g. fullscreen (see setTerminalWindowFullScreen)
+type windowSwitch uintptr
+
+const (
+	windowSwitchToggle windowSwitch = iota
+	windowSwitchOn
+	windowSwitchOff
+)
+
+// needsToggle() is true if a mode that is currently on (or not) has to be
+// toggled to do what was asked
+func (s windowSwitch) needsToggle(on bool) bool {
+	return s == windowSwitchToggle || (s == windowSwitchOn) != on
+}
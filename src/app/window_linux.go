@@ -0,0 +1,250 @@
+package main
+
+/*
+#cgo pkg-config: gtk+-3.0
+#include <gtk/gtk.h>
+#include <stdlib.h>
+
+static void icarus_center(void *window, int width, int height) {
+	gtk_window_resize(GTK_WINDOW(window), width, height);
+	gtk_window_set_position(GTK_WINDOW(window), GTK_WIN_POS_CENTER);
+}
+
+// Monitors are numbered from 1, with 0 for the primary monitor (or the first
+// monitor, as Wayland has no primary). Returns the number of monitors, or 0
+// if there is no such monitor.
+static int icarus_monitor_workarea(int monitor, int *x, int *y, int *width, int *height) {
+	GdkDisplay *display = gdk_display_get_default();
+	if (display == NULL) {
+		return 0;
+	}
+	int count = gdk_display_get_n_monitors(display);
+	GdkMonitor *gdkMonitor = NULL;
+	if (monitor == 0) {
+		gdkMonitor = gdk_display_get_primary_monitor(display);
+		if (gdkMonitor == NULL && count > 0) {
+			gdkMonitor = gdk_display_get_monitor(display, 0);
+		}
+	} else if (monitor <= count) {
+		gdkMonitor = gdk_display_get_monitor(display, monitor - 1);
+	}
+	if (gdkMonitor == NULL) {
+		return 0;
+	}
+	GdkRectangle area;
+	gdk_monitor_get_workarea(gdkMonitor, &area);
+	*x = area.x;
+	*y = area.y;
+	*width = area.width;
+	*height = area.height;
+	return count;
+}
+
+// Window managers may ignore this, and Wayland doesn't let apps position
+// their own windows at all
+static void icarus_move(void *window, int x, int y, int width, int height) {
+	gtk_window_resize(GTK_WINDOW(window), width, height);
+	gtk_window_move(GTK_WINDOW(window), x, y);
+}
+
+static void icarus_set_icon(void *window, const char *path) {
+	gtk_window_set_icon_from_file(GTK_WINDOW(window), path, NULL);
+}
+
+static void icarus_hide(void *window) {
+	gtk_widget_hide(GTK_WIDGET(window));
+}
+
+static void icarus_focus(void *window) {
+	gtk_window_present(GTK_WINDOW(window));
+}
+
+static void icarus_close(void *window) {
+	gtk_window_close(GTK_WINDOW(window));
+}
+
+static void icarus_set_pinned(void *window, gboolean pinned) {
+	gtk_window_set_decorated(GTK_WINDOW(window), !pinned);
+	gtk_window_set_keep_above(GTK_WINDOW(window), pinned);
+}
+
+static void icarus_set_fullscreen(void *window, gboolean fullscreen) {
+	if (fullscreen) {
+		gtk_window_fullscreen(GTK_WINDOW(window));
+	} else {
+		gtk_window_unfullscreen(GTK_WINDOW(window));
+	}
+}
+
+// Only has an effect when a compositor is running
+static void icarus_set_opacity(void *window, double opacity) {
+	gtk_widget_set_opacity(GTK_WIDGET(window), opacity);
+}
+
+// An empty input shape lets mouse events fall through to the window below
+static void icarus_set_click_through(void *window, gboolean clickThrough) {
+	GdkWindow *gdkWindow = gtk_widget_get_window(GTK_WIDGET(window));
+	if (gdkWindow == NULL) {
+		return;
+	}
+	if (clickThrough) {
+		cairo_region_t *region = cairo_region_create();
+		gdk_window_input_shape_combine_region(gdkWindow, region, 0, 0);
+		cairo_region_destroy(region);
+	} else {
+		gdk_window_input_shape_combine_region(gdkWindow, NULL, 0, 0);
+	}
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"github.com/webview/webview"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// gtkWindow is the Linux implementation of nativeWindow, using the GtkWindow
+// created by the webview library's GTK/WebKit backend. GTK must only be used
+// from the UI thread, which is where bindings are called.
+type gtkWindow struct {
+	w      webview.WebView
+	window unsafe.Pointer
+}
+
+func newNativeWindow(w webview.WebView) nativeWindow {
+	return &gtkWindow{w, w.Window()}
+}
+
+func (n *gtkWindow) Center(width int32, height int32) {
+	C.icarus_center(n.window, C.int(width), C.int(height))
+}
+
+func (n *gtkWindow) Place(placement windowPlacement) error {
+	var x, y, width, height C.int
+	if C.icarus_monitor_workarea(C.int(placement.Monitor), &x, &y, &width, &height) == 0 {
+		return fmt.Errorf("there is no monitor %d", placement.Monitor)
+	}
+	left, top := placeInArea(screenRect{int32(x), int32(y), int32(width), int32(height)}, placement)
+	C.icarus_move(n.window, C.int(left), C.int(top), C.int(placement.Width), C.int(placement.Height))
+	return nil
+}
+
+func (n *gtkWindow) SetIcon() {
+	path := C.CString(filepath.Join(dirname, ICON))
+	defer C.free(unsafe.Pointer(path))
+	C.icarus_set_icon(n.window, path)
+}
+
+func (n *gtkWindow) Hide() {
+	n.w.Dispatch(func() {
+		C.icarus_hide(n.window)
+	})
+}
+
+func (n *gtkWindow) Focus() {
+	C.icarus_focus(n.window)
+}
+
+// Close() goes through the same delete-event -> destroy path as the window
+// manager's close button, which the webview library handles by terminating
+func (n *gtkWindow) Close() {
+	n.w.Dispatch(func() {
+		C.icarus_close(n.window)
+	})
+}
+
+func (n *gtkWindow) ApplyState(current WindowState, next WindowState) {
+	C.icarus_set_fullscreen(n.window, gboolean(next.IsFullScreen()))
+	C.icarus_set_pinned(n.window, gboolean(next.IsPinned()))
+	opacity := 1.0
+	if next.IsOverlay() {
+		opacity = float64(next.Alpha()) / 255
+	}
+	C.icarus_set_opacity(n.window, C.double(opacity))
+	C.icarus_set_click_through(n.window, gboolean(next.IsOverlay() && next.ClickThrough))
+	if current.IsFullScreen() && !next.IsFullScreen() {
+		n.Center(windowWidth, windowHeight)
+	}
+}
+
+// Without global hotkeys a click-through window could not be made to respond
+// to the mouse again, so click-through is refused (see toggleClickThrough)
+func (n *gtkWindow) ClickThroughHotkeyRegistered() bool {
+	return false
+}
+
+func (n *gtkWindow) Listen(events windowEvents) {}
+
+func gboolean(value bool) C.gboolean {
+	if value {
+		return C.TRUE
+	}
+	return C.FALSE
+}
+
+// On Linux the webview library's own window already resizes the browser and
+// handles display scaling, so the launcher uses a managed window as well.
+func createNativeWindow(LAUNCHER_WINDOW_TITLE string, url string, width int32, height int32) {
+	launcherHotkeys = NewHotkeyManager(unsupportedHotkeyBackend{}, launcherHotkeyHandlers())
+	launcherHotkeys.Apply(launcherConfig.Hotkeys)
+
+	webViewInstance = webview.New(launcherConfig.Debugger)
+	defer webViewInstance.Destroy()
+
+	window := newNativeWindow(webViewInstance)
+	window.Center(width, height)
+	window.SetIcon()
+
+	defer bindFunctionsToWebView(webViewInstance, window, NewWindowState(), true)()
+	webViewInstance.SetTitle(LAUNCHER_WINDOW_TITLE)
+	webViewInstance.SetSize(int(minLauncherWindowWidth), int(minLauncherWindowHeight), webview.HintMin)
+	webViewInstance.SetSize(int(width), int(height), webview.HintNone)
+	webViewInstance.Navigate(LoadUrl(url))
+	webViewInstance.Run()
+}
+
+// Acting on windows in other processes needs the window manager's help
+// (e.g. via EWMH on X11), which is not implemented yet.
+func setTerminalWindowsVisible(pids []int, visible bool) {
+	fmt.Println("Showing and hiding terminal windows is not supported on Linux")
+}
+
+// Returning false opens a new terminal instead
+func focusTerminalWindow(pid int) bool {
+	return false
+}
+
+// The terminal's options are kept as it was opened with
+func currentTerminalWindow(pid int, options TerminalOptions) TerminalOptions {
+	return options
+}
+
+func toggleTerminalWindowsClickThrough(pids []int) {
+	fmt.Println("Toggling click-through on terminal windows is not supported on Linux")
+}
+
+func toggleTerminalWindowsOverlay(pids []int) {
+	fmt.Println("Toggling overlay on terminal windows is not supported on Linux")
+}
+
+func arrangeTerminalWindows(pids []int, layout string) {
+	fmt.Println("Arranging terminal windows is not supported on Linux")
+}
+
+// Only closing a terminal is supported, by stopping its process
+const canControlTerminalWindows = false
+
+func closeTerminalWindow(pid int) bool {
+	return syscall.Kill(pid, syscall.SIGTERM) == nil
+}
+
+func setTerminalWindowFullScreen(pid int, mode windowSwitch) bool {
+	return false
+}
+
+func setTerminalWindowPinned(pid int, mode windowSwitch) bool {
+	return false
+}
@@ -0,0 +1,761 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nvsoft/win"
+	"github.com/webview/webview"
+	"golang.org/x/sys/windows"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Allows tests to observe messages without a real window
+var postMessage = win.PostMessage
+
+// Not defined in github.com/nvsoft/win
+const LWA_ALPHA = 0x00000002
+const WM_DPICHANGED = 0x02E0
+const USER_DEFAULT_SCREEN_DPI = 96
+const DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2 = ^uintptr(3) // -4
+const SMTO_ABORTIFHUNG = 0x0002
+
+type styleStruct struct {
+	StyleOld uint32
+	StyleNew uint32
+}
+
+// win.WINDOWPOS uses Go int (64 bit) for fields that are 32 bit in Win32
+type windowPos struct {
+	Wnd            win.HWND
+	WndInsertAfter win.HWND
+	X, Y, CX, CY   int32
+	Flags          uint32
+}
+
+const MDITILE_VERTICAL = 0x0000
+const MDITILE_HORIZONTAL = 0x0001
+
+// Window class used by the webview library for the windows it creates
+const WEBVIEW_WINDOW_CLASS = "webview"
+
+// Posted by the launcher to terminal windows to act on all of them at once
+const WM_ICARUS_TOGGLE_OVERLAY = win.WM_APP + 1
+
+// Posted by the launcher to a terminal window, with a windowSwitch as wParam
+const (
+	WM_ICARUS_SET_FULLSCREEN = win.WM_APP + 2
+	WM_ICARUS_SET_PINNED     = win.WM_APP + 3
+)
+
+// Posted by the launcher to overlay windows for HotkeyToggleClickThrough
+const WM_ICARUS_TOGGLE_CLICK_THROUGH = win.WM_APP + 4
+
+// Sent by a terminal to its launcher's window, which returns 1 if it has
+// registered HotkeyToggleClickThrough
+const WM_ICARUS_HAS_CLICK_THROUGH_HOTKEY = win.WM_APP + 5
+
+// How long a terminal waits for its launcher to answer
+const launcherMessageTimeout = 1000 // ms
+
+// Terminals' windows can be acted on from the launcher (e.g. by the control
+// API) by posting messages to them
+const canControlTerminalWindows = true
+
+var (
+	user32                            = windows.NewLazySystemDLL("user32.dll")
+	procEnumWindows                   = user32.NewProc("EnumWindows")
+	procGetWindowThreadProcessId      = user32.NewProc("GetWindowThreadProcessId")
+	procTileWindows                   = user32.NewProc("TileWindows")
+	procCascadeWindows                = user32.NewProc("CascadeWindows")
+	procGetDpiForWindow               = user32.NewProc("GetDpiForWindow")
+	procEnumDisplayMonitors           = user32.NewProc("EnumDisplayMonitors")
+	procIsIconic                      = user32.NewProc("IsIconic")
+	procSetProcessDpiAwarenessContext = user32.NewProc("SetProcessDpiAwarenessContext")
+	procSendMessageTimeout            = user32.NewProc("SendMessageTimeoutW")
+)
+
+// True while resizeWebView() is asking the webview to fill the window
+var resizingWebView = false
+
+// EnumWindows() is only called from the UI thread, so a single callback (and
+// slice to collect results in) can be shared, which avoids creating a new
+// callback each time as there is a hard limit on how many can be created.
+var enumeratedWindows []win.HWND
+var enumWindowsCallback = syscall.NewCallback(func(hwnd win.HWND, lParam uintptr) uintptr {
+	enumeratedWindows = append(enumeratedWindows, hwnd)
+	return 1
+})
+
+// windowsForProcesses() returns top level webview windows owned by any of the
+// given processes, e.g. all terminals started by the launcher.
+func windowsForProcesses(pids []int) []win.HWND {
+	return windowsOfClass(pids, WEBVIEW_WINDOW_CLASS)
+}
+
+func windowsOfClass(pids []int, class string) []win.HWND {
+	enumeratedWindows = nil
+	procEnumWindows.Call(enumWindowsCallback, 0)
+
+	isTerminalProcess := map[uint32]bool{}
+	for _, pid := range pids {
+		isTerminalProcess[uint32(pid)] = true
+	}
+
+	hwnds := []win.HWND{}
+	for _, hwnd := range enumeratedWindows {
+		var pid uint32
+		procGetWindowThreadProcessId.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&pid)))
+		if isTerminalProcess[pid] && win.GetClassName(hwnd) == class {
+			hwnds = append(hwnds, hwnd)
+		}
+	}
+	enumeratedWindows = nil
+	return hwnds
+}
+
+// Like enumWindowsCallback, only called from the UI thread
+var enumeratedMonitors []win.HMONITOR
+var enumMonitorsCallback = syscall.NewCallback(func(hMonitor win.HMONITOR, hdc win.HDC, rc uintptr, lParam uintptr) uintptr {
+	enumeratedMonitors = append(enumeratedMonitors, hMonitor)
+	return 1
+})
+
+// monitorWorkArea() returns the work area of a monitor, numbered from 1 in the
+// order Windows lists them, or of the primary monitor for 0
+func monitorWorkArea(monitor int) (screenRect, error) {
+	hMonitor := win.MonitorFromWindow(0, win.MONITOR_DEFAULTTOPRIMARY)
+	if monitor > 0 {
+		enumeratedMonitors = nil
+		procEnumDisplayMonitors.Call(0, 0, enumMonitorsCallback, 0)
+		monitors := enumeratedMonitors
+		enumeratedMonitors = nil
+		if monitor > len(monitors) {
+			return screenRect{}, fmt.Errorf("there is no monitor %d (found %d)", monitor, len(monitors))
+		}
+		hMonitor = monitors[monitor-1]
+	}
+	info, err := monitorInfo(hMonitor)
+	return toScreenRect(info.RcWork), err
+}
+
+func monitorInfo(hMonitor win.HMONITOR) (win.MONITORINFO, error) {
+	var info win.MONITORINFO
+	info.CbSize = uint32(unsafe.Sizeof(info))
+	if !win.GetMonitorInfo(hMonitor, &info) {
+		return info, fmt.Errorf("GetMonitorInfo failed: %d", win.GetLastError())
+	}
+	return info, nil
+}
+
+func toScreenRect(rc win.RECT) screenRect {
+	return screenRect{rc.Left, rc.Top, rc.Right - rc.Left, rc.Bottom - rc.Top}
+}
+
+func setTerminalWindowsVisible(pids []int, visible bool) {
+	setWindowsVisible(windowsForProcesses(pids), visible)
+}
+
+// focusTerminalWindow() brings a terminal's window to the front, restoring it
+// if it is minimised. It returns false if the terminal has no window.
+func focusTerminalWindow(pid int) bool {
+	hwnds := windowsForProcesses([]int{pid})
+	for _, hwnd := range hwnds {
+		if minimized, _, _ := procIsIconic.Call(uintptr(hwnd)); minimized != 0 {
+			win.ShowWindow(hwnd, win.SW_RESTORE)
+		}
+	}
+	setWindowsVisible(hwnds, true)
+	return len(hwnds) > 0
+}
+
+// currentTerminalWindow() updates the options a terminal was opened with to
+// where its window is now, and whether it is pinned or full screen. Sizes are
+// of the client area, as given to the webview's SetSize().
+func currentTerminalWindow(pid int, options TerminalOptions) TerminalOptions {
+	hwnds := windowsForProcesses([]int{pid})
+	if len(hwnds) == 0 {
+		return options
+	}
+	hwnd := hwnds[0]
+	hMonitor := win.MonitorFromWindow(hwnd, win.MONITOR_DEFAULTTONEAREST)
+	enumeratedMonitors = nil
+	procEnumDisplayMonitors.Call(0, 0, enumMonitorsCallback, 0)
+	for i, monitor := range enumeratedMonitors {
+		if monitor == hMonitor {
+			options.Placement.Monitor = i + 1
+		}
+	}
+	enumeratedMonitors = nil
+
+	// Pinned windows (and overlays) are topmost, full screen ones just lose
+	// their frame
+	options.Pinned = win.GetWindowLong(hwnd, win.GWL_EXSTYLE)&win.WS_EX_TOPMOST != 0
+	options.FullScreen = !options.Pinned && win.GetWindowLong(hwnd, win.GWL_STYLE)&win.WS_CAPTION == 0
+
+	// A full screen window fills the monitor, so keep the size it goes back to
+	minimized, _, _ := procIsIconic.Call(uintptr(hwnd))
+	info, err := monitorInfo(hMonitor)
+	if options.FullScreen || minimized != 0 || err != nil {
+		return options
+	}
+	var rc, client win.RECT
+	win.GetWindowRect(hwnd, &rc)
+	win.GetClientRect(hwnd, &client)
+	area := toScreenRect(info.RcWork)
+	options.Placement.Positioned = true
+	options.Placement.X = rc.Left - area.X
+	options.Placement.Y = rc.Top - area.Y
+	options.Placement.Width = client.Right - client.Left
+	options.Placement.Height = client.Bottom - client.Top
+	return options
+}
+
+// toggleTerminalWindowsClickThrough() toggles click-through on the overlay in
+// front, if there is one, or otherwise on every overlay (e.g. while the game
+// has focus). Windows that aren't overlays ignore it.
+func toggleTerminalWindowsClickThrough(pids []int) {
+	hwnds := windowsForProcesses(pids)
+	if webViewInstance != nil {
+		hwnds = append(hwnds, win.HWND(webViewInstance.Window()))
+	}
+	foreground := win.GetForegroundWindow()
+	for _, hwnd := range hwnds {
+		if hwnd == foreground {
+			hwnds = []win.HWND{hwnd}
+			break
+		}
+	}
+	for _, hwnd := range hwnds {
+		postMessage(hwnd, WM_ICARUS_TOGGLE_CLICK_THROUGH, 0, 0)
+	}
+}
+
+func toggleTerminalWindowsOverlay(pids []int) {
+	for _, hwnd := range windowsForProcesses(pids) {
+		postMessage(hwnd, WM_ICARUS_TOGGLE_OVERLAY, 0, 0)
+	}
+}
+
+// postToTerminalWindow() returns false if the terminal has no window
+func postToTerminalWindow(pid int, msg uint32, wParam uintptr) bool {
+	hwnds := windowsForProcesses([]int{pid})
+	for _, hwnd := range hwnds {
+		postMessage(hwnd, msg, wParam, 0)
+	}
+	return len(hwnds) > 0
+}
+
+func closeTerminalWindow(pid int) bool {
+	return postToTerminalWindow(pid, win.WM_CLOSE, 0)
+}
+
+func setTerminalWindowFullScreen(pid int, mode windowSwitch) bool {
+	return postToTerminalWindow(pid, WM_ICARUS_SET_FULLSCREEN, uintptr(mode))
+}
+
+func setTerminalWindowPinned(pid int, mode windowSwitch) bool {
+	return postToTerminalWindow(pid, WM_ICARUS_SET_PINNED, uintptr(mode))
+}
+
+func arrangeTerminalWindows(pids []int, layout string) {
+	arrangeWindows(windowsForProcesses(pids), layout)
+}
+
+func setWindowsVisible(hwnds []win.HWND, visible bool) {
+	for _, hwnd := range hwnds {
+		if visible {
+			win.ShowWindow(hwnd, win.SW_SHOW)
+		} else {
+			win.ShowWindow(hwnd, win.SW_HIDE)
+		}
+	}
+	if visible && len(hwnds) > 0 {
+		win.SetForegroundWindow(hwnds[0])
+	}
+}
+
+// arrangeWindows() positions windows on the desktop using one of the layouts
+// in terminalLayouts.
+func arrangeWindows(hwnds []win.HWND, layout string) {
+	if len(hwnds) == 0 {
+		return
+	}
+	for _, hwnd := range hwnds {
+		win.ShowWindow(hwnd, win.SW_RESTORE)
+	}
+	kids := uintptr(unsafe.Pointer(&hwnds[0]))
+	switch layout {
+	case "tileVertical":
+		procTileWindows.Call(0, MDITILE_VERTICAL, 0, uintptr(len(hwnds)), kids)
+	case "tileHorizontal":
+		procTileWindows.Call(0, MDITILE_HORIZONTAL, 0, uintptr(len(hwnds)), kids)
+	case "cascade":
+		procCascadeWindows.Call(0, 0, 0, uintptr(len(hwnds)), kids)
+	}
+}
+
+// Pointers passed in lParam are read with *(**T)(unsafe.Pointer(&lParam)) as
+// converting the uintptr directly is flagged by go vet.
+func WndProc(hwnd win.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+	// windowPtr := unsafe.Pointer(win.GetWindowLongPtr(hwnd, win.GWLP_USERDATA))
+	// w, _ := GetWindowContext(hwnd).(webViewInstance);
+	switch msg {
+	case win.WM_SIZE:
+		if wParam == win.SIZE_MINIMIZED {
+			if launcherConfig.MinimizeToTray && trayIcon != nil {
+				win.ShowWindow(hwnd, win.SW_HIDE)
+			}
+			break
+		}
+		resizeWebView(hwnd)
+	case win.WM_WINDOWPOSCHANGING:
+		// Stop the webview changing the size of the window when we ask it to
+		// resize itself (see resizeWebView)
+		if resizingWebView {
+			pos := *(**windowPos)(unsafe.Pointer(&lParam))
+			pos.Flags |= win.SWP_NOSIZE | win.SWP_NOMOVE
+		}
+		return win.DefWindowProc(hwnd, msg, wParam, lParam)
+	case win.WM_STYLECHANGING:
+		// SetSize() also adds a resizable frame, which would undo pinning
+		if resizingWebView {
+			styles := *(**styleStruct)(unsafe.Pointer(&lParam))
+			styles.StyleNew = styles.StyleOld
+		}
+		return win.DefWindowProc(hwnd, msg, wParam, lParam)
+	case win.WM_GETMINMAXINFO:
+		dpi := windowDpi(hwnd)
+		info := *(**win.MINMAXINFO)(unsafe.Pointer(&lParam))
+		info.PtMinTrackSize.X = scaleForDpi(minLauncherWindowWidth, dpi)
+		info.PtMinTrackSize.Y = scaleForDpi(minLauncherWindowHeight, dpi)
+	case WM_DPICHANGED:
+		// Windows suggests a new size and position for the window when it moves
+		// to a display with a different scale factor
+		rc := *(**win.RECT)(unsafe.Pointer(&lParam))
+		win.SetWindowPos(hwnd, 0, rc.Left, rc.Top, rc.Right-rc.Left, rc.Bottom-rc.Top, win.SWP_NOZORDER|win.SWP_NOACTIVATE)
+	case win.WM_CLOSE:
+		// Keep running in the background (service, terminals, hotkeys) when the
+		// launcher is closed, if the user has chosen to
+		if launcherConfig.CloseToTray && trayIcon != nil {
+			win.ShowWindow(hwnd, win.SW_HIDE)
+			break
+		}
+		return win.DefWindowProc(hwnd, msg, wParam, lParam)
+	case WM_ICARUS_TRAY:
+		handleTrayMessage(hwnd, lParam)
+	case wmTaskbarCreated:
+		if trayIcon != nil {
+			trayIcon = nil
+			addTrayIcon(hwnd)
+		}
+	case win.WM_HOTKEY:
+		if launcherHotkeys != nil {
+			launcherHotkeys.Trigger(int(wParam))
+		}
+	case WM_ICARUS_HAS_CLICK_THROUGH_HOTKEY:
+		if launcherHotkeys != nil && launcherHotkeys.Registered(HotkeyToggleClickThrough) {
+			return 1
+		}
+	case win.WM_DESTROY:
+		win.PostQuitMessage(0)
+		exitApplication(0)
+	default:
+		return win.DefWindowProc(hwnd, msg, wParam, lParam)
+	}
+	return 0
+}
+
+// resizeWebView() makes the webview fill the client area of a window we have
+// created ourselves. The webview library only resizes itself in response to
+// WM_SIZE on windows it has created, but SetSize() also resizes the browser to
+// fit the window, so we call that while blocking the changes to the window
+// size and style it would otherwise make (in WM_WINDOWPOSCHANGING and
+// WM_STYLECHANGING).
+func resizeWebView(hwnd win.HWND) {
+	if webViewInstance == nil || resizingWebView {
+		return
+	}
+	var rc win.RECT
+	win.GetClientRect(hwnd, &rc)
+	resizingWebView = true
+	webViewInstance.SetSize(int(rc.Right-rc.Left), int(rc.Bottom-rc.Top), webview.HintNone)
+	resizingWebView = false
+}
+
+// windowDpi() returns the DPI of the display a window is on, falling back to
+// the default on versions of Windows before Windows 10 (1607)
+func windowDpi(hwnd win.HWND) int32 {
+	if procGetDpiForWindow.Find() != nil {
+		return USER_DEFAULT_SCREEN_DPI
+	}
+	dpi, _, _ := procGetDpiForWindow.Call(uintptr(hwnd))
+	if dpi == 0 {
+		return USER_DEFAULT_SCREEN_DPI
+	}
+	return int32(dpi)
+}
+
+func scaleForDpi(size int32, dpi int32) int32 {
+	return size * dpi / USER_DEFAULT_SCREEN_DPI
+}
+
+// enableDpiAwareness() must be called before creating a window for that
+// window to receive WM_DPICHANGED, otherwise Windows scales it as a bitmap
+func enableDpiAwareness() {
+	if procSetProcessDpiAwarenessContext.Find() == nil {
+		procSetProcessDpiAwarenessContext.Call(DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2)
+	}
+}
+
+// win32Window is the Windows implementation of nativeWindow
+type win32Window struct {
+	w                  webview.WebView
+	hwnd               win.HWND
+	defaultWindowStyle int32 // Restored when returning to normal mode
+}
+
+func newNativeWindow(w webview.WebView) nativeWindow {
+	hwnd := win.HWND(w.Window())
+	return &win32Window{
+		w:                  w,
+		hwnd:               hwnd,
+		defaultWindowStyle: win.GetWindowLong(hwnd, win.GWL_STYLE),
+	}
+}
+
+func (n *win32Window) Center(width int32, height int32) {
+	// Center window and force it to redraw
+	screenWidth := int32(win.GetSystemMetrics(win.SM_CXSCREEN))
+	screenHeight := int32(win.GetSystemMetrics(win.SM_CYSCREEN))
+	windowX := int32((screenWidth / 2) - (width / 2))
+	windowY := int32((screenHeight / 2) - (height / 2))
+	win.MoveWindow(n.hwnd, windowX, windowY, width, height, false)
+}
+
+func (n *win32Window) Place(placement windowPlacement) error {
+	area, err := monitorWorkArea(placement.Monitor)
+	if err != nil {
+		return err
+	}
+	x, y := placeInArea(area, placement)
+	win.MoveWindow(n.hwnd, x, y, placement.Width, placement.Height, false)
+	return nil
+}
+
+func (n *win32Window) SetIcon() {
+	hIconSm := win.HICON(win.LoadImage(0, syscall.StringToUTF16Ptr(ICON), win.IMAGE_ICON, 32, 32, win.LR_LOADFROMFILE|win.LR_SHARED|win.LR_LOADTRANSPARENT))
+	hIcon := win.HICON(win.LoadImage(0, syscall.StringToUTF16Ptr(ICON), win.IMAGE_ICON, 64, 64, win.LR_LOADFROMFILE|win.LR_SHARED|win.LR_LOADTRANSPARENT))
+	win.SendMessage(n.hwnd, win.WM_SETICON, 0, uintptr(hIconSm))
+	win.SendMessage(n.hwnd, win.WM_SETICON, 1, uintptr(hIcon))
+}
+
+func (n *win32Window) Hide() {
+	win.ShowWindow(n.hwnd, win.SW_HIDE)
+}
+
+func (n *win32Window) Focus() {
+	showLauncherWindow(n.hwnd)
+}
+
+func (n *win32Window) Close() {
+	closeWindow(n.w)
+}
+
+func (n *win32Window) ApplyState(current WindowState, next WindowState) {
+	applyWindowState(n.hwnd, n.defaultWindowStyle, current, next)
+}
+
+// ClickThroughHotkeyRegistered() asks the launcher that started this terminal,
+// unless this is the launcher's own window
+func (n *win32Window) ClickThroughHotkeyRegistered() bool {
+	if launcherHotkeys != nil {
+		return launcherHotkeys.Registered(HotkeyToggleClickThrough)
+	}
+	for _, hwnd := range windowsOfClass([]int{os.Getppid()}, LPSZ_CLASS_NAME) {
+		var registered uintptr
+		procSendMessageTimeout.Call(uintptr(hwnd), WM_ICARUS_HAS_CLICK_THROUGH_HOTKEY, 0, 0, SMTO_ABORTIFHUNG, launcherMessageTimeout, uintptr(unsafe.Pointer(&registered)))
+		return registered == 1
+	}
+	return false
+}
+
+// Listen() handles messages posted by the launcher (see
+// toggleTerminalWindowsOverlay and postToTerminalWindow)
+func (n *win32Window) Listen(events windowEvents) {
+	subclassWindow(n.hwnd, func(msg uint32, wParam, lParam uintptr) bool {
+		switch {
+		case msg == WM_ICARUS_TOGGLE_CLICK_THROUGH:
+			events.ToggleClickThrough()
+			return true
+		case msg == WM_ICARUS_TOGGLE_OVERLAY:
+			events.ToggleOverlay()
+			return true
+		case msg == WM_ICARUS_SET_FULLSCREEN:
+			events.SetFullScreen(windowSwitch(wParam))
+			return true
+		case msg == WM_ICARUS_SET_PINNED:
+			events.SetPinned(windowSwitch(wParam))
+			return true
+		}
+		return false
+	})
+}
+
+// closeWindow() asks a window to close by posting WM_CLOSE to it from the
+// webview thread. Calling w.Terminate() from inside a binding (which is what
+// we used to do) left sibling terminals unresponsive and could crash the app,
+// whereas WM_CLOSE goes through the normal DestroyWindow -> WM_DESTROY path
+// for both webview managed windows and our own native launcher window.
+func closeWindow(w webview.WebView) {
+	hwnd := win.HWND(w.Window())
+	w.Dispatch(func() {
+		postMessage(hwnd, win.WM_CLOSE, 0, 0)
+	})
+}
+
+// A windowMessageHandler returns true if it has handled the message, in which
+// case it is not passed on to the original window procedure.
+type windowMessageHandler func(msg uint32, wParam, lParam uintptr) bool
+
+type subclassedWindow struct {
+	previousWndProc uintptr
+	handlers        []windowMessageHandler
+}
+
+// Only accessed from the UI thread, so does not need to be synchronised
+var subclassedWindows = map[win.HWND]*subclassedWindow{}
+
+var subclassWndProc = syscall.NewCallback(func(hwnd win.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+	subclass := subclassedWindows[hwnd]
+	if subclass == nil {
+		return win.DefWindowProc(hwnd, msg, wParam, lParam)
+	}
+	for _, handler := range subclass.handlers {
+		if handler(msg, wParam, lParam) {
+			return 0
+		}
+	}
+	if msg == win.WM_NCDESTROY {
+		delete(subclassedWindows, hwnd)
+	}
+	return win.CallWindowProc(subclass.previousWndProc, hwnd, msg, wParam, lParam)
+})
+
+// subclassWindow() lets us handle messages (e.g. WM_HOTKEY) sent to windows
+// created by the webview library, which otherwise only sees its own messages.
+func subclassWindow(hwnd win.HWND, handler windowMessageHandler) {
+	if subclass, ok := subclassedWindows[hwnd]; ok {
+		subclass.handlers = append(subclass.handlers, handler)
+		return
+	}
+	previousWndProc := win.SetWindowLongPtr(hwnd, win.GWLP_WNDPROC, subclassWndProc)
+	subclassedWindows[hwnd] = &subclassedWindow{previousWndProc, []windowMessageHandler{handler}}
+}
+
+// applyWindowState() updates the style, extended style and z-order of a window
+// to match the next state. defaultWindowStyle is the style the window had when
+// it was created, which is restored when returning to normal mode.
+func applyWindowState(hwnd win.HWND, defaultWindowStyle int32, current WindowState, next WindowState) {
+	exStyle := win.GetWindowLong(hwnd, win.GWL_EXSTYLE) &^ (win.WS_EX_LAYERED | win.WS_EX_TRANSPARENT)
+	if next.IsOverlay() {
+		exStyle |= win.WS_EX_LAYERED
+		if next.ClickThrough {
+			exStyle |= win.WS_EX_TRANSPARENT
+		}
+	}
+
+	var rc win.RECT
+
+	// The monitor the window is (mostly) on
+	monitor, _ := monitorInfo(win.MonitorFromWindow(hwnd, win.MONITOR_DEFAULTTONEAREST))
+
+	switch next.Mode {
+	case WindowModeFullScreen:
+		screen := toScreenRect(monitor.RcMonitor)
+
+		// Set to fullscreen and remove window border
+		newWindowStyle := defaultWindowStyle &^ (win.WS_CAPTION | win.WS_THICKFRAME | win.WS_MINIMIZEBOX | win.WS_MAXIMIZEBOX | win.WS_SYSMENU)
+		win.SetWindowLong(hwnd, win.GWL_STYLE, newWindowStyle)
+		win.SetWindowLong(hwnd, win.GWL_EXSTYLE, exStyle)
+		win.SetWindowPos(hwnd, 0, screen.X, screen.Y, screen.Width, screen.Height, win.SWP_FRAMECHANGED)
+	case WindowModePinned, WindowModeOverlay:
+		newWindowStyle := defaultWindowStyle &^ (win.WS_BORDER | win.WS_CAPTION | win.WS_THICKFRAME | win.WS_MINIMIZEBOX | win.WS_MAXIMIZEBOX | win.WS_SYSMENU)
+		win.SetWindowLong(hwnd, win.GWL_STYLE, newWindowStyle)
+		win.SetWindowLong(hwnd, win.GWL_EXSTYLE, exStyle)
+		if next.IsOverlay() {
+			win.SetLayeredWindowAttributes(hwnd, 0, next.Alpha(), LWA_ALPHA)
+		}
+		win.GetWindowRect(hwnd, &rc)
+		win.SetWindowPos(hwnd, win.HWND_TOPMOST, rc.Left, rc.Top, rc.Right-rc.Left, rc.Bottom-rc.Top, win.SWP_FRAMECHANGED)
+	default:
+		win.SetWindowLong(hwnd, win.GWL_STYLE, defaultWindowStyle)
+		win.SetWindowLong(hwnd, win.GWL_EXSTYLE, exStyle)
+		if current.IsFullScreen() {
+			// Restore default window style and position
+			// TODO Should restore to window size and location before window was set
+			// to full screen (currently just centers it on the same monitor)
+			windowX, windowY := placeInArea(toScreenRect(monitor.RcWork), windowPlacement{Width: windowWidth, Height: windowHeight})
+			win.MoveWindow(hwnd, windowX, windowY, windowWidth, windowHeight, true)
+		} else {
+			win.GetWindowRect(hwnd, &rc)
+			win.SetWindowPos(hwnd, win.HWND_NOTOPMOST, rc.Left, rc.Top, rc.Right-rc.Left, rc.Bottom-rc.Top, win.SWP_FRAMECHANGED)
+		}
+	}
+}
+
+// func GetWindowContext(wnd win.HWND) interface{} {
+// 	windowContextSync.RLock()
+// 	defer windowContextSync.RUnlock()
+// 	return windowContext[wnd]
+// }
+
+// var (
+// 	windowContext     = map[uintptr]interface{}{}
+// 	windowContextSync sync.RWMutex
+// )
+
+// createNativeWindow() explicitly creates a native window and passes the handle
+// for it to the webview, this allows for greater customisation
+func createNativeWindow(LAUNCHER_WINDOW_TITLE string, url string, width int32, height int32) {
+	// Instance of this executable
+	hInstance := win.GetModuleHandle(nil)
+	if hInstance == 0 {
+		fmt.Println("GetModuleHandle failed:", win.GetLastError())
+	}
+
+	// Must be done before creating the window to handle changes in DPI
+	enableDpiAwareness()
+
+	// Register window class
+	atom := RegisterClass(hInstance)
+	if atom == 0 {
+		fmt.Println("RegisterClass failed:", win.GetLastError())
+	}
+
+	// Create our own window
+	// We do this manually and pass it to webview so that we can set the window
+	// location (i.e. centered), style, etc before it is displayed.
+	hwndPtr := CreateWin32Window(hInstance, LAUNCHER_WINDOW_TITLE, width, height)
+	if hwndPtr == 0 {
+		fmt.Println("CreateWin32Window failed:", win.GetLastError())
+	}
+
+	// Scale to the display the window is on, then center it
+	hwnd := win.HWND(hwndPtr)
+	dpi := windowDpi(hwnd)
+	width = scaleForDpi(width, dpi)
+	height = scaleForDpi(height, dpi)
+	screenWidth := int32(win.GetSystemMetrics(win.SM_CXSCREEN))
+	screenHeight := int32(win.GetSystemMetrics(win.SM_CYSCREEN))
+	windowX := int32((screenWidth / 2) - (width / 2))
+	windowY := int32((screenHeight / 2) - (height / 2))
+	win.MoveWindow(hwnd, windowX, windowY, width, height, false)
+
+	// Global hotkeys are registered against the launcher window, which receives
+	// WM_HOTKEY messages for them (see WndProc)
+	launcherHotkeys = NewHotkeyManager(win32HotkeyBackend{hwnd}, launcherHotkeyHandlers())
+	for _, status := range launcherHotkeys.Apply(launcherConfig.Hotkeys) {
+		if status.Error != "" {
+			fmt.Println("Unable to register hotkey", status.Action, status.Chord, status.Error)
+		}
+	}
+	defer launcherHotkeys.Close()
+
+	if err := addTrayIcon(hwnd); err != nil {
+		fmt.Println("Unable to add tray icon", err.Error())
+	}
+	defer removeTrayIcon()
+
+	// Pass the pointer to the window as an unsafe reference
+	webViewInstance = webview.NewWindow(launcherConfig.Debugger, unsafe.Pointer(&hwndPtr))
+	defer webViewInstance.Destroy()
+	defer bindFunctionsToWebView(webViewInstance, newNativeWindow(webViewInstance), NewWindowState(), true)()
+	webViewInstance.Navigate(LoadUrl(url))
+	webViewInstance.Run()
+}
+
+func RegisterClass(hInstance win.HINSTANCE) (atom win.ATOM) {
+	var wc win.WNDCLASSEX
+	wc.CbSize = uint32(unsafe.Sizeof(wc))
+	wc.Style = win.CS_HREDRAW | win.CS_VREDRAW | win.CS_OWNDC
+	wc.LpfnWndProc = syscall.NewCallback(WndProc)
+	wc.CbClsExtra = 0
+	wc.CbWndExtra = 0
+	wc.HInstance = hInstance
+	wc.HbrBackground = win.GetSysColorBrush(win.COLOR_WINDOWFRAME)
+	wc.LpszMenuName = syscall.StringToUTF16Ptr("")
+	wc.LpszClassName = syscall.StringToUTF16Ptr(LPSZ_CLASS_NAME)
+	wc.HIconSm = win.HICON(win.LoadImage(hInstance, syscall.StringToUTF16Ptr(ICON), win.IMAGE_ICON, 32, 32, win.LR_LOADFROMFILE|win.LR_SHARED|win.LR_LOADTRANSPARENT))
+	wc.HIcon = win.HICON(win.LoadImage(hInstance, syscall.StringToUTF16Ptr(ICON), win.IMAGE_ICON, 64, 64, win.LR_LOADFROMFILE|win.LR_SHARED|win.LR_LOADTRANSPARENT))
+	wc.HCursor = win.LoadCursor(0, win.MAKEINTRESOURCE(win.IDC_ARROW))
+	return win.RegisterClassEx(&wc)
+}
+
+func CreateWin32Window(hInstance win.HINSTANCE, LAUNCHER_WINDOW_TITLE string, width int32, height int32) (hwnd win.HWND) {
+	// Center window
+	// https://docs.microsoft.com/en-us/windows/win32/api/winuser/
+	screenWidth := int32(win.GetSystemMetrics(win.SM_CXSCREEN))
+	screenHeight := int32(win.GetSystemMetrics(win.SM_CYSCREEN))
+	windowX := int32((screenWidth / 2) - (width / 2))
+	windowY := int32((screenHeight / 2) - (height / 2))
+
+	return win.CreateWindowEx(
+		win.WS_EX_APPWINDOW,
+		syscall.StringToUTF16Ptr(LPSZ_CLASS_NAME),
+		syscall.StringToUTF16Ptr(LAUNCHER_WINDOW_TITLE),
+		win.WS_OVERLAPPEDWINDOW, // A normal (resizable) window
+		windowX,
+		windowY,
+		width,
+		height,
+		0,
+		0,
+		hInstance,
+		nil)
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/gdi/positioning-objects-on-a-multiple-display-setup
+// const MONITOR_CENTER = 0x0001 // center rect to monitor
+// const MONITOR_CLIP = 0x0000 // clip rect to monitor
+// const MONITOR_WORKAREA = 0x0002 // use monitor work area
+// const MONITOR_AREA = 0x0000 // use monitor entire area
+// func ClipOrCenterRectToMonitor(prc *win.RECT, flags uint) {
+// 	var hMonitor win.HMONITOR;
+// 	var mi win.MONITORINFO;
+// 	var rc win.RECT;
+//   var w = prc.Right - prc.Left;
+//   var h = prc.Bottom - prc.Top;
+
+//     //
+//     // get the nearest monitor to the passed rect.
+//     //
+//     hMonitor = win.MonitorFromRect(prc, win.MONITOR_DEFAULTTONEAREST);
+
+//     //
+//     // get the work area or entire monitor rect.
+//     //
+//     mi.CbSize = unsafe.Sizeof(mi);
+//     win.GetMonitorInfo(hMonitor, &mi);
+
+//     if (flags & MONITOR_WORKAREA) {
+//         rc = mi.RcWork;
+//     } else {
+//         rc = mi.RcMonitor;
+// 		}
+
+//     //
+//     // center or clip the passed rect to the monitor rect
+//     //
+//     if (flags & MONITOR_CENTER) {
+//         prc.left   = rc.Left + (rc.Right  - rc.Left - w) / 2;
+//         prc.top    = rc.Top  + (rc.Bottom - rc.Top  - h) / 2;
+//         prc.right  = prc.Left + w;
+//         prc.bottom = prc.Top  + h;
+//     }  else {
+//         prc.left   = unsafe.Max(rc.Left, unsafe.Min(rc.Right-w,  prc.Left));
+//         prc.top    = unsafe.Max(rc.Top,  unsafe.Min(rc.Bottom-h, prc.Top));
+//         prc.right  = prc.Left + w;
+//         prc.bottom = prc.Top  + h;
+//     }
+// }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"github.com/nvsoft/win"
+	"github.com/webview/webview"
+	"testing"
+	"unsafe"
+)
+
+const frameStyle = win.WS_CAPTION | win.WS_THICKFRAME | win.WS_MINIMIZEBOX | win.WS_MAXIMIZEBOX | win.WS_SYSMENU
+
+type postedMessage struct {
+	hwnd win.HWND
+	msg  uint32
+}
+
+// fakeWebView records how a window was asked to close. Dispatch() queues
+// callbacks rather than running them immediately, as the real webview only
+// runs them from its own message loop.
+type fakeWebView struct {
+	webview.WebView
+	handle     byte
+	queue      []func()
+	terminated bool
+	frame      *fakeFrame
+}
+
+// fakeFrame is a window's style and rect, shared by a fakeWebView and a
+// fakeFramedWindow as they are by the real webview and win32Window
+type fakeFrame struct {
+	style int32
+	rect  screenRect
+}
+
+// SetSize() does what the webview's set_size does on Windows (webview.h): it
+// puts the resizable frame back and resizes the window where it is
+func (f *fakeWebView) SetSize(width int, height int, hint webview.Hint) {
+	f.frame.style |= win.WS_THICKFRAME | win.WS_MAXIMIZEBOX
+	f.frame.rect.Width, f.frame.rect.Height = int32(width), int32(height)
+}
+func (f *fakeWebView) SetTitle(title string)                  {}
+func (f *fakeWebView) Bind(name string, fn interface{}) error { return nil }
+func (f *fakeWebView) Init(js string)                         {}
+func (f *fakeWebView) Navigate(url string)                    {}
+
+func (f *fakeWebView) Window() unsafe.Pointer { return unsafe.Pointer(&f.handle) }
+func (f *fakeWebView) Dispatch(fn func())     { f.queue = append(f.queue, fn) }
+func (f *fakeWebView) Terminate()             { f.terminated = true }
+
+// fakeFramedWindow changes its frame the way applyWindowState() does
+type fakeFramedWindow struct {
+	*fakeNativeWindow
+	frame  *fakeFrame
+	screen screenRect
+}
+
+func (w *fakeFramedWindow) Place(placement windowPlacement) error {
+	w.frame.rect = screenRect{placement.X, placement.Y, placement.Width, placement.Height}
+	return nil
+}
+
+func (w *fakeFramedWindow) ApplyState(current WindowState, next WindowState) {
+	switch next.Mode {
+	case WindowModeFullScreen:
+		w.frame.style &^= frameStyle
+		w.frame.rect = w.screen
+	case WindowModePinned, WindowModeOverlay:
+		w.frame.style &^= frameStyle | win.WS_BORDER
+	}
+}
+
+func (f *fakeWebView) runLoop() {
+	queue := f.queue
+	f.queue = nil
+	for _, fn := range queue {
+		fn()
+	}
+}
+
+// Regression test for the sequence that used to hang or crash terminals:
+// open window A, open window B, close A, then close B.
+func TestCloseWindowSequence(t *testing.T) {
+	var posted []postedMessage
+	defer func(original func(win.HWND, uint32, uintptr, uintptr) uintptr) { postMessage = original }(postMessage)
+	postMessage = func(hwnd win.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+		posted = append(posted, postedMessage{hwnd, msg})
+		return 1
+	}
+
+	a := &fakeWebView{}
+	b := &fakeWebView{}
+
+	closeWindow(a)
+	if len(posted) != 0 {
+		t.Fatalf("WM_CLOSE posted outside of the webview thread: %v", posted)
+	}
+	a.runLoop()
+
+	closeWindow(b)
+	b.runLoop()
+
+	expected := []postedMessage{
+		{win.HWND(a.Window()), win.WM_CLOSE},
+		{win.HWND(b.Window()), win.WM_CLOSE},
+	}
+	if len(posted) != len(expected) {
+		t.Fatalf("expected %d messages, got %v", len(expected), posted)
+	}
+	for i := range expected {
+		if posted[i] != expected[i] {
+			t.Errorf("message %d: expected %v, got %v", i, expected[i], posted[i])
+		}
+	}
+
+	if a.terminated || b.terminated {
+		t.Error("closeWindow() must not call Terminate() from a binding")
+	}
+}
+
+// Regression test for fullscreen and pinned terminals opening framed and at
+// their normal size, as SetSize() was called after their state was applied
+func TestSetUpTerminalWindow(t *testing.T) {
+	screen := screenRect{0, 0, 1920, 1080}
+	placement := windowPlacement{Positioned: true, X: 100, Y: 50, Width: 800, Height: 600}
+	tests := []struct {
+		options TerminalOptions
+		rect    screenRect
+	}{
+		{TerminalOptions{Placement: placement}, screenRect{100, 50, 800, 600}},
+		{TerminalOptions{Placement: placement, FullScreen: true}, screen},
+		{TerminalOptions{Placement: placement, Pinned: true}, screenRect{100, 50, 800, 600}},
+	}
+	for _, test := range tests {
+		frame := &fakeFrame{style: win.WS_OVERLAPPEDWINDOW}
+		window := &fakeFramedWindow{&fakeNativeWindow{}, frame, screen}
+		setUpTerminalWindow(&fakeWebView{frame: frame}, window, "http://localhost:3300", test.options)()
+
+		framed := test.options.InitialState().Mode == WindowModeNormal
+		if (frame.style&win.WS_THICKFRAME != 0) != framed || (frame.style&win.WS_MAXIMIZEBOX != 0) != framed {
+			t.Errorf("%s: expected framed to be %v, got style %#x", test.options.InitialState().Mode, framed, frame.style)
+		}
+		if frame.rect != test.rect {
+			t.Errorf("%s: expected %+v, got %+v", test.options.InitialState().Mode, test.rect, frame.rect)
+		}
+	}
+}
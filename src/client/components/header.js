@@ -1,7 +1,7 @@
 import { useState, useEffect, useRef, useCallback } from 'react'
 import { useRouter } from 'next/router'
 import { socketOptions } from 'lib/socket'
-import { isWindowFullScreen, isWindowPinned, toggleFullScreen, togglePinWindow } from 'lib/window'
+import { isWindowsApp, getWindowState, onLauncherEvent, toggleFullScreen, togglePinWindow } from 'lib/window'
 import { eliteDateTime } from 'lib/format'
 import { Settings } from 'components/settings'
 import notification from 'lib/notification'
@@ -275,16 +275,23 @@ export default function Header ({ connected, active }) {
   }
 
   useEffect(async () => {
-    // icarusTerminal_* methods are not always accessible while the app is loading.
-    // This handles that by calling them when the component is mounted.
+    // The launcher's binding is not always accessible while the app is loading.
+    // This handles that by calling it when the component is mounted.
     // It uses a global for isWindowsApp to reduce UI flicker.
-    if (typeof window !== 'undefined' && typeof window.icarusTerminal_version === 'function') {
+    if (isWindowsApp()) {
       IS_WINDOWS_APP = true
     }
-    setIsFullScreen(await isWindowFullScreen())
-    setIsPinned(await isWindowPinned())
+    const state = await getWindowState()
+    setIsFullScreen(state?.fullScreen)
+    setIsPinned(state?.pinned)
   }, [])
 
+  // The window can also be changed by hotkeys and the launcher's control API
+  useEffect(() => onLauncherEvent('window.stateChanged', ({ fullScreen, pinned }) => {
+    setIsFullScreen(fullScreen)
+    setIsPinned(pinned)
+  }), [])
+
   useEffect(() => {
     const dateTimeInterval = setInterval(async () => {
       setDateTime(eliteDateTime())
@@ -2,11 +2,13 @@
 import { createContext, useState, useContext, useEffect } from 'react'
 import notification from 'lib/notification'
 import { getMockShipStatus, getMockSystemData } from './ghostnet-mock-data'
+import launcherEventSchema from './launcher-events.json'
 
 let socket = null // Store socket connection (defaults to null)
 let callbackHandlers = {} // Store callbacks waiting to be executed (pending response from server)
 let deferredEventQueue = [] // Store events waiting to be sent (used when server is not ready yet or offline)
 let recentBroadcastEvents = 0
+let launcherEventTypes = [] // Subscribed to again whenever the socket reconnects
 
 const defaultSocketState = {
   connected: false, // Boolean to indicate current connection status
@@ -43,7 +45,8 @@ function connect (setSocketState) {
   callbackHandlers = {}
   deferredEventQueue = []
 
-  socket = new WebSocket('ws://' + window.location.host)
+  // Pages served over HTTPS (see src/app/certificates.go) can only use wss://
+  socket = new WebSocket((window.location.protocol === 'https:' ? 'wss://' : 'ws://') + window.location.host)
   socket.onmessage = (event) => {
     const { requestId, name, message } = JSON.parse(event.data)
     // Invoke callback to handler (if there is one)
@@ -132,6 +135,8 @@ function connect (setSocketState) {
       }
     }
 
+    if (launcherEventTypes.length > 0) sendEvent(launcherEventSchema.subscribeSocketEvent, { types: launcherEventTypes })
+
     // If we are fully loaded, then set 'ready' state to true, otherwise wait
     // until get a loadingProgress event that indicates the service is loaded
     const loadingStats = await sendEvent('getLoadingStatus')
@@ -226,6 +231,14 @@ function sendEvent (name, message = null) {
   })
 }
 
+// Sets the launcher events this client gets (see lib/window.js), which are
+// broadcast as launcherEvent
+function subscribeLauncherEvents (types) {
+  launcherEventTypes = types
+  if (socket && socket.readyState === WebSocket.OPEN) return sendEvent(launcherEventSchema.subscribeSocketEvent, { types })
+  return Promise.resolve(types)
+}
+
 function eventListener (eventName, callback) {
   if (typeof window === 'undefined') return () => {}
   const eventHandler = (e) => { callback(e.detail) }
@@ -245,6 +258,7 @@ module.exports = {
   SocketProvider,
   useSocket,
   sendEvent,
+  subscribeLauncherEvents,
   eventListener,
   socketOptions
 }
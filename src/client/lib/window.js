@@ -1,50 +1,220 @@
-function isWindowsApp () { return (typeof window !== 'undefined' && typeof window.icarusTerminal_version === 'function') }
-function isWindowFullScreen () { if (isWindowsApp()) { return window.icarusTerminal_isFullScreen() } }
-function isWindowPinned () { if (isWindowsApp()) { return window.icarusTerminal_isPinned() } }
-function openReleaseNotes () { if (isWindowsApp()) { return window.icarusTerminal_openReleaseNotes() } }
-function openTerminalInBrowser () {
-  if (isWindowsApp()) { return window.icarusTerminal_openTerminalInBrowser() }
+// The launcher's windows have a single binding, which takes JSON-RPC 2.0
+// requests (see src/app/rpc.go). rpc.discover lists the methods the launcher
+// supports, so features can be hidden rather than fail on older launchers.
+const RPC_BINDING = 'icarusTerminal_rpc'
+
+// The events the launcher pushes, shared with the launcher (see
+// src/app/events.go)
+const LAUNCHER_EVENTS = require('./launcher-events.json')
+
+// Events already handled, by source and id, as the launcher's window gets
+// remote events both from the launcher and via the service
+const MAX_SEEN_LAUNCHER_EVENTS = 100
+
+// Error codes (see src/app/rpc.go)
+const RPC_ERRORS = {
+  METHOD_NOT_FOUND: -32601,
+  INVALID_PARAMS: -32602,
+  FAILED: -32000,
+  LAUNCHER_ONLY: -32001,
+  UNAVAILABLE: -32002,
+  NOT_FOUND: -32003
+}
+
+class RpcError extends Error {
+  constructor ({ code, message, data }) {
+    super(message)
+    this.name = 'RpcError'
+    this.code = code
+    this.data = data
+  }
+}
+
+let rpcId = 0
+let capabilities = null
+const launcherEventHandlers = {} // Sets of handlers, by type
+const seenLauncherEvents = new Set()
+let listeningForLauncherEvents = false
+
+function isWindowsApp () { return (typeof window !== 'undefined' && typeof window[RPC_BINDING] === 'function') }
+
+// Calls a method, returning its result or throwing an RpcError
+async function rpc (method, params) {
+  const response = await window[RPC_BINDING]({ jsonrpc: '2.0', id: ++rpcId, method, params })
+  if (response.error) throw new RpcError(response.error)
+  return response.result
+}
+
+// Returns { version, appVersion, launcher, methods: [{ name, since, launcherOnly, description, params }] },
+// where launcher is whether this is the launcher's window (rather than a terminal)
+async function discover () {
+  if (!isWindowsApp()) return null
+  if (!capabilities) {
+    capabilities = rpc('rpc.discover')
+    capabilities.catch(() => { capabilities = null })
+  }
+  return capabilities
+}
+
+// Whether this window can call method
+async function supports (method) {
+  const { launcher, methods } = await discover() ?? { methods: [] }
+  const found = methods.find(({ name }) => name === method)
+  return Boolean(found && (launcher || !found.launcherOnly))
+}
+
+// Calls method if this window can, otherwise returns null
+async function rpcIfSupported (method, params) {
+  if (await supports(method)) return rpc(method, params)
+  return null
+}
+
+// Toggles return the window's state, which stays as it is if it can't change
+// (e.g. pinning a fullscreen window)
+async function toggleWindowState (method) {
+  try {
+    return await rpc(method)
+  } catch (e) {
+    if (e.code === RPC_ERRORS.UNAVAILABLE) return rpc('window.getState')
+    throw e
+  }
+}
+
+// Returns { fullScreen, pinned, overlay, clickThrough, opacity }
+async function getWindowState () { return rpcIfSupported('window.getState') }
+async function isWindowFullScreen () { return (await getWindowState())?.fullScreen }
+async function isWindowPinned () { return (await getWindowState())?.pinned }
+async function isWindowOverlay () { return (await getWindowState())?.overlay }
+async function isWindowClickThrough () { return (await getWindowState())?.clickThrough }
+async function getOverlayOpacity () { return (await getWindowState())?.opacity }
+async function openReleaseNotes () { return rpcIfSupported('app.openReleaseNotes') }
+async function openTerminalInBrowser () {
+  if (isWindowsApp()) { return rpc('app.openInBrowser') }
   if (typeof window !== 'undefined') {
     window.open(`//${window.location.host}`)
   }
 }
 
-function appVersion () {
-  if (isWindowsApp()) { return window.icarusTerminal_version() }
+async function appVersion () {
+  if (isWindowsApp()) { return (await rpc('app.version')).version }
   return null
 }
 
-function newWindow () {
-  if (isWindowsApp()) { return window.icarusTerminal_newWindow() }
+function handleLauncherEvent ({ detail }) {
+  const { source, id, type, payload } = detail || {}
+  const key = `${source}:${id}`
+  if (seenLauncherEvents.has(key)) return
+  seenLauncherEvents.add(key)
+  if (seenLauncherEvents.size > MAX_SEEN_LAUNCHER_EVENTS) seenLauncherEvents.delete(seenLauncherEvents.values().next().value)
+  for (const handler of launcherEventHandlers[type] || []) {
+    try {
+      handler(payload)
+    } catch (e) {
+      console.error('Launcher event handler failed', type, e)
+    }
+  }
+}
+
+// The launcher sends its own windows the types they subscribe to. Other
+// clients, like terminals in other processes and the browser, get remote
+// events via the service's socket.
+async function updateLauncherEventSubscriptions () {
+  const types = Object.keys(launcherEventHandlers)
+  try {
+    if (await supports('events.subscribe')) await rpc('events.subscribe', { types })
+    await require('./socket').subscribeLauncherEvents(types.filter(type => LAUNCHER_EVENTS.events[type].remote))
+  } catch (e) {
+    console.error('Unable to subscribe to launcher events', e.message)
+  }
+}
+
+// Calls handler with the payload of each event of type (see
+// lib/launcher-events.json), returning a function that stops doing so
+function onLauncherEvent (type, handler) {
+  if (!LAUNCHER_EVENTS.events[type]) throw new Error(`Unknown launcher event ${type}`)
+  if (typeof window === 'undefined') return () => {}
+  if (!listeningForLauncherEvents) {
+    window.addEventListener(LAUNCHER_EVENTS.domEvent, handleLauncherEvent)
+    window.addEventListener(`socketEvent_${LAUNCHER_EVENTS.socketEvent}`, handleLauncherEvent)
+    listeningForLauncherEvents = true
+  }
+
+  const subscribing = !launcherEventHandlers[type]
+  if (subscribing) launcherEventHandlers[type] = new Set()
+  launcherEventHandlers[type].add(handler)
+  if (subscribing) updateLauncherEventSubscriptions()
+
+  return () => {
+    if (!launcherEventHandlers[type] || !launcherEventHandlers[type].delete(handler)) return
+    if (launcherEventHandlers[type].size === 0) {
+      delete launcherEventHandlers[type]
+      updateLauncherEventSubscriptions()
+    }
+  }
+}
+
+// Options are all optional: { route: '/nav/map', width, height, pinned, title }
+// Only known options are passed on, so this can be used as a click handler.
+// Returns the new terminal's id in the launcher.
+async function newWindow (options = {}) {
+  const { route, width, height, pinned, title } = options
+  const windowOptions = {}
+  if (typeof route === 'string') windowOptions.route = route
+  if (Number.isInteger(width)) windowOptions.width = width
+  if (Number.isInteger(height)) windowOptions.height = height
+  if (typeof pinned === 'boolean') windowOptions.pinned = pinned
+  if (typeof title === 'string') windowOptions.title = title
+
+  if (isWindowsApp()) { return (await rpc('terminals.open', windowOptions)).id }
 
   if (typeof window !== 'undefined') {
-    window.open(`//${window.location.host}`)
+    const features = (windowOptions.width && windowOptions.height) ? `width=${windowOptions.width},height=${windowOptions.height}` : undefined
+    window.open(`//${window.location.host}${windowOptions.route || ''}`, '_blank', features)
   }
 }
 
-function closeWindow () {
-  if (isWindowsApp()) { return window.icarusTerminal_quit() }
+async function closeWindow () {
+  if (isWindowsApp()) { return rpc('window.close') }
 
   if (typeof window !== 'undefined') {
     window.close()
   }
 }
 
+// Returns { installedVersion, productVersion, downloadUrl, releaseNotes, isUpgrade },
+// or null if the latest release could not be checked
 async function checkForUpdate () {
   if (isWindowsApp()) {
     try {
-      return JSON.parse(await window.icarusTerminal_checkForUpdate())
-    } catch {}
-    return null
+      return await rpc('app.checkForUpdate')
+    } catch (e) {
+      console.error('Unable to check for update', e.message)
+    }
   }
+  return null
 }
 
-function installUpdate () {
-  if (isWindowsApp()) { return window.icarusTerminal_installUpdate() }
+// strategy is 'now' (the default, quitting cleanly first), 'onExit' (when the
+// launcher next quits) or 'silent' (without the installer's UI, reopening the
+// same terminals afterwards). Launchers before RPC version 4 install now.
+async function installUpdate (strategy) {
+  const { version } = await discover() ?? {}
+  return rpcIfSupported('app.installUpdate', strategy && version >= 4 ? { strategy } : undefined)
 }
 
+// The launcher checks for updates in the background (see
+// src/app/update-scheduler.go). Returns { enabled, lastCheck, nextCheck,
+// checking, release, downloaded, installOnQuit, canInstall, error }, where
+// release is as checkForUpdate returns, if there is a newer one.
+async function getUpdateStatus () { return rpcIfSupported('updates.getStatus') }
+
+// Progress is sent as update.progress events (see onLauncherEvent)
+async function checkForUpdatesNow () { return rpcIfSupported('updates.checkNow') }
+
+async function setInstallUpdateOnQuit (enabled) { return rpcIfSupported('updates.setInstallOnQuit', { enabled }) }
+
 async function toggleFullScreen () {
-  if (isWindowsApp()) { return await window.icarusTerminal_toggleFullScreen() }
+  if (isWindowsApp()) { return (await toggleWindowState('window.toggleFullScreen')).fullScreen }
 
   if (typeof document === 'undefined') return
 
@@ -72,13 +242,82 @@ async function toggleFullScreen () {
 }
 
 async function togglePinWindow () {
-  if (isWindowsApp()) { return await window.icarusTerminal_togglePinWindow() }
+  if (isWindowsApp()) { return (await toggleWindowState('window.togglePinned')).pinned }
+}
+
+async function toggleOverlay () {
+  if (await supports('window.toggleOverlay')) { return (await toggleWindowState('window.toggleOverlay')).overlay }
+}
+
+// Rejects if the overlay hotkey that turns it off again is not available
+async function toggleClickThrough () {
+  if (await supports('window.toggleClickThrough')) { return (await rpc('window.toggleClickThrough')).clickThrough }
+}
+
+async function setOverlayOpacity (percent) {
+  return (await rpcIfSupported('window.setOverlayOpacity', { percent }))?.opacity
 }
 
+// Returns [{ action, chord, registered, error }]
+async function getHotkeys () { return rpcIfSupported('hotkeys.get') }
+
+async function setHotkey (action, chord) { return rpcIfSupported('hotkeys.set', { action, chord }) }
+
+async function getTraySettings () { return rpcIfSupported('tray.get') }
+
+async function setTraySettings (settings) { return rpcIfSupported('tray.set', settings) }
+
+// Returns { path, source, latestJournal, valid, error, restartRequired }
+async function getSaveGameDir () { return rpcIfSupported('saveGameDir.get') }
+
+// Opens a folder picker if path is empty; rejects if the folder is not valid
+async function setSaveGameDir (path = '') { return rpcIfSupported('saveGameDir.set', { path }) }
+
+// Returns [{ key, value, source, env, hotReload, restartRequired }]
+async function getConfig () { return rpcIfSupported('config.get') }
+
+async function setConfig (key, value) { return rpcIfSupported('config.set', { key, value }) }
+
+// Returns [{ name, active }], where active is the profile this launcher runs
+async function getProfiles () { return rpcIfSupported('profiles.list') }
+
+async function createProfile (name) { return rpcIfSupported('profiles.create', { name }) }
+
+// Starts the profile's launcher, which runs alongside this one
+async function openProfile (name) { return rpcIfSupported('profiles.open', { name }) }
+
+// Returns { code, expiresAt, url, qrCode } for a remote device to pair with;
+// rejects if LAN access is off
+async function startPairing () { return rpcIfSupported('devices.startPairing') }
+
+// Returns [{ id, name, pairedAt, lastSeen }]
+async function getPairedDevices () { return rpcIfSupported('devices.list') }
+
+async function revokeDevice (id) { return rpcIfSupported('devices.revoke', { id }) }
+
+// Saves the certificate authority devices install to trust HTTPS, returning
+// where it was saved ('' if cancelled)
+async function exportCertificate () { return rpcIfSupported('certificate.export') }
+
+// Restarts the service behind the launcher's port. Pages show a holding page
+// and reload, and the socket reconnects, once it is back.
+async function restartService () { return rpcIfSupported('service.restart') }
+
 module.exports = {
+  RPC_ERRORS,
+  LAUNCHER_EVENTS,
+  RpcError,
+  rpc,
+  discover,
+  supports,
   isWindowsApp,
+  onLauncherEvent,
+  getWindowState,
   isWindowFullScreen,
   isWindowPinned,
+  isWindowOverlay,
+  isWindowClickThrough,
+  getOverlayOpacity,
   openReleaseNotes,
   openTerminalInBrowser,
   appVersion,
@@ -86,6 +325,28 @@ module.exports = {
   closeWindow,
   toggleFullScreen,
   togglePinWindow,
+  toggleOverlay,
+  toggleClickThrough,
+  setOverlayOpacity,
   checkForUpdate,
-  installUpdate
+  installUpdate,
+  getUpdateStatus,
+  checkForUpdatesNow,
+  setInstallUpdateOnQuit,
+  getHotkeys,
+  setHotkey,
+  getTraySettings,
+  setTraySettings,
+  getSaveGameDir,
+  setSaveGameDir,
+  getConfig,
+  setConfig,
+  getProfiles,
+  createProfile,
+  openProfile,
+  startPairing,
+  getPairedDevices,
+  revokeDevice,
+  exportCertificate,
+  restartService
 }
@@ -1,6 +1,6 @@
 import { useState, useEffect, useMemo } from 'react'
 import { formatBytes, eliteDateTime } from 'lib/format'
-import { newWindow, checkForUpdate, installUpdate, openReleaseNotes, openTerminalInBrowser } from 'lib/window'
+import { newWindow, onLauncherEvent, getUpdateStatus, setInstallUpdateOnQuit, installUpdate, openReleaseNotes, openTerminalInBrowser, getProfiles, createProfile, openProfile, setConfig, startPairing, getPairedDevices, revokeDevice, exportCertificate, restartService } from 'lib/window'
 import { useSocket, eventListener, sendEvent } from 'lib/socket'
 import Loader from 'components/loader'
 import packageJson from '../../../package.json'
@@ -32,9 +32,16 @@ function resolveNetworkAddress (urls = []) {
 export default function IndexPage () {
   const { connected } = useSocket()
   const [hostInfo, setHostInfo] = useState()
-  const [update, setUpdate] = useState()
+  const [updateStatus, setUpdateStatus] = useState()
+  const [updateProgress, setUpdateProgress] = useState()
   const [downloadingUpdate, setDownloadingUpdate] = useState(false)
+  const update = updateStatus?.release
   const [loadingProgress, setLoadingProgress] = useState(defaultloadingStats)
+  const [profiles, setProfiles] = useState()
+  const [showDevices, setShowDevices] = useState(false)
+  const [pairing, setPairing] = useState()
+  const [devices, setDevices] = useState([])
+  const [devicesMessage, setDevicesMessage] = useState()
 
   // Display URL (IP address/port) to connect from a browser
   useEffect(() => {
@@ -53,7 +60,7 @@ export default function IndexPage () {
 
         setHostInfo(info)
 
-        if (resolveNetworkAddress(info?.urls)) {
+        if (resolveNetworkAddress(info?.urls) || info?.lan === false) {
           return
         }
 
@@ -80,13 +87,92 @@ export default function IndexPage () {
     if (message?.loadingComplete === true) {
       document.getElementById('loadingProgressBar').style.opacity = 0
     }
-
-    setTimeout(async () => {
-      const update = await checkForUpdate()
-      setUpdate(update)
-    }, 3000)
   }, [connected])
 
+  // The launcher checks for updates in the background and says what it finds
+  useEffect(async () => setUpdateStatus(await getUpdateStatus()), [])
+  useEffect(() => onLauncherEvent('update.progress', async (progress) => {
+    setUpdateProgress(progress)
+    if (progress.stage === 'failed') setDownloadingUpdate(false)
+    if (progress.stage !== 'checking' && progress.stage !== 'downloading') setUpdateStatus(await getUpdateStatus())
+  }), [])
+
+  async function toggleInstallOnQuit () {
+    try {
+      setUpdateStatus(await setInstallUpdateOnQuit(!updateStatus.installOnQuit))
+    } catch (e) {
+      console.error('Unable to install update on quit', e.message)
+    }
+  }
+
+  // Each profile (commander) has its own launcher, which can run alongside this one
+  useEffect(async () => setProfiles(await getProfiles()), [])
+
+  // Remote devices (tablets and phones) pair with a code while LAN access is on
+  useEffect(async () => {
+    if (!showDevices) return setPairing(undefined)
+    try {
+      setDevices(await getPairedDevices() ?? [])
+    } catch (e) {
+      setDevicesMessage(e?.message ?? e)
+    }
+  }, [showDevices])
+
+  async function pairDevice () {
+    try {
+      setDevicesMessage(undefined)
+      setPairing(await startPairing())
+    } catch (e) {
+      setDevicesMessage(e?.message ?? e)
+    }
+  }
+
+  async function removeDevice (id) {
+    try {
+      setDevices(await revokeDevice(id) ?? [])
+    } catch (e) {
+      setDevicesMessage(e?.message ?? e)
+    }
+  }
+
+  async function turnOnLanAccess () {
+    try {
+      await setConfig('accessMode', 'lan')
+      setDevicesMessage('LAN access will be on when ICARUS Terminal is restarted')
+    } catch (e) {
+      setDevicesMessage(e?.message ?? e)
+    }
+  }
+
+  async function turnOnHttps () {
+    try {
+      await setConfig('https', true)
+      setDevicesMessage('HTTPS will be on when ICARUS Terminal is restarted')
+    } catch (e) {
+      setDevicesMessage(e?.message ?? e)
+    }
+  }
+
+  async function saveCertificate () {
+    try {
+      const path = await exportCertificate()
+      if (path) setDevicesMessage(`Saved ${path}. Install it on each device to trust HTTPS.`)
+    } catch (e) {
+      setDevicesMessage(e?.message ?? e)
+    }
+  }
+
+  async function addProfile () {
+    const name = window.prompt('Name for the new profile (letters, numbers, - and _)')
+    if (!name) return
+    try {
+      setProfiles(await createProfile(name))
+      await openProfile(name)
+    } catch (e) {
+      window.alert(e?.message ?? e)
+    }
+  }
+
   useEffect(() => eventListener('loadingProgress', (message) => {
     setLoadingProgress(message)
     if (message?.loadingComplete === true) {
@@ -103,6 +189,9 @@ export default function IndexPage () {
     if (browserAccessUrl) {
       return { label: browserAccessUrl, interactive: true }
     }
+    if (hostInfo?.lan === false) {
+      return { label: 'LAN ACCESS OFF', interactive: false }
+    }
 
     return { label: 'HTTP ACCESS INITIALIZED', interactive: false }
   }, [browserAccessUrl])
@@ -122,7 +211,7 @@ export default function IndexPage () {
           <h3 className='text-primary'>ICARUS Terminal</h3>
           <h4 className='text-primary text-muted'>Version {packageJson.version}</h4>
         </span>
-        {update && update.isUpgrade &&
+        {update &&
           <div className='fx-fade-in'>
             <div>
               <h4 style={{ marginTop: '1.5rem', fontSize: '1.2rem' }} className='text-info'>Update Released</h4>
@@ -139,12 +228,25 @@ export default function IndexPage () {
               <button
                 onClick={() => {
                   setDownloadingUpdate(true)
-                  installUpdate()
+                  installUpdate('now')
                 }}
               ><i className='icon icarus-terminal-download' /> Install Update
               </button>}
-            {downloadingUpdate && <p className='text-primary text-blink-slow'>
-              <i style={{position: 'relative', top: '.2rem', marginRight: '.2rem'}} className='icon icarus-terminal-download' /> Downloading update...
+            {!downloadingUpdate && updateStatus?.canInstall &&
+              <button
+                onClick={() => {
+                  setDownloadingUpdate(true)
+                  installUpdate('silent')
+                }}
+                style={{ marginLeft: '.5rem' }}
+              >Install &amp; Reopen
+              </button>}
+            {!downloadingUpdate && updateStatus?.canInstall &&
+              <button onClick={toggleInstallOnQuit} className={updateStatus.installOnQuit ? 'button--active' : ''} style={{ marginLeft: '.5rem' }}>
+                {updateStatus.installOnQuit ? 'Installing When I Quit' : 'Install When I Quit'}
+              </button>}
+            {(downloadingUpdate || updateProgress?.stage === 'downloading') && <p className='text-primary text-blink-slow'>
+              <i style={{position: 'relative', top: '.2rem', marginRight: '.2rem'}} className='icon icarus-terminal-download' /> Downloading update{updateProgress?.stage === 'downloading' ? ` (${updateProgress.percent}%)` : ''}...
             </p>}
           </div>}
         <div
@@ -186,9 +288,57 @@ export default function IndexPage () {
             <progress id='loadingProgressBar' value={loadingProgress.numberOfEventsImported} max={loadingProgress.numberOfLogLines} />
           </div>
         </div>
+        {showDevices &&
+          <div
+            className='scrollable text-uppercase' style={{
+              position: 'absolute',
+              top: '1rem',
+              left: '1rem',
+              right: '21rem',
+              bottom: '5rem',
+              background: 'var(--color-background-panel-translucent)',
+              padding: '0 .5rem'
+            }}
+          >
+            <h4 className='text-info'>Remote Devices</h4>
+            {devicesMessage && <p className='text-muted'>{devicesMessage}</p>}
+            {hostInfo?.lan === false
+              ? <button onClick={turnOnLanAccess}>Turn On LAN Access</button>
+              : <button onClick={pairDevice}>Pair Device</button>}
+            {hostInfo?.lan && (hostInfo.urls?.[0]?.startsWith('https:')
+              ? <button style={{ marginLeft: '1rem' }} onClick={saveCertificate}>Save Certificate</button>
+              : <button style={{ marginLeft: '1rem' }} onClick={turnOnHttps}>Turn On HTTPS</button>)}
+            {pairing &&
+              <div style={{ display: 'flex', gap: '1rem', alignItems: 'center', margin: '1rem 0' }}>
+                <img src={pairing.qrCode} alt={pairing.url} style={{ width: '8rem', height: '8rem', imageRendering: 'pixelated' }} />
+                <div>
+                  <p>Scan the code, or go to <span className='text-info'>{pairing.url.replace(/\?.*/, '')}</span> and enter</p>
+                  <h2 className='text-info'>{pairing.code}</h2>
+                  <p className='text-muted'>Expires {new Date(pairing.expiresAt).toLocaleTimeString()}</p>
+                </div>
+              </div>}
+            {devices.length === 0 && <p className='text-muted'>No devices paired</p>}
+            {devices.map(device =>
+              <p key={device.id}>
+                {device.name} <span className='text-muted'>last seen {new Date(device.lastSeen).toLocaleString()}</span>
+                <button style={{ marginLeft: '1rem' }} onClick={() => removeDevice(device.id)}>Revoke</button>
+              </p>
+            )}
+          </div>}
         <div style={{ position: 'absolute', bottom: '1rem', left: '1rem', right: '1rem' }}>
           <div style={{ display: 'flex', gap: '1rem', width: '100%', alignItems: 'stretch' }}>
-            <button style={{ flex: 1 }} onClick={newWindow}>New Terminal</button>
+            <button style={{ flex: 1 }} onClick={() => newWindow()}>New Terminal</button>
+            {profiles &&
+              <select
+                title='Profile'
+                value={profiles.find(profile => profile.active)?.name}
+                onChange={(event) => openProfile(event.target.value)}
+              >
+                {profiles.map(profile => <option key={profile.name} value={profile.name}>{profile.name}</option>)}
+              </select>}
+            {profiles && <button onClick={addProfile}>New Profile</button>}
+            {profiles && <button onClick={() => setShowDevices(!showDevices)}>Remote Devices</button>}
+            {profiles && <button onClick={() => restartService()}>Restart Service</button>}
           </div>
         </div>
       </div>
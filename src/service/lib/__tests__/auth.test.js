@@ -0,0 +1,88 @@
+/**
+ * @jest-environment node
+ */
+
+const EventEmitter = require('events')
+const Auth = require('../auth')
+
+function request (url, headers = {}) {
+  return { url, headers }
+}
+
+function response () {
+  const res = {}
+  res.writeHead = jest.fn((statusCode, headers) => {
+    res.statusCode = statusCode
+    res.headers = headers
+  })
+  res.end = jest.fn()
+  return res
+}
+
+describe('Auth', () => {
+  const auth = new Auth({ token: 'secret', port: 3300 })
+
+  it('swaps a token in the query string for a cookie', () => {
+    const res = response()
+    const next = jest.fn()
+    auth.middleware()(request('/nav/route?system=Sol&token=secret'), res, next)
+
+    expect(next).not.toHaveBeenCalled()
+    expect(res.statusCode).toBe(302)
+    expect(res.headers.Location).toBe('/nav/route?system=Sol')
+    expect(res.headers['Set-Cookie']).toContain('icarus_token_3300=secret')
+    expect(res.headers['Set-Cookie']).toContain('HttpOnly')
+  })
+
+  it('accepts the cookie or a bearer token', () => {
+    for (const headers of [{ cookie: 'other=1; icarus_token_3300=secret' }, { authorization: 'Bearer secret' }]) {
+      const next = jest.fn()
+      auth.middleware()(request('/launcher', headers), response(), next)
+      expect(next).toHaveBeenCalled()
+    }
+  })
+
+  it('rejects requests without the token', () => {
+    for (const req of [request('/launcher'), request('/launcher?token=wrong'), request('/', { cookie: 'icarus_token_3301=secret' })]) {
+      const res = response()
+      const next = jest.fn()
+      auth.middleware()(req, res, next)
+      expect(next).not.toHaveBeenCalled()
+      expect(res.statusCode).toBe(401)
+    }
+  })
+
+  it('checks WebSocket connections', () => {
+    expect(auth.verifyClient()({ req: request('/', { cookie: 'icarus_token_3300=secret' }) })).toBe(true)
+    expect(auth.verifyClient()({ req: request('/') })).toBe(false)
+  })
+
+  it('lets everything through without a token', () => {
+    const next = jest.fn()
+    new Auth({ port: 3300 }).middleware()(request('/'), response(), next)
+    expect(next).toHaveBeenCalled()
+  })
+
+  it('passes events from the launcher on', async () => {
+    const received = []
+    const withEvents = new Auth({ token: 'secret', port: 3300, onLauncherEvent: event => { received.push(event); return 1 } })
+    const post = (headers, body) => new Promise(resolve => {
+      const req = Object.assign(new EventEmitter(), request('/api/launcher-events', headers), { method: 'POST' })
+      const res = response()
+      res.end = jest.fn(() => resolve(res))
+      withEvents.middleware()(req, res, jest.fn())
+      req.emit('data', body)
+      req.emit('end')
+    })
+
+    const event = { id: 1, type: 'service.statusChanged', payload: { status: 'running' } }
+    expect((await post({ authorization: 'Bearer secret' }, JSON.stringify(event))).statusCode).toBe(200)
+    expect(received).toEqual([event])
+    expect((await post({ authorization: 'Bearer secret' }, 'not json')).statusCode).toBe(400)
+
+    const res = response()
+    withEvents.middleware()(Object.assign(request('/api/launcher-events'), { method: 'POST' }), res, jest.fn())
+    expect(res.statusCode).toBe(401)
+    expect(received.length).toBe(1)
+  })
+})
@@ -0,0 +1,48 @@
+/**
+ * @jest-environment node
+ */
+
+const WebSocket = require('ws')
+const LauncherEvents = require('../launcher-events')
+
+function socket (readyState = WebSocket.OPEN) {
+  const sent = []
+  return { readyState, sent, send: jest.fn(message => sent.push(JSON.parse(message))) }
+}
+
+describe('LauncherEvents', () => {
+  const event = { source: 1, id: 2, type: 'service.statusChanged', payload: { status: 'running' } }
+
+  it('only sends events to sockets subscribed to their type', () => {
+    const launcherEvents = new LauncherEvents()
+    const subscribed = socket()
+    const other = socket()
+    const unsubscribed = socket()
+    expect(launcherEvents.subscribe(subscribed, ['terminals.changed', 'service.statusChanged'])).toEqual(['service.statusChanged', 'terminals.changed'])
+    launcherEvents.subscribe(other, ['terminals.changed'])
+
+    expect(launcherEvents.publish([subscribed, other, unsubscribed], event)).toBe(1)
+    expect(subscribed.sent).toEqual([{ name: 'launcherEvent', message: event }])
+    expect(other.sent).toEqual([])
+    expect(unsubscribed.sent).toEqual([])
+  })
+
+  it('replaces a socket\'s subscription', () => {
+    const launcherEvents = new LauncherEvents()
+    const client = socket()
+    launcherEvents.subscribe(client, ['service.statusChanged'])
+    expect(launcherEvents.subscribe(client, 'service.statusChanged')).toEqual([])
+    expect(launcherEvents.publish([client], event)).toBe(0)
+  })
+
+  it('skips sockets that are closing', () => {
+    const launcherEvents = new LauncherEvents()
+    const closing = socket(WebSocket.CLOSING)
+    launcherEvents.subscribe(closing, ['service.statusChanged'])
+    expect(launcherEvents.publish([closing], event)).toBe(0)
+  })
+
+  it('rejects events without a type', () => {
+    expect(() => new LauncherEvents().publish([], { payload: {} })).toThrow()
+  })
+})
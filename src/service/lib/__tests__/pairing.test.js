@@ -0,0 +1,67 @@
+/**
+ * @jest-environment node
+ */
+
+const fs = require('fs')
+const os = require('os')
+const path = require('path')
+const Pairing = require('../pairing')
+
+describe('Pairing', () => {
+  let dir
+  let now
+
+  beforeEach(() => {
+    dir = fs.mkdtempSync(path.join(os.tmpdir(), 'pairing-'))
+    now = Date.parse('2024-01-01T00:00:00Z')
+  })
+
+  afterEach(() => {
+    fs.rmSync(dir, { recursive: true, force: true })
+  })
+
+  function pairing () {
+    return new Pairing({ dir, now: () => now })
+  }
+
+  it('exchanges a code for a device token', () => {
+    const devices = pairing()
+    const { code } = devices.startPairing()
+    expect(code).toMatch(/^\d{6}$/)
+
+    const { id, token } = devices.pair(code, ' Tablet ')
+    expect(devices.deviceForToken(token).id).toBe(id)
+    expect(devices.listDevices()).toEqual([{ id, name: 'Tablet', pairedAt: '2024-01-01T00:00:00.000Z', lastSeen: '2024-01-01T00:00:00.000Z' }])
+
+    // Codes can only be used once
+    expect(() => devices.pair(code, 'Phone')).toThrow()
+  })
+
+  it('keeps devices until they are revoked, storing only token hashes', () => {
+    const devices = pairing()
+    const { id, token } = devices.pair(devices.startPairing().code, 'Tablet')
+    expect(fs.readFileSync(path.join(dir, 'Devices.json'), 'utf8')).not.toContain(token)
+
+    const reloaded = pairing()
+    expect(reloaded.deviceForToken(token).id).toBe(id)
+    expect(reloaded.revoke(id)).toBe(true)
+    expect(reloaded.deviceForToken(token)).toBeNull()
+    expect(pairing().deviceForToken(token)).toBeNull()
+    expect(reloaded.revoke(id)).toBe(false)
+  })
+
+  it('stops accepting a code after it expires', () => {
+    const devices = pairing()
+    const { code } = devices.startPairing()
+    now += 5 * 60 * 1000 + 1
+    expect(() => devices.pair(code, 'Tablet')).toThrow()
+  })
+
+  it('stops accepting a code after too many wrong guesses', () => {
+    const devices = pairing()
+    const { code } = devices.startPairing()
+    const wrong = code === '000000' ? '000001' : '000000'
+    for (let i = 0; i < 5; i++) expect(() => devices.pair(wrong, 'Tablet')).toThrow()
+    expect(() => devices.pair(code, 'Tablet')).toThrow()
+  })
+})
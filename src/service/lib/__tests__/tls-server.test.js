@@ -0,0 +1,62 @@
+/**
+ * @jest-environment node
+ */
+
+const fs = require('fs')
+const os = require('os')
+const path = require('path')
+const TlsServer = require('../tls-server')
+
+function request (url, remoteAddress, encrypted = false) {
+  return { url, headers: { host: '192.168.1.20:3300' }, socket: { remoteAddress, encrypted } }
+}
+
+function response () {
+  const res = {}
+  res.writeHead = jest.fn((statusCode, headers) => {
+    res.statusCode = statusCode
+    res.headers = headers
+  })
+  res.end = jest.fn(body => { res.body = body })
+  return res
+}
+
+describe('TlsServer.middleware', () => {
+  let dir
+  let ca
+
+  beforeEach(() => {
+    dir = fs.mkdtempSync(path.join(os.tmpdir(), 'tls-'))
+    ca = path.join(dir, 'ca.crt')
+    fs.writeFileSync(ca, '-----BEGIN CERTIFICATE-----')
+  })
+
+  afterEach(() => {
+    fs.rmSync(dir, { recursive: true, force: true })
+  })
+
+  it('sends devices on the LAN to HTTPS', () => {
+    const res = response()
+    const next = jest.fn()
+    TlsServer.middleware({ ca })(request('/pair?code=012345', '192.168.1.30'), res, next)
+    expect(next).not.toHaveBeenCalled()
+    expect(res.statusCode).toBe(302)
+    expect(res.headers.Location).toBe('https://192.168.1.20:3300/pair?code=012345')
+  })
+
+  it('leaves HTTPS and this computer alone', () => {
+    for (const req of [request('/', '192.168.1.30', true), request('/', '127.0.0.1'), request('/', '::1'), request('/', '::ffff:127.0.0.1')]) {
+      const next = jest.fn()
+      TlsServer.middleware({ ca })(req, response(), next)
+      expect(next).toHaveBeenCalled()
+    }
+  })
+
+  it('offers the certificate authority over HTTP', () => {
+    const res = response()
+    TlsServer.middleware({ ca })(request(TlsServer.CA_CERTIFICATE_PATH, '192.168.1.30'), res, jest.fn())
+    expect(res.statusCode).toBe(200)
+    expect(res.headers['Content-Type']).toBe('application/x-x509-ca-cert')
+    expect(res.body.toString()).toContain('BEGIN CERTIFICATE')
+  })
+})
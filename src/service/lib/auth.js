@@ -0,0 +1,221 @@
+const crypto = require('crypto')
+const querystring = require('querystring')
+
+// Query parameter the launcher adds to the URLs it opens (see src/app/auth.go)
+const AUTH_TOKEN_PARAM = 'token'
+
+// Paired devices keep their cookie, as their token lasts until revoked
+const DEVICE_COOKIE_MAX_AGE = 365 * 24 * 60 * 60
+
+// Largest pairing form accepted
+const MAX_FORM_SIZE = 4096
+
+// Largest event the launcher can post (see src/app/events.go)
+const MAX_EVENT_SIZE = 64 * 1024
+
+function escapeHtml (text) {
+  return String(text).replace(/[&<>"']/g, c => `&#${c.charCodeAt(0)};`)
+}
+
+// Only clients with the token the launcher started the service with can use
+// it. The launcher opens pages with ?token=, which is swapped for a cookie so
+// it doesn't stay in the address bar or history. Scripts can also send it as
+// "Authorization: Bearer <token>". Without a token, nothing is checked.
+//
+// Devices paired with the launcher (see lib/pairing) use their own token
+// instead, and can't manage pairing themselves (the /api routes).
+class Auth {
+  constructor ({ token, port, pairing, caCertificatePath, onRevoke = () => {}, onLauncherEvent = () => {} }) {
+    this.token = token || ''
+    this.pairing = pairing
+    this.caCertificatePath = caCertificatePath // Offered on the pairing page, with HTTPS
+    this.onRevoke = onRevoke
+    this.onLauncherEvent = onLauncherEvent
+    // Cookies are shared between ports, so services for other profiles on
+    // the same machine need their own cookie
+    this.cookieName = `icarus_token_${port}`
+  }
+
+  get enabled () {
+    return this.token !== ''
+  }
+
+  isValid (candidate) {
+    if (typeof candidate !== 'string') return false
+    // Hash both so they are the same length for timingSafeEqual
+    const expected = crypto.createHash('sha256').update(this.token).digest()
+    const actual = crypto.createHash('sha256').update(candidate).digest()
+    return crypto.timingSafeEqual(expected, actual)
+  }
+
+  tokenFromRequest (req) {
+    const authorization = req.headers.authorization || ''
+    if (authorization.startsWith('Bearer ')) return authorization.substring('Bearer '.length)
+
+    for (const cookie of (req.headers.cookie || '').split(';')) {
+      const [name, ...value] = cookie.trim().split('=')
+      if (name === this.cookieName) return value.join('=')
+    }
+
+    return new URL(req.url, 'http://localhost').searchParams.get(AUTH_TOKEN_PARAM)
+  }
+
+  // Paired device making the request, if any
+  deviceForRequest (req) {
+    return this.pairing ? this.pairing.deviceForToken(this.tokenFromRequest(req)) : null
+  }
+
+  isSession (req) {
+    return !this.enabled || this.isValid(this.tokenFromRequest(req))
+  }
+
+  isAuthorized (req) {
+    return this.isSession(req) || this.deviceForRequest(req) !== null
+  }
+
+  // HTTP middleware, for connect or http.createServer
+  middleware () {
+    return (req, res, next) => {
+      if (!this.enabled) return next()
+
+      const url = new URL(req.url, 'http://localhost')
+      const queryToken = url.searchParams.get(AUTH_TOKEN_PARAM)
+      if (queryToken !== null && this.isValid(queryToken)) {
+        url.searchParams.delete(AUTH_TOKEN_PARAM)
+        res.writeHead(302, {
+          'Set-Cookie': `${this.cookieName}=${this.token}; Path=/; HttpOnly; SameSite=Strict`,
+          'Cache-Control': 'no-store',
+          Location: url.pathname + url.search
+        })
+        return res.end()
+      }
+
+      if (url.pathname === '/pair' && this.pairing) return this.pairPage(req, res, url)
+      if (url.pathname.startsWith('/api/')) return this.api(req, res, url)
+
+      if (this.isAuthorized(req)) return next()
+
+      // Send people to pairing rather than an error page
+      if (this.pairing && req.method === 'GET' && (req.headers.accept || '').includes('text/html')) {
+        res.writeHead(302, { Location: '/pair' })
+        return res.end()
+      }
+      res.writeHead(401, { 'Content-Type': 'text/plain' })
+      res.end('Not authorized. Open ICARUS Terminal from the launcher, or pair this device at /pair.')
+    }
+  }
+
+  // The form a remote device enters the launcher's pairing code in. The code
+  // in a QR code link is filled in, but not used until the form is sent, so
+  // link previews can't use it up.
+  pairPage (req, res, url) {
+    if (req.method !== 'POST') {
+      if (this.isAuthorized(req)) {
+        res.writeHead(302, { Location: '/' })
+        return res.end()
+      }
+      return this.sendPairPage(res, 200, url.searchParams.get('code') || '', '')
+    }
+
+    let body = ''
+    req.on('data', chunk => {
+      body += chunk
+      if (body.length > MAX_FORM_SIZE) req.destroy()
+    })
+    req.on('end', () => {
+      const form = querystring.parse(body)
+      try {
+        const { token } = this.pairing.pair(form.code, form.name)
+        res.writeHead(302, {
+          'Set-Cookie': `${this.cookieName}=${token}; Path=/; HttpOnly; SameSite=Strict; Max-Age=${DEVICE_COOKIE_MAX_AGE}`,
+          Location: '/'
+        })
+        res.end()
+      } catch (e) {
+        this.sendPairPage(res, 403, '', e.message)
+      }
+    })
+  }
+
+  sendPairPage (res, statusCode, code, message) {
+    res.writeHead(statusCode, { 'Content-Type': 'text/html; charset=utf-8', 'Cache-Control': 'no-store' })
+    res.end(`<!DOCTYPE html>
+<html>
+<head>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>Pair with ICARUS Terminal</title>
+  <style>
+    body { background: black; color: rgb(250, 135, 0); font-family: sans-serif; padding: 1rem; }
+    input, button { display: block; font-size: 1.5rem; margin: .5rem 0 1rem; padding: .5rem; width: 100%; max-width: 20rem; box-sizing: border-box; }
+    .error { color: white; }
+  </style>
+</head>
+<body>
+  <h1>Pair with ICARUS Terminal</h1>
+  <p>Enter the code shown in the launcher under Remote Devices.</p>
+  ${this.caCertificatePath ? `<p>If your browser warned this connection isn't private, install the <a href="${this.caCertificatePath}">ICARUS Terminal certificate</a> on this device, then reload.</p>` : ''}
+  ${message ? `<p class="error">${escapeHtml(message)}</p>` : ''}
+  <form method="POST" action="/pair">
+    <label>Code <input name="code" inputmode="numeric" autocomplete="one-time-code" value="${escapeHtml(code)}" required></label>
+    <label>Name for this device <input name="name" placeholder="e.g. Tablet"></label>
+    <button type="submit">Pair</button>
+  </form>
+</body>
+</html>`)
+  }
+
+  // Routes the launcher uses to manage pairing and send its events, which
+  // need the session token
+  api (req, res, url) {
+    const send = (statusCode, body) => {
+      res.writeHead(statusCode, { 'Content-Type': 'application/json', 'Cache-Control': 'no-store' })
+      res.end(JSON.stringify(body))
+    }
+    if (!this.isSession(req)) return send(401, { error: 'Not authorized' })
+    if (url.pathname === '/api/launcher-events' && req.method === 'POST') return this.launcherEvent(req, send)
+    if (!this.pairing) return send(404, { error: 'Pairing is not available' })
+
+    if (url.pathname === '/api/pairing' && req.method === 'POST') {
+      return send(200, this.pairing.startPairing())
+    }
+    if (url.pathname === '/api/devices' && req.method === 'GET') {
+      return send(200, this.pairing.listDevices())
+    }
+    const device = url.pathname.match(/^\/api\/devices\/([0-9a-f]+)$/)
+    if (device && req.method === 'DELETE') {
+      if (!this.pairing.revoke(device[1])) return send(404, { error: 'No such device' })
+      this.onRevoke(device[1])
+      return send(200, this.pairing.listDevices())
+    }
+    send(404, { error: 'Not found' })
+  }
+
+  launcherEvent (req, send) {
+    let body = ''
+    req.on('data', chunk => {
+      body += chunk
+      if (body.length > MAX_EVENT_SIZE) req.destroy()
+    })
+    req.on('end', () => {
+      try {
+        send(200, { sent: this.onLauncherEvent(JSON.parse(body)) })
+      } catch (e) {
+        send(400, { error: e.message })
+      }
+    })
+  }
+
+  // For the verifyClient option of WebSocket.Server. The device is recorded on
+  // the request so its connections can be closed if it is revoked.
+  verifyClient () {
+    return ({ req }) => {
+      if (this.isSession(req)) return true
+      const device = this.deviceForRequest(req)
+      if (device) req.deviceId = device.id
+      return device !== null
+    }
+  }
+}
+
+module.exports = Auth
+module.exports.AUTH_TOKEN_PARAM = AUTH_TOKEN_PARAM
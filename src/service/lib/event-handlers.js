@@ -62,7 +62,7 @@ const KEYBINDS_MAP = {
 }
 
 // FIXME Refactor Preferences handling into a singleton
-const PREFERENCES_DIR = path.join(os.homedir(), 'AppData', 'Local', 'ICARUS Terminal')
+const PREFERENCES_DIR = process.env.ICARUS_PREFERENCES_DIR || path.join(os.homedir(), 'AppData', 'Local', 'ICARUS Terminal')
 const PREFERENCES_FILE = path.join(PREFERENCES_DIR, 'Preferences.json')
 
 const System = require('./event-handlers/system')
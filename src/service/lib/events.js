@@ -6,6 +6,8 @@ const EventHandlers = require('./event-handlers')
 
 const {
   PORT,
+  HOST,
+  TLS,
   LOG_DIR,
   BROADCAST_EVENT: broadcastEvent
 } = global
@@ -27,12 +29,14 @@ eventHandlers.hostInfo = () => {
   const interfaces = Object.values(os.networkInterfaces())
     .filter(Boolean)
     .flat()
+  // Only offer addresses other devices can use if the service listens on them
+  const lan = HOST !== '127.0.0.1' && HOST !== 'localhost'
   const interfaceUrls = interfaces
-    .filter(({ family, internal }) => family === 'IPv4' && !internal)
-    .map(({ address }) => `http://${address}:${PORT}`)
+    .filter(({ family, internal }) => lan && family === 'IPv4' && !internal)
+    .map(({ address }) => `${TLS ? 'https' : 'http'}://${address}:${PORT}`)
   const fallbackUrls = [`http://localhost:${PORT}`, `http://127.0.0.1:${PORT}`]
   const urls = [...new Set([...interfaceUrls, ...fallbackUrls])]
-  return { urls }
+  return { urls, lan }
 }
 eventHandlers.getLoadingStatus = () => getLoadingStatus()
 eventHandlers.syncMessage = (message) => broadcastEvent('syncMessage', message)
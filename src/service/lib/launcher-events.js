@@ -0,0 +1,34 @@
+const WebSocket = require('ws')
+
+// Socket messages a client sends to choose which launcher events it gets, and
+// that the events are sent to it as (see src/client/lib/launcher-events.json)
+const SUBSCRIBE_EVENT = 'subscribeLauncherEvents'
+const SOCKET_EVENT = 'launcherEvent'
+
+// The launcher posts its events here (see src/app/events.go) for clients that
+// aren't its own window, like terminals and devices on the LAN. Each socket
+// only gets the types it subscribed to, which it does again if it reconnects.
+class LauncherEvents {
+  // Returns the types the socket is now subscribed to
+  subscribe (socket, types) {
+    socket.launcherEventTypes = new Set((Array.isArray(types) ? types : []).filter(type => typeof type === 'string'))
+    return [...socket.launcherEventTypes].sort()
+  }
+
+  // Returns how many sockets the event was sent to
+  publish (sockets, event) {
+    if (!event || typeof event.type !== 'string') throw new Error('Expected an event with a type')
+    const message = JSON.stringify({ name: SOCKET_EVENT, message: event })
+    let sent = 0
+    sockets.forEach(socket => {
+      if (socket.readyState !== WebSocket.OPEN || !socket.launcherEventTypes || !socket.launcherEventTypes.has(event.type)) return
+      socket.send(message)
+      sent++
+    })
+    return sent
+  }
+}
+
+module.exports = LauncherEvents
+module.exports.SUBSCRIBE_EVENT = SUBSCRIBE_EVENT
+module.exports.SOCKET_EVENT = SOCKET_EVENT
@@ -0,0 +1,110 @@
+const crypto = require('crypto')
+const fs = require('fs')
+const path = require('path')
+
+const DEVICES_FILE = 'Devices.json'
+
+// How long a pairing code shown by the launcher can be used for
+const PAIRING_CODE_LIFETIME = 5 * 60 * 1000
+
+// Wrong codes allowed before the code stops working, so it can't be guessed
+const PAIRING_CODE_ATTEMPTS = 5
+
+// How often a device being used is saved as last seen
+const LAST_SEEN_INTERVAL = 60 * 1000
+
+function hashToken (token) {
+  return crypto.createHash('sha256').update(token).digest('hex')
+}
+
+// Pairing lets remote devices (tablets and phones on the LAN) use the service
+// without the launcher's session token. The launcher shows a short code, and
+// the device exchanges it for a token of its own, which is kept until the
+// device is revoked. Only hashes of device tokens are stored.
+class Pairing {
+  constructor ({ dir, now = () => Date.now() }) {
+    this.pathToDevices = dir ? path.join(dir, DEVICES_FILE) : null
+    this.now = now
+    this.code = null
+    this.devices = this.load()
+  }
+
+  load () {
+    try {
+      if (this.pathToDevices && fs.existsSync(this.pathToDevices)) {
+        return JSON.parse(fs.readFileSync(this.pathToDevices)).devices || []
+      }
+    } catch (e) {
+      console.error('ERROR_PAIRING_LOAD_DEVICES', this.pathToDevices, e)
+    }
+    return []
+  }
+
+  save () {
+    if (!this.pathToDevices) return
+    try {
+      fs.mkdirSync(path.dirname(this.pathToDevices), { recursive: true })
+      fs.writeFileSync(this.pathToDevices, JSON.stringify({ devices: this.devices }, null, 2), { mode: 0o600 })
+    } catch (e) {
+      console.error('ERROR_PAIRING_SAVE_DEVICES', this.pathToDevices, e)
+    }
+  }
+
+  // Replaces any code that was already being shown
+  startPairing () {
+    const code = crypto.randomInt(0, 1000000).toString().padStart(6, '0')
+    this.code = { code, expiresAt: this.now() + PAIRING_CODE_LIFETIME, attempts: 0 }
+    return { code, expiresAt: new Date(this.code.expiresAt).toISOString() }
+  }
+
+  // Returns { id, token } for the new device, or throws if the code is wrong
+  pair (code, name) {
+    if (!this.code || this.now() > this.code.expiresAt) {
+      this.code = null
+      throw new Error('No pairing code is being shown. Start pairing from the launcher.')
+    }
+    if (String(code || '').trim() !== this.code.code) {
+      if (++this.code.attempts >= PAIRING_CODE_ATTEMPTS) this.code = null
+      throw new Error('That code is not right. Check the code shown by the launcher.')
+    }
+    this.code = null
+
+    const token = crypto.randomBytes(32).toString('hex')
+    const device = {
+      id: crypto.randomBytes(8).toString('hex'),
+      name: String(name || '').trim().substring(0, 64) || 'Unnamed device',
+      tokenHash: hashToken(token),
+      pairedAt: new Date(this.now()).toISOString(),
+      lastSeen: new Date(this.now()).toISOString()
+    }
+    this.devices.push(device)
+    this.save()
+    return { id: device.id, token }
+  }
+
+  // Returns the device a token belongs to, if any
+  deviceForToken (token) {
+    if (typeof token !== 'string' || token === '') return null
+    const tokenHash = hashToken(token)
+    const device = this.devices.find(device => device.tokenHash === tokenHash)
+    if (device && this.now() - Date.parse(device.lastSeen) > LAST_SEEN_INTERVAL) {
+      device.lastSeen = new Date(this.now()).toISOString()
+      this.save()
+    }
+    return device || null
+  }
+
+  listDevices () {
+    return this.devices.map(({ id, name, pairedAt, lastSeen }) => ({ id, name, pairedAt, lastSeen }))
+  }
+
+  revoke (id) {
+    const count = this.devices.length
+    this.devices = this.devices.filter(device => device.id !== id)
+    if (this.devices.length === count) return false
+    this.save()
+    return true
+  }
+}
+
+module.exports = Pairing
@@ -16,6 +16,9 @@ class Preferences {
   }
 
   preferencesDir () {
+    // Set by the launcher for profiles other than the default
+    if (process.env.ICARUS_PREFERENCES_DIR) return process.env.ICARUS_PREFERENCES_DIR
+
     switch (os.platform()) {
       case 'win32': // Windows (all versions)
         return path.join(os.homedir(), 'AppData', 'Local', 'ICARUS Terminal')
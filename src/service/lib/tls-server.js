@@ -0,0 +1,77 @@
+const fs = require('fs')
+const net = require('net')
+const tls = require('tls')
+
+// First byte of a TLS handshake
+const TLS_HANDSHAKE = 0x16
+
+// Path devices can download the launcher's certificate authority from, to
+// install it so they trust the service's certificate (see
+// src/app/certificates.go)
+const CA_CERTIFICATE_PATH = '/ca.crt'
+
+function isLoopback (address = '') {
+  return address === '::1' || address.startsWith('127.') || address.startsWith('::ffff:127.')
+}
+
+// Serves both HTTPS and plain HTTP on the same port, by looking at the first
+// byte each client sends. The launcher's own windows keep using HTTP on
+// localhost, as they don't trust the certificate, while devices on the LAN
+// are sent to HTTPS. Requests (and WebSocket upgrades) are all handled by
+// httpServer, which should not be listened on itself.
+class TlsServer {
+  constructor (httpServer, { cert, key }) {
+    this.httpServer = httpServer
+    this.tlsServer = tls.createServer({
+      cert: fs.readFileSync(cert),
+      key: fs.readFileSync(key),
+      ALPNProtocols: ['http/1.1']
+    }, socket => httpServer.emit('connection', socket))
+    this.tlsServer.on('tlsClientError', () => {}) // e.g. devices that don't trust the certificate yet
+
+    this.server = net.createServer(socket => {
+      socket.once('data', data => {
+        socket.pause()
+        socket.unshift(data)
+        const server = data[0] === TLS_HANDSHAKE ? this.tlsServer : this.httpServer
+        server.emit('connection', socket)
+        process.nextTick(() => socket.resume())
+      })
+      socket.on('error', () => {})
+    })
+    // e.g. EADDRINUSE, which main.js handles on the HTTP server
+    this.server.on('error', error => httpServer.emit('error', error))
+  }
+
+  listen (...args) {
+    return this.server.listen(...args)
+  }
+
+  on (...args) {
+    return this.server.on(...args)
+  }
+
+  // Middleware that offers the certificate authority, and sends devices on
+  // the LAN to HTTPS. Goes before auth, as the certificate is public and the
+  // pairing page should be secure.
+  static middleware ({ ca }) {
+    return (req, res, next) => {
+      const url = new URL(req.url, 'http://localhost')
+      if (url.pathname === CA_CERTIFICATE_PATH && ca) {
+        res.writeHead(200, {
+          'Content-Type': 'application/x-x509-ca-cert',
+          'Content-Disposition': 'attachment; filename="ICARUS Terminal CA.crt"'
+        })
+        return res.end(fs.readFileSync(ca))
+      }
+      if (!req.socket.encrypted && !isLoopback(req.socket.remoteAddress) && req.headers.host) {
+        res.writeHead(302, { Location: `https://${req.headers.host}${req.url}` })
+        return res.end()
+      }
+      next()
+    }
+  }
+}
+
+module.exports = TlsServer
+module.exports.CA_CERTIFICATE_PATH = CA_CERTIFICATE_PATH
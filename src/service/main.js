@@ -13,6 +13,11 @@ const WebSocket = require('ws')
 const yargs = require('yargs')
 const packageJson = require('../../package.json')
 const TokenLedger = require('./lib/token-ledger')
+const Auth = require('./lib/auth')
+const Pairing = require('./lib/pairing')
+const LauncherEvents = require('./lib/launcher-events')
+const TlsServer = require('./lib/tls-server')
+const Preferences = require('./lib/preferences')
 
 const commandLineArgs = yargs
   .help()
@@ -27,6 +32,38 @@ const commandLineArgs = yargs
     alias: 's',
     description: 'Elite Dangerous Save Game Directory'
   })
+  .option('host', {
+    type: 'string',
+    description: 'Address to listen on, e.g. 0.0.0.0 for the LAN (default: all addresses)'
+  })
+  .option('tls-cert', {
+    type: 'string',
+    description: 'Certificate to also serve HTTPS with, on the same port (needs --tls-key)'
+  })
+  .option('tls-key', {
+    type: 'string',
+    description: 'Private key for --tls-cert'
+  })
+  .option('tls-ca', {
+    type: 'string',
+    description: 'Certificate authority that signed --tls-cert, offered to devices to install'
+  })
+  .option('public-port', {
+    type: 'number',
+    description: 'Port clients connect to, if behind a proxy such as the launcher (default: --port)'
+  })
+  .option('public-host', {
+    type: 'string',
+    description: 'Address clients connect to, if behind a proxy (default: --host)'
+  })
+  .option('public-https', {
+    type: 'boolean',
+    description: 'Clients on the LAN connect with HTTPS, if behind a proxy'
+  })
+  .option('preferences-dir', {
+    type: 'string',
+    description: 'Directory to keep preferences in (set by the launcher for each profile)'
+  })
   .version(packageJson.version)
   .alias('v', 'version')
   .alias('h', 'help')
@@ -34,9 +71,20 @@ const commandLineArgs = yargs
 
 console.log(`ICARUS Terminal Service ${packageJson.version}`)
 
+// Read by lib/preferences (and anything else that keeps preferences)
+if (commandLineArgs['preferences-dir']) {
+  process.env.ICARUS_PREFERENCES_DIR = commandLineArgs['preferences-dir']
+}
+
 // Parse command line arguments
 const PORT = commandLineArgs.port || commandLineArgs.p || 3300 // Port to listen on
 const DEVELOPMENT = commandLineArgs.dev || false // Development mode
+const TLS = Boolean(commandLineArgs['tls-cert'] && commandLineArgs['tls-key']) // Also serve HTTPS
+// Behind the launcher's proxy (see src/app/proxy.go) clients connect to the
+// launcher's port, which stays the same when the service is restarted
+const PUBLIC_PORT = commandLineArgs['public-port'] || PORT
+const PUBLIC_HOST = commandLineArgs['public-host'] || commandLineArgs.host
+const PUBLIC_TLS = TLS || Boolean(commandLineArgs['public-https'])
 const WEB_DIR = 'build/client'
 const DEFAULT_LOG_DIR = getLogDir()
 const MOCK_DATA_DIR = path.join(__dirname, '..', '..', 'resources', 'mock-game-data')
@@ -97,7 +145,9 @@ function getLogDir () {
 }
 
 // Export globals BEFORE loading libraries that use them
-global.PORT = PORT
+global.PORT = PUBLIC_PORT
+global.HOST = PUBLIC_HOST
+global.TLS = PUBLIC_TLS
 global.LOG_DIR = LOG_DIR
 global.USING_MOCK_DATA = USING_MOCK_DATA
 global.BROADCAST_EVENT = broadcastEvent
@@ -114,32 +164,61 @@ global.CACHE = {
 // Don't load events till globals are set
 const { eventHandlers, init } = require('./lib/events')
 
+// The launcher passes a token for the session in the environment (see
+// src/app/auth.go), which isn't passed on to anything the service starts
+const auth = new Auth({
+  token: process.env.ICARUS_AUTH_TOKEN,
+  port: PUBLIC_PORT,
+  pairing: new Pairing({ dir: Preferences.preferencesDir() }),
+  // Served by the launcher's proxy too, with HTTPS on
+  caCertificatePath: (TLS && commandLineArgs['tls-ca']) || commandLineArgs['public-https'] ? TlsServer.CA_CERTIFICATE_PATH : null,
+  onRevoke: (deviceId) => webSocketServer.clients.forEach(client => {
+    if (client.deviceId === deviceId) client.close()
+  }),
+  onLauncherEvent: (event) => launcherEvents.publish(webSocketServer.clients, event)
+})
+const launcherEvents = new LauncherEvents()
+delete process.env.ICARUS_AUTH_TOKEN
+if (!auth.enabled) console.warn('WARNING: No ICARUS_AUTH_TOKEN set, so any client can connect')
+
+// The launcher passes a certificate if HTTPS is turned on (see
+// src/app/certificates.go)
+const checkTls = TLS ? TlsServer.middleware({ ca: commandLineArgs['tls-ca'] }) : (req, res, next) => next()
+
 let httpServer
 if (DEVELOPMENT) {
   // If DEVELOPMENT is specified then HTTP requests other than web socket
   // requests will be forwarded to a web server which is started on localhost
   // to allow UI changes to be tested without rebuilding the app.
   exec('npx next src/client')
-  httpServer = http.createServer((req, res) => proxy.web(req, res, { target: 'http://localhost:3000' }))
+  const checkAuth = auth.middleware()
+  httpServer = http.createServer((req, res) => checkTls(req, res, () => checkAuth(req, res, () => proxy.web(req, res, { target: 'http://localhost:3000' }))))
 } else {
   // The default behaviour (i.e. production) is to serve static assets. When the
   // application is compiled to a native executable these assets will be bundled
   // with the executable in a virtual file system.
-  const webServer = connect().use(serveStatic(WEB_DIR, { extensions: ['html'] }))
+  const webServer = connect().use(checkTls).use(auth.middleware()).use(serveStatic(WEB_DIR, { extensions: ['html'] }))
   httpServer = http.createServer(webServer)
 }
 
-const webSocketServer = new WebSocket.Server({ server: httpServer })
+const server = TLS
+  ? new TlsServer(httpServer, { cert: commandLineArgs['tls-cert'], key: commandLineArgs['tls-key'] })
+  : httpServer
+
+const webSocketServer = new WebSocket.Server({ server: httpServer, verifyClient: auth.verifyClient() })
 
 function webSocketDebugMessage () { /* console.log(...arguments) */ }
 
 // Bind message event handler to WebSocket server before starting server
-webSocketServer.on('connection', socket => {
+webSocketServer.on('connection', (socket, req) => {
   webSocketDebugMessage('WebSocket connection open')
+  socket.deviceId = req.deviceId // Set by auth.verifyClient() for paired devices
   socket.on('message', async (event) => {
     const { requestId, name, message } = JSON.parse(event)
     webSocketDebugMessage('WebSocket message received', name, event.toString())
-    if (eventHandlers[name]) {
+    if (name === LauncherEvents.SUBSCRIBE_EVENT) {
+      socket.send(JSON.stringify({ requestId, name, message: launcherEvents.subscribe(socket, (message || {}).types) }))
+    } else if (eventHandlers[name]) {
       try {
         const data = await eventHandlers[name](message || {})
         socket.send(JSON.stringify({ requestId, name, message: data }))
@@ -198,8 +277,9 @@ async function startService () {
     process.exit(1)
   }
 
-  httpServer.listen(PORT, () => {
-    console.log(`Listening on port ${PORT}…`)
+  // The launcher passes 127.0.0.1 unless LAN access is turned on
+  server.listen(PORT, commandLineArgs.host, () => {
+    console.log(`Listening on ${commandLineArgs.host || 'port'} ${PORT}${TLS ? ' (HTTP and HTTPS)' : ''}…`)
   })
 }
 